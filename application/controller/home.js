@@ -1,6 +1,6 @@
 
 var user_fcn = ['getUsers', 'getBikes','updateBikeLocation', 'startRide', 'endRide', 'reportIssue'];
-var user_args = ['','','BIKE_ID LONGITUDE LATITUDE' ,'USER_ID RIDE_ID BIKE_ID TIMESTAMP LONGITUDE LATITUDE','USER_ID RIDE_ID TIMESTAMP LONGITUDE LATITUDE', 'USER_ID ISSUE_ID RIDE_ID'];
+var user_args = ['','','BIKE_ID LONGITUDE LATITUDE' ,'USER_ID RIDE_ID BIKE_ID LONGITUDE LATITUDE [DEVICE_TIME]','USER_ID RIDE_ID LONGITUDE LATITUDE [DEVICE_TIME]', 'USER_ID ISSUE_ID RIDE_ID'];
 var provider_fcn = ['getUsers','getRepairers','getBikes','getBikeById','getBikesByStatus','getRides','getRideById','getRidesByUser','getRidesByBike','getRidesByStatus','getIssues','getIssueById','getIssuesByUser','getIssuesByBike','getIssueByRide','getIssuesByStatus','getRepairs','getRepairById','getRepairsByBike','getRepairsByRepairer','getRepairsByStatus','registerBike','reactivateBike','discardBike','updateBikeLocation','acceptIssue','rejectIssue','requestRepair'];
 var provider_args = ['','','','BIKE_ID','BIKE_STATUS','','RIDE_ID','USER_ID','BIKE_ID','RIDE_STATUS','','ISSUE_ID','USER_ID','BIKE_ID','RIDE_ID','ISSUE_STATUS','','REPAIR_ID','BIKE_ID','REPAIRER_ID','REPAIR_STATUS','BIKE_ID','BIKE_ID','BIKE_ID','BIKE_ID LONGITUDE LATITUDE','ISSUE_ID','ISSUE_ID','REPAIR_ID BIKE_ID REPAIRER_ID'];
 var repairer_fcn = ['getRepairers','getIssues','getIssueById','getIssuesByUser','getIssuesByBike','getIssueByRide','getIssuesByStatus','getRepairs','getRepairById','getRepairsByBike','getRepairsByRepairer','getRepairsByStatus','updateBikeLocation','acceptRepair','rejectRepair','completeRepair'];
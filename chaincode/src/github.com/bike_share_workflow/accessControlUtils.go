@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"crypto/x509"
@@ -41,16 +43,201 @@ func getTxCreatorInfo(stub shim.ChaincodeStubInterface) (string, string, error)
 	return mspid, cert.Issuer.CommonName, nil
 }
 
-// For simplicity, just hardcode an ACL
+// Get an identity string unique to the enrolled caller, qualified with its MSP
+func getTxCreatorID(stub shim.ChaincodeStubInterface) (string, error) {
+	var mspid, id string
+	var err error
+
+	mspid, err = cid.GetMSPID(stub)
+	if err != nil {
+		fmt.Printf("Error getting MSP identity: %s\n", err.Error())
+		return "", err
+	}
+
+	id, err = cid.GetID(stub)
+	if err != nil {
+		fmt.Printf("Error getting client identity: %s\n", err.Error())
+		return "", err
+	}
 
-func authenticateProviderOrg(mspID string, certCN string) bool {
-	return (mspID == "ProviderOrgMSP") && (certCN == "ca.providerorg.bikeshare.com")
+	return mspid + "/" + id, nil
 }
 
-func authenticateUserOrg(mspID string, certCN string) bool {
-	return (mspID == "UserOrgMSP") && (certCN == "ca.userorg.bikeshare.com")
+// Get the identity a new user or repairer record is bound to. The caller's certificate
+// must carry the ID attribute with the ID being registered, so that the CA decides which
+// IDs an identity may take, and an identity registers one record at most.
+func getRegistrantOwner(stub shim.ChaincodeStubInterface, id string) (string, error) {
+	attrID, found, err := getCustomAttribute(stub, ID_ATTRIBUTE)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", newError(ERR_ACCESS_DENIED, fmt.Sprintf("Certificate lacks attribute %s required to register %s.", ID_ATTRIBUTE, id))
+	}
+	if attrID != id {
+		return "", newError(ERR_ACCESS_DENIED, fmt.Sprintf("Certificate attribute %s is %s, not %s.", ID_ATTRIBUTE, attrID, id))
+	}
+
+	return getTxCreatorID(stub)
 }
 
-func authenticateRepairerOrg(mspID string, certCN string) bool {
-	return (mspID == "RepairerOrgMSP") && (certCN == "ca.repairerorg.bikeshare.com")
+// Verify that the caller is the identity a user or repairer record is bound to
+func verifyOwner(stub shim.ChaincodeStubInterface, owner string, entity string, id string) error {
+	callerID, err := getTxCreatorID(stub)
+	if err != nil {
+		return err
+	}
+	if owner == "" || owner != callerID {
+		return newError(ERR_ACCESS_DENIED, fmt.Sprintf("Caller not the owner of %s %s. Access denied.", entity, id)).withEntity(strings.ToUpper(entity), id)
+	}
+
+	return nil
+}
+
+// Verify that the caller may read the records of a user: providers read those of every
+// user, anyone else only those of the user they own. Reading a missing user is left to
+// the query, which finds nothing.
+func verifyUserReader(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, userID string) error {
+	acl, err := getAccessControlList(stub)
+	if err != nil {
+		return err
+	}
+	if hasRole(acl, ROLE_PROVIDER, creatorOrg, creatorCertIssuer) {
+		return nil
+	}
+
+	user, err := users(stub).Get(userID)
+	if err != nil || user == nil {
+		return err
+	}
+	return verifyOwner(stub, user.Owner, "user", user.Id)
+}
+
+// Verify that the caller may read a ride, which belongs to the records of its user
+func verifyRideReader(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, rideID string) error {
+	ride, err := rides(stub).Get(rideID)
+	if err != nil || ride == nil {
+		return err
+	}
+	return verifyUserReader(stub, creatorOrg, creatorCertIssuer, ride.UserId)
+}
+
+// Default ACL, used until an updated table is stored on the ledger
+func getDefaultAccessControlList() *AccessControlList {
+	roles := map[string][]AccessMember{
+		ROLE_PROVIDER: {{"ProviderOrgMSP", "ca.providerorg.bikeshare.com"}},
+		ROLE_USER: {{"UserOrgMSP", "ca.userorg.bikeshare.com"}},
+		ROLE_REPAIRER: {{"RepairerOrgMSP", "ca.repairerorg.bikeshare.com"}},
+	}
+
+	// Each function is open to the roles declared in the function registry
+	rules := map[string]AccessRule{}
+	for _, spec := range getFunctionRegistry() {
+		rules[spec.Name] = AccessRule{Roles: spec.Roles}
+	}
+	// Only administrators may replace the table
+	rules["setAccessControlList"] = AccessRule{Roles: rules["setAccessControlList"].Roles, Attributes: map[string]string{ADMIN_ATTRIBUTE: "true"}}
+
+	return &AccessControlList{ACL, roles, rules}
+}
+
+// Get the ACL in force
+func getAccessControlList(stub shim.ChaincodeStubInterface) (*AccessControlList, error) {
+	var acl *AccessControlList
+
+	aclKey, err := getAccessControlListKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	aclBytes, err := stub.GetState(aclKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(aclBytes) == 0 {
+		return getDefaultAccessControlList(), nil
+	}
+
+	err = json.Unmarshal(aclBytes, &acl)
+	if err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+// Verify that every rule refers to a defined role and that the table can still be updated, by administrators only
+func validateAccessControlList(acl *AccessControlList) error {
+	for function, rule := range acl.Rules {
+		for _, role := range rule.Roles {
+			if _, ok := acl.Roles[role]; !ok {
+				return newError(ERR_INVALID_ACL, fmt.Sprintf("Rule for %s refers to undefined role %s.", function, role))
+			}
+		}
+	}
+	rule, ok := acl.Rules["setAccessControlList"]
+	if !ok || (len(rule.Roles) == 0 && len(rule.MSPs) == 0) {
+		return newError(ERR_INVALID_ACL, "ACL must keep a rule allowing setAccessControlList.")
+	}
+	if rule.Attributes[ADMIN_ATTRIBUTE] != "true" {
+		return newError(ERR_INVALID_ACL, fmt.Sprintf("ACL must require attribute %s=true for setAccessControlList.", ADMIN_ATTRIBUTE))
+	}
+
+	return nil
+}
+
+func hasRole(acl *AccessControlList, role string, mspID string, certCN string) bool {
+	for _, member := range acl.Roles[role] {
+		if member.MSPID == mspID && (member.CertIssuer == "" || member.CertIssuer == certCN) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the caller against the ACL rule of the invoked function. The caller must
+// belong to one of the listed MSPs or roles and carry every listed certificate
+// attribute; an empty attribute value only requires the attribute to be present.
+func checkAccess(stub shim.ChaincodeStubInterface, function string, mspID string, certCN string) error {
+	acl, err := getAccessControlList(stub)
+	if err != nil {
+		return err
+	}
+
+	// Functions added after the table was stored follow their default rule until it names them
+	rule, ok := acl.Rules[function]
+	if !ok {
+		rule, ok = getDefaultAccessControlList().Rules[function]
+	}
+	if !ok {
+		return newError(ERR_ACCESS_DENIED, fmt.Sprintf("No access rule for %s. Access denied.", function))
+	}
+
+	member := false
+	for _, msp := range rule.MSPs {
+		if msp == mspID {
+			member = true
+			break
+		}
+	}
+	for _, role := range rule.Roles {
+		if member {
+			break
+		}
+		member = hasRole(acl, role, mspID, certCN)
+	}
+	if !member {
+		return newError(ERR_ACCESS_DENIED, fmt.Sprintf("Caller not permitted to invoke %s. Access denied.", function))
+	}
+
+	for attr, required := range rule.Attributes {
+		value, found, err := getCustomAttribute(stub, attr)
+		if err != nil {
+			return err
+		}
+		if !found || (required != "" && value != required) {
+			return newError(ERR_ACCESS_DENIED, fmt.Sprintf("Caller lacks attribute %s required for %s. Access denied.", attr, function))
+		}
+	}
+
+	return nil
 }
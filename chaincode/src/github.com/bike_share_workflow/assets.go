@@ -1,23 +1,46 @@
 package main
 
+// Audit fields of the entities, kept by the repository on every write
+type Audit struct {
+	CreatedAt		string		`json:"createdAt"`
+	CreatedTxId		string		`json:"createdTxId"`
+	UpdatedAt		string		`json:"updatedAt"`
+	UpdatedTxId		string		`json:"updatedTxId"`
+}
+
 type User struct {
 	ObjectType 		string 		`json:"docType"`
 	Id				string		`json:"id"`
-	Balance			float32		`json:"balance"`
+	Owner			string		`json:"owner"`			// Identity of the enrolled caller
+	Balance			Money		`json:"balance"`
+	Held			Money		`json:"held"`				// Held for the ongoing ride
+	Available		Money		`json:"available"`			// Balance less the held amount
+	EntryCount		int			`json:"entryCount"`		// Number of balance entries written
 	RideId			string		`json:"rideId"`			// Most receent ride ID
+	ReservedBikeId	string		`json:"reservedBikeId"`	// Bike reserved by the user, if any
+	NoShowCount		int			`json:"noShowCount"`		// Reservations in a row that expired unused
 	Status			string		`json:"status"`
+	Audit
 }
 
 type Repairer struct {
 	ObjectType 		string 		`json:"docType"`
 	Id				string		`json:"id"`
+	Owner			string		`json:"owner"`			// Identity of the enrolled caller
+	Audit
 }
 
 type Bike struct {
 	ObjectType 		string 		`json:"docType"`
 	Id				string		`json:"id"`
 	Location		[]float32	`json:"location"`
+	StationId		string		`json:"stationId"`			// Station the bike is docked at, if any
+	Geohash			string		`json:"geohash"`			// Geohash of the location, indexed for nearby searches
+	ReservedBy		string		`json:"reservedBy"`			// User holding the reservation, if any
+	ReservedUntil	string		`json:"reservedUntil"`		// Expiry of the reservation
+	OdometerMeters	int64		`json:"odometerMeters"`		// Distance of the completed rides
 	Status			string		`json:"status"`
+	Audit
 }
 
 type Ride struct {
@@ -27,10 +50,23 @@ type Ride struct {
 	BikeId			string		`json:"bikeId"`
 	StartTime		string		`json:"startTime"`
 	StartLocation	[]float32	`json:"startLocation"`
+	StartStationId	string		`json:"startStationId"`
 	EndTime			string		`json:"endTime"`
 	EndLocation		[]float32	`json:"endLocation"`
-	Cost			float32		`json:"cost"`
+	EndStationId	string		`json:"endStationId"`
+	EndZoneId		string		`json:"endZoneId"`			// Zone deciding the zone fee, if any
+	ZoneFee			Money		`json:"zoneFee"`			// Surcharge, or negative discount, included in the cost
+	Cost			Money		`json:"cost"`
+	Hold			Money		`json:"hold"`				// Amount held from the user's balance at the start
+	DistanceMeters	int64		`json:"distanceMeters"`		// Along the track, from the start to the end location
+	TrackSampleCount	int		`json:"trackSampleCount"`
+	TrackSegmentCount	int		`json:"trackSegmentCount"`
+	TrackEndTime	string		`json:"trackEndTime"`		// Time of the last sample
+	TrackRoot		string		`json:"trackRoot"`			// Merkle root of the samples
+	TrackFrontier	[]string	`json:"trackFrontier"`		// Roots of the complete subtrees, to append further samples
+	TariffVersion	int			`json:"tariffVersion"`
 	Status			string		`json:"status"`
+	Audit
 }
 
 type Issue struct {
@@ -40,6 +76,7 @@ type Issue struct {
 	BikeId			string		`json:"bikeId"`
 	RideId			string		`json:"rideId"`
 	Status			string		`json:"status"`
+	Audit
 }
 
 type Repair struct {
@@ -48,4 +85,97 @@ type Repair struct {
 	BikeId			string		`json:"bikeId"`
 	RepairerId		string		`json:"repairerId"`
 	Status			string		`json:"status"`
+	Audit
+}
+
+// Docking station. Each dock slot holds the ID of the bike docked in it, or nothing.
+type Station struct {
+	ObjectType 		string 		`json:"docType"`
+	Id				string		`json:"id"`
+	Location		[]float32	`json:"location"`
+	Capacity		int			`json:"capacity"`
+	Docks			[]string	`json:"docks"`
+	DockedCount		int			`json:"dockedCount"`
+	DockAvailability	string	`json:"dockAvailability"`	// Whether a bike can be docked
+	Status			string		`json:"status"`
+	Audit
+}
+
+// Area drawn by the provider. The polygon lists its vertices as [longitude, latitude] pairs.
+type Zone struct {
+	ObjectType 		string 			`json:"docType"`
+	Id				string			`json:"id"`
+	Type			string			`json:"type"`
+	Polygon			[][]float64		`json:"polygon"`
+	Fee				Money			`json:"fee"`			// Surcharge or discount, depending on the type
+	Status			string			`json:"status"`
+	Audit
+}
+
+// GPS samples appended to a ride in one transaction, encoded as a polyline. Segments are
+// only ever created, never updated.
+type TrackSegment struct {
+	ObjectType 		string 		`json:"docType"`
+	Id				string		`json:"id"`				// Ride ID and sequence number
+	RideId			string		`json:"rideId"`
+	FirstSample		int			`json:"firstSample"`		// Index of the first sample in the track
+	SampleCount		int			`json:"sampleCount"`
+	Samples			string		`json:"samples"`
+	TrackRoot		string		`json:"trackRoot"`			// Merkle root of the track up to this segment
+	Audit
+}
+
+// Movement of a user's balance. Entries are only ever created, never updated.
+type BalanceEntry struct {
+	ObjectType 		string 		`json:"docType"`
+	Id				string		`json:"id"`				// User ID and sequence number
+	UserId			string		`json:"userId"`
+	Amount			Money		`json:"amount"`			// Negative for debits
+	Balance			Money		`json:"balance"`			// Balance after the movement
+	Reason			string		`json:"reason"`
+	RideId			string		`json:"rideId"`
+	IssueId			string		`json:"issueId"`
+	CounterpartyId	string		`json:"counterpartyId"`	// Other user of a transfer
+	BikeId			string		`json:"bikeId"`			// Bike of a missed reservation
+	TxId			string		`json:"txId"`
+	Audit
+}
+
+type Tariff struct {
+	ObjectType 		string 		`json:"docType"`
+	Version			int			`json:"version"`
+	UnlockFee		Money		`json:"unlockFee"`
+	PerMinuteRate	Money		`json:"perMinuteRate"`
+	FreeMinutes		int			`json:"freeMinutes"`
+	DailyCap		Money		`json:"dailyCap"`			// 0 means no cap
+	Rounding		string		`json:"rounding"`
+	PerKmRate		Money		`json:"perKmRate"`			// Charged on the track distance, 0 means none
+}
+
+type Config struct {
+	ObjectType 		string 		`json:"docType"`
+	MaxClockSkew	int			`json:"maxClockSkew"`		// Seconds a device time may differ from the transaction time
+	RichQueries		bool		`json:"richQueries"`		// Serve queries from CouchDB rather than key indexes
+	HoldPolicy		string		`json:"holdPolicy"`		// Amount held at the start of a ride
+	HoldDeposit		Money		`json:"holdDeposit"`
+	ReservationMinutes	int		`json:"reservationMinutes"`	// Time a reservation holds a bike
+	NoShowFee		Money		`json:"noShowFee"`			// Charged for an expired reservation, 0 means none
+	NoShowAllowance	int			`json:"noShowAllowance"`	// Expired reservations in a row before the fee applies
+}
+
+type AccessMember struct {
+	MSPID			string		`json:"mspId"`
+	CertIssuer		string		`json:"certIssuer"`		// CA common name, empty matches any
+}
+
+type AccessRule struct {
+	Roles			[]string			`json:"roles"`
+	MSPs			[]string			`json:"msps"`
+	Attributes		map[string]string	`json:"attributes"`
+}
+
+type AccessControlList struct {
+	ObjectType 		string 						`json:"docType"`
+	Roles			map[string][]AccessMember	`json:"roles"`
+	Rules			map[string]AccessRule		`json:"rules"`		// Keyed by function name
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Balance entry IDs are the user ID and a zero-padded sequence number, so a
+// user's statement sorts in the order the entries were written
+func getBalanceEntryID(userID string, sequence int) string {
+	return fmt.Sprintf("%s-%010d", userID, sequence)
+}
+
+// Apply a signed amount to the balance of a user and write the balance entry recording it.
+// The entry carries the amount, reason and references; the user ID, sequence, resulting
+// balance and transaction ID are filled in here. Zero amounts leave no entry. The caller
+// writes the user.
+func postBalanceEntry(stub shim.ChaincodeStubInterface, user *User, entry *BalanceEntry, event *Event) error {
+	if entry.Amount.Amount == 0 {
+		return nil
+	}
+
+	balance, err := user.Balance.Add(entry.Amount)
+	if err != nil {
+		return err
+	}
+
+	user.Balance = balance
+	user.EntryCount++
+	user.availableBalance()
+
+	entry.ObjectType = BALANCE_ENTRY
+	entry.Id = getBalanceEntryID(user.Id, user.EntryCount)
+	entry.UserId = user.Id
+	entry.Balance = balance
+	entry.TxId = stub.GetTxID()
+	err = balanceEntries(stub).Create(entry)
+	if err != nil {
+		return err
+	}
+
+	event.addChange(BALANCE_ENTRY, entry.Id, "", "")
+	return nil
+}
+
+// Verify that an amount moved by a user is positive and can be covered by the user's available balance
+func checkDebit(args *Args, name string, user *User, amount Money) error {
+	if amount.Amount <= 0 {
+		return badArgument(args, name, "Amount must be positive.")
+	}
+	if amount.Currency != user.Balance.Currency {
+		return newError(ERR_CURRENCY_MISMATCH, fmt.Sprintf("Currency mismatch: %s and %s.", user.Balance.Currency, amount.Currency)).withArg(args.Index(name))
+	}
+	available := user.availableBalance()
+	if available.Amount < amount.Amount {
+		return newError(ERR_INSUFFICIENT_BALANCE, fmt.Sprintf("User %s has insufficient available balance %s for %s.", user.Id, available, amount)).withEntity(USER, user.Id)
+	}
+	return nil
+}
+
+// Balance of a user not held for an ongoing ride. Users written before holds existed
+// have no held amount, which counts as zero in the balance's currency.
+func (u *User) availableBalance() Money {
+	if u.Held.Currency == "" {
+		u.Held = Money{0, u.Balance.Currency}
+	}
+	u.Available = Money{u.Balance.Amount - u.Held.Amount, u.Balance.Currency}
+	return u.Available
+}
+
+var holdPolicies = []string{HOLD_NONE, HOLD_DEPOSIT, HOLD_DAILY_CAP}
+
+// Amount to hold at the start of a ride priced with the given tariff. The hold doesn't
+// bound the fare: rides over a day, distance charges and zone fees may exceed it.
+func getRideHold(config *Config, tariff *Tariff) (Money, error) {
+	if config.HoldPolicy == HOLD_NONE {
+		return Money{0, tariff.UnlockFee.Currency}, nil
+	}
+	if config.HoldPolicy == HOLD_DAILY_CAP && tariff.DailyCap.Amount > 0 {
+		return tariff.UnlockFee.Add(tariff.DailyCap)
+	}
+	return config.HoldDeposit, nil
+}
+
+// Hold an amount of the available balance of a user for a ride. The caller writes both.
+func placeHold(user *User, ride *Ride, hold Money) error {
+	available := user.availableBalance()
+	if hold.Amount == 0 {
+		ride.Hold = Money{0, available.Currency}
+		return nil
+	}
+	if hold.Currency != available.Currency {
+		return newError(ERR_CURRENCY_MISMATCH, fmt.Sprintf("Currency mismatch: %s and %s.", available.Currency, hold.Currency))
+	}
+	if available.Amount < hold.Amount {
+		return newError(ERR_INSUFFICIENT_BALANCE, fmt.Sprintf("User %s has insufficient available balance %s for a hold of %s.", user.Id, available, hold)).withEntity(USER, user.Id)
+	}
+
+	held, err := user.Held.Add(hold)
+	if err != nil {
+		return err
+	}
+	user.Held = held
+	user.availableBalance()
+	ride.Hold = hold
+	return nil
+}
+
+// Release the amount held for a ride, which keeps recording what was held. The caller writes the user.
+func releaseHold(user *User, ride *Ride) error {
+	user.availableBalance()
+	if ride.Hold.Amount == 0 {
+		return nil
+	}
+
+	held, err := user.Held.Sub(ride.Hold)
+	if err != nil {
+		return err
+	}
+	user.Held = held
+	user.availableBalance()
+	return nil
+}
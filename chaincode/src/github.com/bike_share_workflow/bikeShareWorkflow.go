@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"os"
 	"strconv"
-	// "strings"
-	"time"
+	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -19,6 +17,7 @@ type BikeShareWorkflowChaincode struct {
 
 func (t *BikeShareWorkflowChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("BikeShareWorkflow Initialization")
+	logDevMode(t.devMode)
 	return shim.Success(nil)
 }
 
@@ -31,2059 +30,2759 @@ func (t *BikeShareWorkflowChaincode) Invoke(stub shim.ChaincodeStubInterface) pb
 	if !t.devMode {
 		creatorOrg, creatorCertIssuer, err = getTxCreatorInfo(stub)
 		if err != nil {
-			fmt.Errorf("Error extracting creator identity info: %s", err.Error())
-			return shim.Error(err.Error())
+			fmt.Printf("Error extracting creator identity info: %s\n", err.Error())
+			return errorResponse(err)
 		}
 		fmt.Printf("BikeShareWorkflow invoked by '%s', '%s'.\n", creatorOrg, creatorCertIssuer)
 	}
 
-	function, args := stub.GetFunctionAndParameters()
-	if function == "registerUser" {
-		// User registers a user
-		return t.registerUser(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "registerRepairer" {
-		// Repairer registers a repairer
-		return t.registerRepairer(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "registerBike" {
-		// Provider registers a bike
-		return t.registerBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "reactivateBike" {
-		// Provider reactivates a bike
-		return t.reactivateBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "discardBike" {
-		// Provider discards a bike
-		return t.discardBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "updateBikeLocation" {
-		// Provider updates the location of a bike
-		return t.updateBikeLocation(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "startRide" {
-		// User starts a ride
-		return t.startRide(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "endRide" {
-		// User ends a ride
-		return t.endRide(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "reportIssue" {
-		// User reports an issue
-		return t.reportIssue(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "acceptIssue" {
-		// Provider accepts an issue
-		return t.acceptIssue(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "rejectIssue" {
-		// Provider rejects an issue
-		return t.rejectIssue(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "requestRepair" {
-		// Provider requests a repair
-		return t.requestRepair(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "acceptRepair" {
-		// Repairer accepts a repair
-		return t.acceptRepair(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "rejectRepair" {
-		// Repairer rejects a repair
-		return t.rejectRepair(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "completeRepair" {
-		// Repairer completes a repair
-		return t.completeRepair(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getUsers" {
-		// Provider/User gets all users
-		return t.getUsers(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairers" {
-		// Provider/Repairer gets all repairers
-		return t.getRepairers(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getBikes" {
-		// Provider/User/Repairer gets all bikes
-		return t.getBikes(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getBikeById" {
-		// Provider/User/Repairer gets bike with specified ID
-		return t.getBikeById(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getBikesByStatus" {
-		// Provider/User/Repairer gets all bikes with specified status
-		return t.getBikesByStatus(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRides" {
-		// Provider/User gets all rides
-		return t.getRides(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRideById" {
-		// Provider/User gets ride with specified ID
-		return t.getRideById(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRidesByUser" {
-		// Provider/User gets all rides with specified user
-		return t.getRidesByUser(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRidesByBike" {
-		// Provider/User gets all rides with specified bike
-		return t.getRidesByBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRidesByStatus" {
-		// Provider/User gets all rides with specified status
-		return t.getRidesByStatus(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssues" {
-		// Provider/User gets all issues
-		return t.getIssues(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssueById" {
-		// Provider/User gets issue with specified ID
-		return t.getIssueById(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssuesByUser" {
-		// Provider/User gets all issues with specified user
-		return t.getIssuesByUser(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssuesByBike" {
-		// Provider/User gets all issues with specified bike
-		return t.getIssuesByBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssueByRide" {
-		// Provider/User gets issue with specified ride
-		return t.getIssueByRide(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getIssuesByStatus" {
-		// Provider/User gets all issues with specified status
-		return t.getIssuesByStatus(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairs" {
-		// Provider/Repairer gets all repairs
-		return t.getRepairs(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairById" {
-		// Provider/Repairer gets repair with specified ID
-		return t.getRepairById(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairsByBike" {
-		// Provider/Repairer gets all repairs with specified bike
-		return t.getRepairsByBike(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairsByRepairer" {
-		// Provider/Repairer gets all repairs with specified repairer
-		return t.getRepairsByRepairer(stub, creatorOrg, creatorCertIssuer, args)
-	} else if function == "getRepairsByStatus" {
-		// Provider/Repairer gets all repairs with specified status
-		return t.getRepairsByStatus(stub, creatorOrg, creatorCertIssuer, args)
-	} 
-
-	return shim.Error("Invalid invoke function name.")
+	function, rawArgs := stub.GetFunctionAndParameters()
+
+	spec, ok := findFunction(function)
+	if !ok {
+		return errorResponse(newError(ERR_UNKNOWN_FUNCTION, "Invalid invoke function name."))
+	}
+
+	// Access control: Check the caller against the ACL rule of the function
+	if !t.devMode {
+		err = checkAccess(stub, function, creatorOrg, creatorCertIssuer)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Check and parse the arguments against the schema of the function
+	args, err := parseArgs(spec.Args, rawArgs)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return spec.handler(t, newTransactionStub(stub), creatorOrg, creatorCertIssuer, args)
+}
+
+// Functions that can be invoked, in the order they are listed
+func getFunctionRegistry() []*FunctionSpec {
+	provider := []string{ROLE_PROVIDER}
+	user := []string{ROLE_USER}
+	repairer := []string{ROLE_REPAIRER}
+	providerUser := []string{ROLE_PROVIDER, ROLE_USER}
+	providerRepairer := []string{ROLE_PROVIDER, ROLE_REPAIRER}
+	all := []string{ROLE_PROVIDER, ROLE_USER, ROLE_REPAIRER}
+
+	return []*FunctionSpec{
+		{"registerUser", "Register a user", false, user, argList(required("USER_ID", ARG_STRING), required("BALANCE", ARG_MONEY)), (*BikeShareWorkflowChaincode).registerUser},
+		{"registerRepairer", "Register a repairer", false, repairer, argList(required("REPAIRER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).registerRepairer},
+		{"registerBike", "Register a bike", false, provider, argList(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).registerBike},
+		{"reactivateBike", "Reactivate a bike", false, provider, argList(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).reactivateBike},
+		{"discardBike", "Discard a bike", false, provider, argList(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).discardBike},
+		{"updateBikeLocation", "Update the location of a bike", false, provider, argList(required("BIKE_ID", ARG_STRING), between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90)), (*BikeShareWorkflowChaincode).updateBikeLocation},
+		{"reserveBike", "Reserve an available bike for a user", false, user, argList(required("USER_ID", ARG_STRING), required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).reserveBike},
+		{"cancelReservation", "Cancel the reservation of a bike", false, user, argList(required("USER_ID", ARG_STRING), required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).cancelReservation},
+		{"startRide", "Start a ride", false, user, argList(required("USER_ID", ARG_STRING), required("RIDE_ID", ARG_STRING), required("BIKE_ID", ARG_STRING), between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90), optional("DEVICE_TIME", ARG_TIMESTAMP), optional("STATION_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).startRide},
+		{"endRide", "End a ride", false, user, argList(required("USER_ID", ARG_STRING), required("RIDE_ID", ARG_STRING), between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90), optional("DEVICE_TIME", ARG_TIMESTAMP), optional("STATION_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).endRide},
+		{"appendRideTrack", "Append GPS samples to the track of an ongoing ride", false, user, argList(required("USER_ID", ARG_STRING), required("RIDE_ID", ARG_STRING), required("SAMPLES_JSON", ARG_JSON)), (*BikeShareWorkflowChaincode).appendRideTrack},
+		{"voidRide", "Void an ongoing ride without charging it", false, provider, argList(required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).voidRide},
+		{"reportIssue", "Report an issue", false, user, argList(required("USER_ID", ARG_STRING), required("ISSUE_ID", ARG_STRING), required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).reportIssue},
+		{"acceptIssue", "Accept an issue", false, provider, argList(required("ISSUE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).acceptIssue},
+		{"rejectIssue", "Reject an issue", false, provider, argList(required("ISSUE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).rejectIssue},
+		{"requestRepair", "Request a repair", false, provider, argList(required("REPAIR_ID", ARG_STRING), required("BIKE_ID", ARG_STRING), required("REPAIRER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).requestRepair},
+		{"acceptRepair", "Accept a repair", false, repairer, argList(required("REPAIRER_ID", ARG_STRING), required("REPAIR_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).acceptRepair},
+		{"rejectRepair", "Reject a repair", false, repairer, argList(required("REPAIRER_ID", ARG_STRING), required("REPAIR_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).rejectRepair},
+		{"completeRepair", "Complete a repair", false, repairer, argList(required("REPAIRER_ID", ARG_STRING), required("REPAIR_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).completeRepair},
+		{"registerStation", "Register a docking station", false, provider, argList(required("STATION_ID", ARG_STRING), between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90), required("CAPACITY", ARG_INT)), (*BikeShareWorkflowChaincode).registerStation},
+		{"resizeStation", "Change the number of dock slots of a station", false, provider, argList(required("STATION_ID", ARG_STRING), required("CAPACITY", ARG_INT)), (*BikeShareWorkflowChaincode).resizeStation},
+		{"retireStation", "Retire an empty station", false, provider, argList(required("STATION_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).retireStation},
+		{"defineZone", "Define a service area, no-parking or preferred parking zone", false, provider, argList(required("ZONE_ID", ARG_STRING), oneOf("ZONE_TYPE", zoneTypes...), required("POLYGON_JSON", ARG_JSON), required("FEE", ARG_MONEY)), (*BikeShareWorkflowChaincode).defineZone},
+		{"removeZone", "Remove a zone", false, provider, argList(required("ZONE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).removeZone},
+		{"topUpBalance", "Add funds to the balance of a user", false, user, argList(required("USER_ID", ARG_STRING), required("AMOUNT", ARG_MONEY)), (*BikeShareWorkflowChaincode).topUpBalance},
+		{"withdrawBalance", "Withdraw funds from the balance of a user", false, user, argList(required("USER_ID", ARG_STRING), required("AMOUNT", ARG_MONEY)), (*BikeShareWorkflowChaincode).withdrawBalance},
+		{"transferBalance", "Transfer funds between the balances of two users", false, user, argList(required("FROM_USER_ID", ARG_STRING), required("TO_USER_ID", ARG_STRING), required("AMOUNT", ARG_MONEY)), (*BikeShareWorkflowChaincode).transferBalance},
+		{"setTariff", "Set a new tariff", false, provider, argList(required("UNLOCK_FEE", ARG_MONEY), required("PER_MINUTE_RATE", ARG_MONEY), required("FREE_MINUTES", ARG_INT), required("DAILY_CAP", ARG_MONEY), oneOf("ROUNDING", roundingRules...), optional("PER_KM_RATE", ARG_MONEY)), (*BikeShareWorkflowChaincode).setTariff},
+		{"setConfig", "Change a configuration setting", false, provider, argList(oneOf("SETTING", CONFIG_MAX_CLOCK_SKEW, CONFIG_RICH_QUERIES, CONFIG_HOLD_POLICY, CONFIG_HOLD_DEPOSIT, CONFIG_RESERVATION_MINUTES, CONFIG_NO_SHOW_FEE, CONFIG_NO_SHOW_ALLOWANCE), required("VALUE", ARG_STRING)), (*BikeShareWorkflowChaincode).setConfig},
+		{"rebuildIndexes", "Write the secondary index entries of existing records", false, provider, argList(optionalOneOf("DOC_TYPE", indexedObjectTypes...)), (*BikeShareWorkflowChaincode).rebuildIndexes},
+		{"setAccessControlList", "Replace the ACL", false, provider, argList(required("ACL_JSON", ARG_JSON)), (*BikeShareWorkflowChaincode).setAccessControlList},
+		{"getUsers", "Get all users", true, provider, pageArgs(), (*BikeShareWorkflowChaincode).getUsers},
+		{"getRepairers", "Get all repairers", true, providerRepairer, pageArgs(), (*BikeShareWorkflowChaincode).getRepairers},
+		{"getBikes", "Get all bikes", true, all, pageArgs(), (*BikeShareWorkflowChaincode).getBikes},
+		{"getBikeById", "Get bike with specified ID", true, all, argList(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getBikeById},
+		{"getBikesByStatus", "Get all bikes with specified status", true, all, pageArgs(oneOf("STATUS", getStates(BIKE)...)), (*BikeShareWorkflowChaincode).getBikesByStatus},
+		{"getBikesAtStation", "Get all bikes docked at specified station", true, all, pageArgs(required("STATION_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getBikesAtStation},
+		{"getBikesNear", "Get the available bikes within a radius of a location, nearest first", true, all, argList(between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90), required("RADIUS_METERS", ARG_FLOAT), optional("LIMIT", ARG_INT)), (*BikeShareWorkflowChaincode).getBikesNear},
+		{"getStationsWithFreeDocks", "Get all stations with a free dock", true, all, pageArgs(), (*BikeShareWorkflowChaincode).getStationsWithFreeDocks},
+		{"getZones", "Get all zones", true, all, pageArgs(), (*BikeShareWorkflowChaincode).getZones},
+		{"checkLocation", "Get the zones containing a location and the fee of ending a ride there", true, all, argList(between("LONGITUDE", -180, 180), between("LATITUDE", -90, 90)), (*BikeShareWorkflowChaincode).checkLocation},
+		{"getRides", "Get all rides", true, provider, pageArgs(), (*BikeShareWorkflowChaincode).getRides},
+		{"getRideById", "Get ride with specified ID", true, providerUser, argList(required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRideById},
+		{"getRideTrack", "Get the GPS track of a ride and verify it against its Merkle root", true, providerUser, argList(required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRideTrack},
+		{"getRidesByUser", "Get all rides with specified user", true, providerUser, pageArgs(required("USER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRidesByUser},
+		{"getRidesByBike", "Get all rides with specified bike", true, provider, pageArgs(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRidesByBike},
+		{"getRidesByStatus", "Get all rides with specified status", true, provider, pageArgs(oneOf("STATUS", getStates(RIDE)...)), (*BikeShareWorkflowChaincode).getRidesByStatus},
+		{"getIssues", "Get all issues", true, provider, pageArgs(), (*BikeShareWorkflowChaincode).getIssues},
+		{"getIssueById", "Get issue with specified ID", true, providerUser, argList(required("ISSUE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getIssueById},
+		{"getIssuesByUser", "Get all issues with specified user", true, providerUser, pageArgs(required("USER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getIssuesByUser},
+		{"getIssuesByBike", "Get all issues with specified bike", true, provider, pageArgs(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getIssuesByBike},
+		{"getIssueByRide", "Get issue with specified ride", true, providerUser, argList(required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getIssueByRide},
+		{"getIssuesByStatus", "Get all issues with specified status", true, provider, pageArgs(oneOf("STATUS", getStates(ISSUE)...)), (*BikeShareWorkflowChaincode).getIssuesByStatus},
+		{"getRepairs", "Get all repairs", true, providerRepairer, pageArgs(), (*BikeShareWorkflowChaincode).getRepairs},
+		{"getRepairById", "Get repair with specified ID", true, providerRepairer, argList(required("REPAIR_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRepairById},
+		{"getRepairsByBike", "Get all repairs with specified bike", true, providerRepairer, pageArgs(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRepairsByBike},
+		{"getRepairsByRepairer", "Get all repairs with specified repairer", true, providerRepairer, pageArgs(required("REPAIRER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRepairsByRepairer},
+		{"getRepairsByStatus", "Get all repairs with specified status", true, providerRepairer, pageArgs(oneOf("STATUS", getStates(REPAIR)...)), (*BikeShareWorkflowChaincode).getRepairsByStatus},
+		{"getBalanceStatement", "Get the balance entries of a user, oldest first", true, providerUser, pageArgs(required("USER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getBalanceStatement},
+		{"getUserHistory", "Get the history of a user", true, providerUser, historyArgs(required("USER_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getUserHistory},
+		{"getBikeHistory", "Get the history of a bike", true, all, historyArgs(required("BIKE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getBikeHistory},
+		{"getRideHistory", "Get the history of a ride", true, providerUser, historyArgs(required("RIDE_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRideHistory},
+		{"getRepairHistory", "Get the history of a repair", true, providerRepairer, historyArgs(required("REPAIR_ID", ARG_STRING)), (*BikeShareWorkflowChaincode).getRepairHistory},
+		{"getTariff", "Get the current tariff or the tariff with specified version", true, providerUser, argList(optional("VERSION", ARG_INT)), (*BikeShareWorkflowChaincode).getTariff},
+		{"quoteRide", "Get the price breakdown of a ride with specified duration and distance", true, providerUser, argList(required("DURATION_MINUTES", ARG_FLOAT), optional("DISTANCE_METERS", ARG_FLOAT)), (*BikeShareWorkflowChaincode).quoteRide},
+		{"getConfig", "Get the configuration", true, all, argList(), (*BikeShareWorkflowChaincode).getConfig},
+		{"getAccessControlList", "Get the ACL", true, all, argList(), (*BikeShareWorkflowChaincode).getAccessControlList},
+		{"getChaincodeInfo", "Get the chaincode version and access control status", true, all, argList(), (*BikeShareWorkflowChaincode).getChaincodeInfo},
+		{"listFunctions", "List the invocable functions with their roles and arguments", true, all, argList(), (*BikeShareWorkflowChaincode).listFunctions},
+		{"getStateMachine", "Get the statuses and transitions of an object type", true, all, argList(oneOf("OBJECT_TYPE", USER, BIKE, RIDE, ISSUE, REPAIR, STATION, ZONE)), (*BikeShareWorkflowChaincode).getStateMachine},
+	}
 }
 
 // Register a user
-func (t *BikeShareWorkflowChaincode) registerUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+func (t *BikeShareWorkflowChaincode) registerUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a User Org member can invoke this transaction
-	if !t.devMode && !authenticateUserOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of User Org. Access denied.")
+	// Bind the user to the caller's identity
+	owner := ""
+	if !t.devMode {
+		owner, err = getRegistrantOwner(stub, args.String("USER_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	if len(args) != 2 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {User ID, Balance}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if user ID is new
+	err = users(stub).MustNotExist(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get user state from the ledger
-	userKey, err := getUserKey(stub, args[0])
+	// Create user object, recording the initial balance in its statement
+	balance := args.Money("BALANCE")
+	err = checkLedgerCurrency(args, "BALANCE", balance)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	userBytes, err := stub.GetState(userKey)
+	zero := Money{0, balance.Currency}
+	user := &User{USER, args.String("USER_ID"), owner, zero, zero, zero, 0, "", "", 0, USER_FREE, Audit{}}
+	event := newEvent(stub, EVENT_USER_REGISTERED, user.Id).
+		addChange(USER, user.Id, "", USER_FREE)
+	err = postBalanceEntry(stub, user, &BalanceEntry{Amount: balance, Reason: REASON_REGISTRATION}, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(userBytes) != 0 {
-		err = errors.New(fmt.Sprintf("User %s already registered.", args[0]))
-		return shim.Error(err.Error())
+
+	// Write the state to the ledger
+	err = users(stub).Create(user)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Parse balance
-	balance, err := strconv.ParseFloat(string(args[1]), 2)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("User %s registered.\n", user.Id)
+
+	return shim.Success(nil)
+}
 
-	// Create user object
-	user := &User{USER, args[0], float32(balance), "", USER_FREE}
-	userBytes, err = json.Marshal(user)
+// Register a repairer
+func (t *BikeShareWorkflowChaincode) registerRepairer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	// Bind the repairer to the caller's identity
+	owner := ""
+	if !t.devMode {
+		owner, err = getRegistrantOwner(stub, args.String("REPAIRER_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Create repairer object and write it to the ledger
+	repairer := &Repairer{REPAIRER, args.String("REPAIRER_ID"), owner, Audit{}}
+	err = repairers(stub).Create(repairer)
 	if err != nil {
-		return shim.Error("Error marshaling user structure.")
+		return errorResponse(err)
 	}
 
-	// Write the state to the ledger
-	err = stub.PutState(userKey, userBytes)
+	// Emit the event
+	event := newEvent(stub, EVENT_REPAIRER_REGISTERED, repairer.Id).
+		addChange(REPAIRER, repairer.Id, "", "")
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("User %s registered.\n", args[0])
+	fmt.Printf("Repairer %s registered.\n", repairer.Id)
 
 	return shim.Success(nil)
 }
 
-// Register a repairer
-func (t *BikeShareWorkflowChaincode) registerRepairer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Register a bike
+func (t *BikeShareWorkflowChaincode) registerBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Repairer Org member can invoke this transaction
-	if !t.devMode && !authenticateRepairerOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Repairer Org. Access denied.")
+	// Create bike object and write it to the ledger
+	bike := &Bike{BIKE, args.String("BIKE_ID"), []float32{}, "", "", "", "", 0, BIKE_AVAILABLE, Audit{}}
+	err = bikes(stub).Create(bike)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Repairer ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Emit the event
+	event := newEvent(stub, EVENT_BIKE_REGISTERED, "").
+		addChange(BIKE, bike.Id, "", BIKE_AVAILABLE)
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
 	}
+	fmt.Printf("Bike %s registered.\n", bike.Id)
 
-	// Get repairer state from the ledger
-	repairerKey, err := getRepairerKey(stub, args[0])
+	return shim.Success(nil)
+}
+
+// Reactivate a bike
+func (t *BikeShareWorkflowChaincode) reactivateBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	repairerBytes, err := stub.GetState(repairerKey)
+
+	// Reactivate the bike, cancelling the repairs requested for it
+	event := newEvent(stub, EVENT_BIKE_REACTIVATED, "")
+	err = fire(stub, bike, "reactivateBike", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(repairerBytes) != 0 {
-		err = errors.New(fmt.Sprintf("Repairer %s already registered.", args[0]))
-		return shim.Error(err.Error())
+
+	// Write the state to the ledger
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Create user object
-	repairer := &Repairer{REPAIRER, args[0]}
-	repairerBytes, err = json.Marshal(repairer)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error("Error marshaling repairer structure.")
+		return errorResponse(err)
+	}
+	fmt.Printf("Bike %s reactivated.\n", bike.Id)
+
+	return shim.Success(nil)
+}
+
+// Discard a bike
+func (t *BikeShareWorkflowChaincode) discardBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Release the bike if its reservation expired
+	event := newEvent(stub, EVENT_BIKE_DISCARDED, "")
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	_, err = expireReservation(stub, bike, nil, now, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if bike is available
+	err = fire(stub, bike, "discardBike", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// A discarded bike leaves its dock
+	if bike.StationId != "" {
+		station, err := stations(stub).MustGet(bike.StationId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = undockBike(station, bike)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = stations(stub).Update(station)
+		if err != nil {
+			return errorResponse(err)
+		}
+		event.addChange(STATION, station.Id, station.Status, station.Status)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(repairerKey, repairerBytes)
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Repairer %s registered.\n", args[0])
+	fmt.Printf("Bike %s discarded.\n", bike.Id)
 
 	return shim.Success(nil)
 }
 
-// Register a bike
-func (t *BikeShareWorkflowChaincode) registerBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
+// Update the location of a bike
+func (t *BikeShareWorkflowChaincode) updateBikeLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+	// Verify if bike is not discarded
+	if bike.Status == BIKE_DISCARDED {
+		err = newError(ERR_BIKE_DISCARDED, fmt.Sprintf("Bike %s already discarded.", bike.Id)).withEntity(BIKE, bike.Id)
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// A bike moved elsewhere leaves its dock
+	event := newEvent(stub, EVENT_BIKE_LOCATION_UPDATED, "").
+		addChange(BIKE, bike.Id, bike.Status, bike.Status)
+	if bike.StationId != "" {
+		station, err := stations(stub).MustGet(bike.StationId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = undockBike(station, bike)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = stations(stub).Update(station)
+		if err != nil {
+			return errorResponse(err)
+		}
+		event.addChange(STATION, station.Id, station.Status, station.Status)
+	}
+
+	// Write the state to the ledger
+	setBikeLocation(bike, []float32{float32(args.Float("LONGITUDE")), float32(args.Float("LATITUDE"))})
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("The location of bike %s updated.\n", bike.Id)
+
+	return shim.Success(nil)
+}
+
+// Reserve an available bike for a user
+func (t *BikeShareWorkflowChaincode) reserveBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Reservations run from the transaction time
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Verify if user is free and has positive available balance
+	event := newEvent(stub, EVENT_BIKE_RESERVED, user.Id)
+	err = fire(stub, user, "reserveBike", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[0])
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+
+	// Verify if user holds no other reservation, after releasing the bikes of expired reservations
+	reserved, err := getUserReservation(stub, user, bike, now, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+	if reserved != nil {
+		err = newError(ERR_USER_HAS_RESERVATION, fmt.Sprintf("User %s already holds a reservation of bike %s.", user.Id, reserved.Id)).withEntity(USER, user.Id)
+		return errorResponse(err)
 	}
-	if len(bikeBytes) != 0 {
-		err = errors.New(fmt.Sprintf("Bike %s already registered.", args[0]))
-		return shim.Error(err.Error())
+	_, err = expireReservation(stub, bike, user, now, event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Create bike object
-	bike := &Bike{BIKE, args[0], []float32{}, BIKE_AVAILABLE}
-	bikeBytes, err = json.Marshal(bike)
+	// Verify if bike is available, and reserve it
+	err = checkReservedFor(bike, user)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = reserve(stub, bike, user, now, event)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(bikeKey, bikeBytes)
+	err = users(stub).Update(user)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Bike %s registered.\n", args[0])
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Bike %s reserved by user %s until %s.\n", bike.Id, user.Id, bike.ReservedUntil)
 
 	return shim.Success(nil)
 }
 
-// Reactivate a bike
-func (t *BikeShareWorkflowChaincode) reactivateBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var bike *Bike
+// Cancel the reservation of a bike
+func (t *BikeShareWorkflowChaincode) cancelReservation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	now, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
 	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[0])
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if the reservation is the user's and still running
+	event := newEvent(stub, EVENT_RESERVATION_CANCELLED, user.Id)
+	err = checkReservedFor(bike, user)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+	expired, err := reservationExpired(bike, now)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+	if expired {
+		err = newError(ERR_BIKE_NOT_RESERVED, fmt.Sprintf("Reservation of bike %s expired.", bike.Id)).withEntity(BIKE, bike.Id)
+		return errorResponse(err)
 	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", args[0]))
-		return shim.Error(err.Error())
+	err = fire(stub, bike, "cancelReservation", event)
+	if err != nil {
+		return errorResponse(err)
 	}
+	clearReservation(bike, user)
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	// Write the state to the ledger
+	err = users(stub).Update(user)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = bikes(stub).Update(bike)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if bike can be reactivated
-	if bike.Status == BIKE_DISCARDED {
-		err = errors.New(fmt.Sprintf("Bike %s discarded.", args[0]))
-		return shim.Error(err.Error())
-	} else if bike.Status == BIKE_REPAIRING {
-		err = errors.New(fmt.Sprintf("Bike %s repairing.", args[0]))
-		return shim.Error(err.Error())
-	} else if bike.Status != BIKE_TO_REPAIR && bike.Status != BIKE_REPAIRED {
-		err = errors.New(fmt.Sprintf("Bike %s active.", args[0]))
-		return shim.Error(err.Error())
+	// Emit the event
+	event.addChange(USER, user.Id, user.Status, user.Status)
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Reservation of bike %s cancelled.\n", bike.Id)
+
+	return shim.Success(nil)
+}
+
+// Start a ride
+func (t *BikeShareWorkflowChaincode) startRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Take the start time from the transaction, not from the caller
+	startTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if args.Has("DEVICE_TIME") {
+		config, err := getConfig(stub)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = checkDeviceTime(startTime, args.Time("DEVICE_TIME"), config.MaxClockSkew)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Verify if user is free and has positive available balance
+	event := newEvent(stub, EVENT_RIDE_STARTED, user.Id)
+	err = fire(stub, user, "startRide", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if ride ID is new
+	err = rides(stub).MustNotExist(args.String("RIDE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Release the bikes of expired reservations, and verify if the user holds no reservation of
+	// another bike and the bike is not reserved for another user
+	reserved, err := getUserReservation(stub, user, bike, startTime, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if reserved != nil && reserved.Id != bike.Id {
+		err = newError(ERR_USER_HAS_RESERVATION, fmt.Sprintf("User %s holds a reservation of bike %s.", user.Id, reserved.Id)).withEntity(USER, user.Id)
+		return errorResponse(err)
+	}
+	_, err = expireReservation(stub, bike, user, startTime, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = checkReservedFor(bike, user)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	bike.Status = BIKE_AVAILABLE
-	bikeBytes, err = json.Marshal(bike)
+	// Verify if bike is available or reserved for the user, whose reservation ends with the ride
+	err = fire(stub, bike, "startRide", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if reserved != nil {
+		clearReservation(bike, user)
+		user.NoShowCount = 0
+	}
+
+	// Verify if bike is docked at the given station, and take it out of its dock
+	if args.Has("STATION_ID") && args.String("STATION_ID") != bike.StationId {
+		err = newError(ERR_BIKE_NOT_AT_STATION, fmt.Sprintf("Bike %s not docked at station %s.", bike.Id, args.String("STATION_ID"))).withEntity(BIKE, bike.Id)
+		return errorResponse(err)
+	}
+	var station *Station
+	if bike.StationId != "" {
+		station, err = stations(stub).MustGet(bike.StationId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = undockBike(station, bike)
+		if err != nil {
+			return errorResponse(err)
+		}
+		event.addChange(STATION, station.Id, station.Status, station.Status)
+	}
+
+	// Lock in the tariff in force when the ride starts
+	tariff, err := getCurrentTariff(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Create ride object
+	location := []float32{float32(args.Float("LONGITUDE")), float32(args.Float("LATITUDE"))}
+	ride := &Ride{RIDE, args.String("RIDE_ID"), user.Id, bike.Id, formatTimestamp(startTime), location, "", "", []float32{}, "", "", newMoney(0), newMoney(0), newMoney(0), 0, 0, 0, "", "", []string{}, tariff.Version, RIDE_ONGOING, Audit{}}
+	if station != nil {
+		ride.StartStationId = station.Id
+	}
+
+	// Hold part of the balance until the ride is settled
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	hold, err := getRideHold(config, tariff)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = placeHold(user, ride, hold)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
-	
+
+	user.RideId = ride.Id
+	setBikeLocation(bike, location)
+
 	// Write the state to the ledger
-	err = stub.PutState(bikeKey, bikeBytes)
+	err = rides(stub).Create(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = users(stub).Update(user)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if station != nil {
+		err = stations(stub).Update(station)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Emit the event
+	event.addChange(RIDE, ride.Id, "", RIDE_ONGOING)
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Bike %s reactivated.\n", args[0])
+	fmt.Printf("Ride %s started.\n", ride.Id)
 
 	return shim.Success(nil)
 }
 
-// Discard a bike
-func (t *BikeShareWorkflowChaincode) discardBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var bike *Bike
+// End a ride
+func (t *BikeShareWorkflowChaincode) endRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Take the end time from the transaction, not from the caller
+	endTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if args.Has("DEVICE_TIME") {
+		config, err := getConfig(stub)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = checkDeviceTime(endTime, args.Time("DEVICE_TIME"), config.MaxClockSkew)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
 
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Verify if user is in a ride
+	event := newEvent(stub, EVENT_RIDE_ENDED, user.Id)
+	err = fire(stub, user, "endRide", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get ride state from the ledger
+	ride, err := rides(stub).MustGet(args.String("RIDE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if ride ID matches
+	if user.RideId != ride.Id {
+		err = newError(ERR_RIDE_MISMATCH, fmt.Sprintf("Actual ride %s and requested ride %s not match.", user.RideId, ride.Id)).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
+	}
+
+	// Verify if ride is ongoing
+	err = fire(stub, ride, "endRide", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[0])
+	bike, err := bikes(stub).MustGet(ride.BikeId)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+
+	// Verify if bike is in use
+	err = fire(stub, bike, "endRide", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Parse start time and verify that the ride doesn't end before it starts
+	startTime, err := parseTimestamp(ride.StartTime)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", args[0]))
-		return shim.Error(err.Error())
+	if endTime.Before(startTime) {
+		err = newError(ERR_END_BEFORE_START, fmt.Sprintf("End time %s of ride %s before start time %s.", formatTimestamp(endTime), ride.Id, formatTimestamp(startTime))).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
 	}
+	duration := endTime.Sub(startTime).Minutes()
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	// Measure the distance from the start location along the track to the end location
+	location := []float32{float32(args.Float("LONGITUDE")), float32(args.Float("LATITUDE"))}
+	points, err := getTrackPoints(stub, ride.Id)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	distance := getTrackDistance(ride.StartLocation, points, location)
 
-	// Verify if bike is available
-	if bike.Status != BIKE_AVAILABLE {
-		err = errors.New(fmt.Sprintf("Bike %s not available.", args[0]))
-		return shim.Error(err.Error())
+	// Price the ride with the tariff recorded at its start
+	tariff, err := getTariffByVersion(stub, ride.TariffVersion)
+	if err != nil {
+		return errorResponse(err)
+	}
+	quote, err := computeFare(tariff, duration, distance)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	bike.Status = BIKE_DISCARDED
-	bikeBytes, err = json.Marshal(bike)
+	// Apply the fee of the zones the ride ends in, at the location recorded
+	zoneCheck, err := checkLocation(stub, float64(location[0]), float64(location[1]))
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
+	}
+	cost, err := applyZoneFee(quote.Total, zoneCheck.Fee)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	ride.EndTime = formatTimestamp(endTime)
+	ride.EndLocation = location
+	ride.EndZoneId = zoneCheck.ZoneId
+	ride.ZoneFee = zoneCheck.Fee
+	ride.Cost = cost
+	ride.DistanceMeters = distance
+
+	setBikeLocation(bike, location)
+	bike.OdometerMeters += distance
+
+	// Dock the bike at the given station
+	var station *Station
+	if args.Has("STATION_ID") {
+		station, err = stations(stub).MustGet(args.String("STATION_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = dockBike(station, bike)
+		if err != nil {
+			return errorResponse(err)
+		}
+		ride.EndStationId = station.Id
+		event.addChange(STATION, station.Id, station.Status, station.Status)
+	}
+
+	// Release the hold and charge the fare in full, even where it exceeds the hold and
+	// leaves the balance negative, since the bike is back and the ride must end
+	err = releaseHold(user, ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = postBalanceEntry(stub, user, &BalanceEntry{Amount: cost.Neg(), Reason: REASON_RIDE_CHARGE, RideId: ride.Id}, event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(bikeKey, bikeBytes)
+	err = rides(stub).Update(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = users(stub).Update(user)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if station != nil {
+		err = stations(stub).Update(station)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Bike %s discarded.\n", args[0])
-	
+	fmt.Printf("Ride %s ended.\n", ride.Id)
+
 	return shim.Success(nil)
 }
 
-// Update the location of a bike
-func (t *BikeShareWorkflowChaincode) updateBikeLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var bike *Bike
+// Append GPS samples to the track of an ongoing ride
+func (t *BikeShareWorkflowChaincode) appendRideTrack(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Samples may not be later than the transaction time
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
 
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID, Longitude, Latitude}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[0])
+	// Get ride state from the ledger
+	ride, err := rides(stub).MustGet(args.String("RIDE_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+
+	// Verify if ride belongs to the user and is ongoing
+	if ride.UserId != user.Id {
+		err = newError(ERR_USER_MISMATCH, fmt.Sprintf("Actual user %s and requested user %s not match.", ride.UserId, user.Id)).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+	if ride.Status != RIDE_ONGOING {
+		err = newError(ERR_RIDE_NOT_ONGOING, fmt.Sprintf("Ride %s not ongoing.", ride.Id)).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
+	}
+
+	// Verify if the samples follow the track so far
+	config, err := getConfig(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", args[0]))
-		return shim.Error(err.Error())
+	points, err := parseTrackSamples(args.String("SAMPLES_JSON"), ride, txTime, config.MaxClockSkew)
+	if err != nil {
+		return errorResponse(badArgument(args, "SAMPLES_JSON", err.Error()))
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	// Write the state to the ledger
+	segment, err := appendTrackSegment(stub, ride, points)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
+	}
+	err = rides(stub).Update(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+	segmentBytes, err := json.Marshal(segment)
+	if err != nil {
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling track segment structure."))
 	}
 
-	// Verify if bike is not discarded
-	if bike.Status == BIKE_DISCARDED {
-		err = errors.New(fmt.Sprintf("Bike %s already discarded.", args[0]))
-		return shim.Error(err.Error())
+	// Emit the event
+	event := newEvent(stub, EVENT_RIDE_TRACK_APPENDED, user.Id).
+		addChange(RIDE, ride.Id, ride.Status, ride.Status).
+		addChange(TRACK_SEGMENT, segment.Id, "", "")
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("%d samples appended to the track of ride %s.\n", segment.SampleCount, ride.Id)
+
+	return shim.Success(segmentBytes)
+}
+
+// Void an ongoing ride without charging it
+func (t *BikeShareWorkflowChaincode) voidRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Take the end time from the transaction
+	endTime, err := getTxTime(stub)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get ride state from the ledger
+	ride, err := rides(stub).MustGet(args.String("RIDE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if ride is ongoing
+	event := newEvent(stub, EVENT_RIDE_VOIDED, "")
+	err = fire(stub, ride, "voidRide", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(ride.UserId)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if user is in the ride
+	if user.RideId != ride.Id {
+		err = newError(ERR_RIDE_MISMATCH, fmt.Sprintf("Actual ride %s and requested ride %s not match.", user.RideId, ride.Id)).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
+	}
+	err = fire(stub, user, "voidRide", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Parse longitude and latitude
-	longitude, err := strconv.ParseFloat(string(args[1]), 8)
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(ride.BikeId)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	latitude, err := strconv.ParseFloat(string(args[2]), 8)
+
+	// Verify if bike is in use
+	err = fire(stub, bike, "voidRide", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	bike.Location = []float32{float32(longitude), float32(latitude)}
-	bikeBytes, err = json.Marshal(bike)
+	// Release the hold without charging a fare
+	ride.EndTime = formatTimestamp(endTime)
+	err = releaseHold(user, ride)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(bikeKey, bikeBytes)
+	err = rides(stub).Update(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = users(stub).Update(user)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("The location of bike %s updated.\n", args[0])
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Ride %s voided.\n", ride.Id)
 
 	return shim.Success(nil)
 }
 
-// Start a ride
-func (t *BikeShareWorkflowChaincode) startRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var user *User
-	var bike *Bike
+// Report an issue
+func (t *BikeShareWorkflowChaincode) reportIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
+	}
+
+	// Verify if issue ID is new
+	err = issues(stub).MustNotExist(args.String("ISSUE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Get ride state from the ledger
+	ride, err := rides(stub).MustGet(args.String("RIDE_ID"))
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Verify if user matches
+	if ride.UserId != user.Id {
+		err = newError(ERR_USER_MISMATCH, fmt.Sprintf("Actual user %s and requested user %s not match.", ride.UserId, user.Id)).withEntity(RIDE, ride.Id)
+		return errorResponse(err)
+	}
+
+	// Verify if ride is completed
+	event := newEvent(stub, EVENT_ISSUE_REPORTED, user.Id)
+	err = fire(stub, ride, "reportIssue", event)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Create issue object
+	issue := &Issue{ISSUE, args.String("ISSUE_ID"), user.Id, ride.BikeId, ride.Id, ISSUE_OPEN, Audit{}}
+
+	// Write the state to the ledger
+	err = issues(stub).Create(issue)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = rides(stub).Update(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	event.addChange(ISSUE, issue.Id, "", ISSUE_OPEN)
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Issue %s opened.\n", issue.Id)
+
+	return shim.Success(nil)
+}
 
-	// Access control: Only a User Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of User Org. Access denied.")
+// Accept an issue
+func (t *BikeShareWorkflowChaincode) acceptIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get issue state from the ledger
+	issue, err := issues(stub).MustGet(args.String("ISSUE_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 6 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 6: {User ID, Ride ID, Bike ID, Time, Longitude, Latitude}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if issue is open
+	event := newEvent(stub, EVENT_ISSUE_ACCEPTED, "")
+	err = fire(stub, issue, "acceptIssue", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// Get user state from the ledger
-	userKey, err := getUserKey(stub, args[0])
+	user, err := users(stub).MustGet(issue.UserId)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	userBytes, err := stub.GetState(userKey)
+
+	// Get ride state from the ledger
+	ride, err := rides(stub).MustGet(issue.RideId)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(userBytes) == 0 {
-		err = errors.New(fmt.Sprintf("User %s not found.", args[0]))
-		return shim.Error(err.Error())
+
+	// Verify if ride has an open issue
+	err = fire(stub, ride, "acceptIssue", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(userBytes, &user)
+	err = postBalanceEntry(stub, user, &BalanceEntry{Amount: ride.Cost, Reason: REASON_ISSUE_REFUND, RideId: ride.Id, IssueId: issue.Id}, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if user is free
-	if user.Status != USER_FREE {
-		err = errors.New(fmt.Sprintf("User %s has another ongoing ride.", args[0]))
-		return shim.Error(err.Error())
+	ride.Cost = newMoney(0)
+
+	// Write the state to the ledger
+	err = issues(stub).Update(issue)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = users(stub).Update(user)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = rides(stub).Update(ride)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// Emit the event
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Issue %s accepted.\n", issue.Id)
+
+	return shim.Success(nil)
+}
+
+// Reject an issue
+func (t *BikeShareWorkflowChaincode) rejectIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get issue state from the ledger
+	issue, err := issues(stub).MustGet(args.String("ISSUE_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Verify if user has positive balance
-	if user.Balance <= 0 {
-		err = errors.New(fmt.Sprintf("User %s has negative balance.", args[0]))
-		return shim.Error(err.Error())
+	// Verify if issue is open
+	event := newEvent(stub, EVENT_ISSUE_REJECTED, "")
+	err = fire(stub, issue, "rejectIssue", event)
+	if err != nil {
+		return errorResponse(err)
 	}
 
 	// Get ride state from the ledger
-	rideKey, err := getRideKey(stub, args[1])
+	ride, err := rides(stub).MustGet(issue.RideId)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	rideBytes, err := stub.GetState(rideKey)
+
+	// Verify if ride has an open issue
+	err = fire(stub, ride, "rejectIssue", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(rideBytes) != 0 {
-		err = errors.New(fmt.Sprintf("Ride %s already started.", args[1]))
-		return shim.Error(err.Error())
-	}
-
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[2])
+	// Write the state to the ledger
+	err = issues(stub).Update(issue)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+	err = rides(stub).Update(ride)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", args[2]))
-		return shim.Error(err.Error())
+
+	// Emit the event
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
 	}
+	fmt.Printf("Issue %s rejected.\n", issue.Id)
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	return shim.Success(nil)
+}
+
+// Request to repair a bike
+func (t *BikeShareWorkflowChaincode) requestRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Verify if repair ID is new
+	err := repairs(stub).MustNotExist(args.String("REPAIR_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if bike is available
-	if bike.Status != BIKE_AVAILABLE {
-		err = errors.New(fmt.Sprintf("Bike %s not available.", args[2]))
-		return shim.Error(err.Error())
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Parse longitude and latitude
-	longitude, err := strconv.ParseFloat(string(args[4]), 8)
+	// Release the bike if its reservation expired
+	event := newEvent(stub, EVENT_REPAIR_REQUESTED, "")
+	now, err := getTxTime(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	latitude, err := strconv.ParseFloat(string(args[5]), 8)
+	_, err = expireReservation(stub, bike, nil, now, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Create ride object
-	ride := &Ride{RIDE, args[1], args[0], args[2], args[3], []float32{float32(longitude), float32(latitude)}, "", []float32{}, 0, RIDE_ONGOING}
-	rideBytes, err = json.Marshal(ride)
+	// Verify if bike is available
+	err = fire(stub, bike, "requestRepair", event)
 	if err != nil {
-		return shim.Error("Error marshaling ride structure.")
+		return errorResponse(err)
 	}
-	
-	user.RideId = args[1]
-	user.Status = USER_IN_RIDE
-	userBytes, err = json.Marshal(user)
-	if err != nil {
-		return shim.Error("Error marshaling user structure.")
+
+	// A bike taken for repair leaves its dock
+	if bike.StationId != "" {
+		station, err := stations(stub).MustGet(bike.StationId)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = undockBike(station, bike)
+		if err != nil {
+			return errorResponse(err)
+		}
+		err = stations(stub).Update(station)
+		if err != nil {
+			return errorResponse(err)
+		}
+		event.addChange(STATION, station.Id, station.Status, station.Status)
 	}
 
-	bike.Location = []float32{float32(longitude), float32(latitude)}
-	bike.Status = BIKE_IN_USE
-	bikeBytes, err = json.Marshal(bike)
+	// Get repairer state from the ledger
+	repairer, err := repairers(stub).MustGet(args.String("REPAIRER_ID"))
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
 
+	// Create repair object
+	repair := &Repair{REPAIR, args.String("REPAIR_ID"), bike.Id, repairer.Id, REPAIR_REQUESTED, Audit{}}
+
 	// Write the state to the ledger
-	err = stub.PutState(rideKey, rideBytes)
+	err = repairs(stub).Create(repair)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(userKey, userBytes)
+	err = bikes(stub).Update(bike)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(bikeKey, bikeBytes)
+
+	// Emit the event
+	event.addChange(REPAIR, repair.Id, "", REPAIR_REQUESTED)
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Ride %s started.\n", args[1])
+	fmt.Printf("Repair %s requested.\n", repair.Id)
 
 	return shim.Success(nil)
 }
 
-// End a ride
-func (t *BikeShareWorkflowChaincode) endRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var user *User
-	var bike *Bike
-	var ride *Ride
+// Get the repair assigned to the calling repairer
+func (t *BikeShareWorkflowChaincode) getAssignedRepair(stub shim.ChaincodeStubInterface, repairerID string, repairID string) (*Repair, error) {
+	// Get repairer state from the ledger
+	repairer, err := repairers(stub).MustGet(repairerID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Access control: Only a User Org member can invoke this transaction
-	if !t.devMode && !authenticateUserOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of User Org. Access denied.")
+	// Get repair state from the ledger
+	repair, err := repairs(stub).MustGet(repairID)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(args) != 5 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 5: {User ID, Ride ID, Time, Longitude, Latitude}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller owns the repairer ID
+	if !t.devMode {
+		err = verifyOwner(stub, repairer.Owner, "repairer", repairer.Id)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Get user state from the ledger
-	userKey, err := getUserKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
+	// Verify if repairer matches
+	if repair.RepairerId != repairer.Id {
+		return nil, newError(ERR_REPAIRER_MISMATCH, fmt.Sprintf("Actual repairer %s and requested repairer %s not match.", repair.RepairerId, repairer.Id)).withEntity(REPAIR, repair.Id)
 	}
-	userBytes, err := stub.GetState(userKey)
+
+	return repair, nil
+}
+
+// Accept the request to repair a bike
+func (t *BikeShareWorkflowChaincode) acceptRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	repair, err := t.getAssignedRepair(stub, args.String("REPAIRER_ID"), args.String("REPAIR_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(userBytes) == 0 {
-		err = errors.New(fmt.Sprintf("User %s not found.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(userBytes, &user)
+	// Verify if repair is requested
+	event := newEvent(stub, EVENT_REPAIR_ACCEPTED, repair.RepairerId)
+	err = fire(stub, repair, "acceptRepair", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if user is in a ride
-	if user.Status != USER_IN_RIDE {
-		err = errors.New(fmt.Sprintf("User %s doesn't have an ongoing ride.", args[0]))
-		return shim.Error(err.Error())
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(repair.BikeId)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get ride state from the ledger
-	rideKey, err := getRideKey(stub, args[1])
+	// Verify if bike is ready to repair
+	err = fire(stub, bike, "acceptRepair", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	rideBytes, err := stub.GetState(rideKey)
+
+	// Write the state to the ledger
+	err = repairs(stub).Update(repair)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(rideBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Ride %s not found.", args[1]))
-		return shim.Error(err.Error())
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(rideBytes, &ride)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("Repair %s accepted.\n", repair.Id)
 
-	// Verify if ride ID matches
-	if user.RideId != args[1] {
-		err = errors.New(fmt.Sprintf("Actual ride %s and requested ride %s not match.", user.RideId, args[1]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	// Verify if ride is ongoing
-	if ride.Status != RIDE_ONGOING {
-		err = errors.New(fmt.Sprintf("Ride %s not ongoing.", args[1]))
-		return shim.Error(err.Error())
+// Reject the request to repair a bike
+func (t *BikeShareWorkflowChaincode) rejectRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	repair, err := t.getAssignedRepair(stub, args.String("REPAIRER_ID"), args.String("REPAIR_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, ride.BikeId)
+	// Verify if repair is requested and its bike ready to repair
+	event := newEvent(stub, EVENT_REPAIR_REJECTED, repair.RepairerId)
+	err = fire(stub, repair, "rejectRepair", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+
+	// Write the state to the ledger
+	err = repairs(stub).Update(repair)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", ride.BikeId))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("Repair %s rejected.\n", repair.Id)
 
-	// Verify if bike is in use
-	if bike.Status != BIKE_IN_USE {
-		err = errors.New(fmt.Sprintf("Bike %s not in use.", args[1]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	// Parse longitude and latitude
-	longitude, err := strconv.ParseFloat(string(args[3]), 8)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	latitude, err := strconv.ParseFloat(string(args[4]), 8)
+// Complete the repair of a bike
+func (t *BikeShareWorkflowChaincode) completeRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	repair, err := t.getAssignedRepair(stub, args.String("REPAIRER_ID"), args.String("REPAIR_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Parse start and end time
-	startTimeInt, err := strconv.ParseInt(ride.StartTime, 10, 64)
-    if err != nil {
-        return shim.Error(err.Error())
-    }
-	startTime := time.Unix(startTimeInt, 0)
-	endTimeInt, err := strconv.ParseInt(args[2], 10, 64)
-    if err != nil {
-        return shim.Error(err.Error())
-    }
-	endTime := time.Unix(endTimeInt, 0)
-	duration := endTime.Sub(startTime).Minutes()
-	cost := float32(duration) * 0.1
-
-	ride.EndTime = args[2]
-	ride.EndLocation = []float32{float32(longitude), float32(latitude)}
-	ride.Cost = cost
-	ride.Status = RIDE_COMPLETED
-	rideBytes, err = json.Marshal(ride)
+	// Verify if repair is accepted
+	event := newEvent(stub, EVENT_REPAIR_COMPLETED, repair.RepairerId)
+	err = fire(stub, repair, "completeRepair", event)
 	if err != nil {
-		return shim.Error("Error marshaling ride structure.")
+		return errorResponse(err)
 	}
-	
-	bike.Location = []float32{float32(longitude), float32(latitude)}
-	bike.Status = BIKE_AVAILABLE
-	bikeBytes, err = json.Marshal(bike)
+
+	// Get bike state from the ledger
+	bike, err := bikes(stub).MustGet(repair.BikeId)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
-	
-	user.Balance -= cost
-	user.Status = USER_FREE
-	userBytes, err = json.Marshal(user)
+
+	// Verify if bike is repairing
+	err = fire(stub, bike, "completeRepair", event)
 	if err != nil {
-		return shim.Error("Error marshaling user structure.")
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(rideKey, rideBytes)
+	err = repairs(stub).Update(repair)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(userKey, userBytes)
+	err = bikes(stub).Update(bike)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(bikeKey, bikeBytes)
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Ride %s ended.\n", user.RideId)
+	fmt.Printf("Repair %s completed.\n", repair.Id)
 
 	return shim.Success(nil)
 }
 
-// Report an issue
-func (t *BikeShareWorkflowChaincode) reportIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Register a docking station
+func (t *BikeShareWorkflowChaincode) registerStation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var ride *Ride
 
-	// Access control: Only a User Org member can invoke this transaction
-	if !t.devMode && !authenticateUserOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of User Org. Access denied.")
+	// Verify if capacity is in range
+	capacity := args.Int("CAPACITY")
+	if capacity < 1 || capacity > MAX_STATION_CAPACITY {
+		return errorResponse(badArgument(args, "CAPACITY", fmt.Sprintf("Capacity must be between 1 and %d.", MAX_STATION_CAPACITY)))
 	}
 
-	if len(args) != 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {User ID, Issue ID, Ride ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
-	}
-
-	// Get issue state from the ledger
-	issueKey, err := getIssueKey(stub, args[1])
+	// Create station object and write it to the ledger
+	location := []float32{float32(args.Float("LONGITUDE")), float32(args.Float("LATITUDE"))}
+	station := &Station{STATION, args.String("STATION_ID"), location, capacity, newDocks(capacity), 0, "", STATION_ACTIVE, Audit{}}
+	refreshDockAvailability(station)
+	err = stations(stub).Create(station)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	issueBytes, err := stub.GetState(issueKey)
+
+	// Emit the event
+	event := newEvent(stub, EVENT_STATION_REGISTERED, "").
+		addChange(STATION, station.Id, "", STATION_ACTIVE)
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(issueBytes) != 0 {
-		err = errors.New(fmt.Sprintf("Issue %s already opened.", args[1]))
-		return shim.Error(err.Error())
+	fmt.Printf("Station %s registered.\n", station.Id)
+
+	return shim.Success(nil)
+}
+
+// Change the number of dock slots of a station
+func (t *BikeShareWorkflowChaincode) resizeStation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Verify if capacity is in range
+	capacity := args.Int("CAPACITY")
+	if capacity < 1 || capacity > MAX_STATION_CAPACITY {
+		return errorResponse(badArgument(args, "CAPACITY", fmt.Sprintf("Capacity must be between 1 and %d.", MAX_STATION_CAPACITY)))
 	}
 
-	// Get ride state from the ledger
-	rideKey, err := getRideKey(stub, args[2])
+	// Get station state from the ledger
+	station, err := stations(stub).MustGet(args.String("STATION_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	rideBytes, err := stub.GetState(rideKey)
+
+	// Verify if station is in service and the slots removed are free
+	err = checkStationActive(station)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(rideBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Ride %s not found.", args[2]))
-		return shim.Error(err.Error())
+	err = resizeDocks(station, capacity)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(rideBytes, &ride)
+	// Write the state to the ledger
+	err = stations(stub).Update(station)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if user matches
-	if ride.UserId != args[0] {
-		err = errors.New(fmt.Sprintf("Actual user %s and requested user %s not match.", ride.UserId, args[0]))
-		return shim.Error(err.Error())
+	// Emit the event
+	event := newEvent(stub, EVENT_STATION_RESIZED, "").
+		addChange(STATION, station.Id, station.Status, station.Status)
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
 	}
+	fmt.Printf("Station %s resized to %d docks.\n", station.Id, capacity)
 
-	// Verify if ride is completed
-	if ride.Status != RIDE_COMPLETED {
-		err = errors.New(fmt.Sprintf("Ride %s not completed.", args[2]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	// Create issue object
-	issue := &Issue{ISSUE, args[1], args[0], ride.BikeId, args[2], ISSUE_OPEN}
-	issueBytes, err = json.Marshal(issue)
+// Retire an empty station
+func (t *BikeShareWorkflowChaincode) retireStation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get station state from the ledger
+	station, err := stations(stub).MustGet(args.String("STATION_ID"))
 	if err != nil {
-		return shim.Error("Error marshaling issue structure.")
+		return errorResponse(err)
 	}
 
-	ride.Status = RIDE_ISSUE_OPEN
-	rideBytes, err = json.Marshal(ride)
+	// Verify if station is active and empty
+	event := newEvent(stub, EVENT_STATION_RETIRED, "")
+	err = fire(stub, station, "retireStation", event)
 	if err != nil {
-		return shim.Error("Error marshaling ride structure.")
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(issueKey, issueBytes)
+	err = stations(stub).Update(station)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(rideKey, rideBytes)
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Issue %s opened.\n", args[1])
+	fmt.Printf("Station %s retired.\n", station.Id)
 
 	return shim.Success(nil)
 }
 
-// Accept an issue
-func (t *BikeShareWorkflowChaincode) acceptIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Define a service area, no-parking or preferred parking zone
+func (t *BikeShareWorkflowChaincode) defineZone(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var user *User
-	var ride *Ride
-	var issue *Issue
-
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Issue ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
-	}
 
-	// Get issue state from the ledger
-	issueKey, err := getIssueKey(stub, args[0])
+	polygon, err := parsePolygon(args.String("POLYGON_JSON"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(badArgument(args, "POLYGON_JSON", err.Error()))
 	}
-	issueBytes, err := stub.GetState(issueKey)
+	err = checkLedgerCurrency(args, "FEE", args.Money("FEE"))
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(issueBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Issue %s not found.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(issueBytes, &issue)
+	// Create zone object and write it to the ledger
+	zone := &Zone{ZONE, args.String("ZONE_ID"), args.String("ZONE_TYPE"), polygon, args.Money("FEE"), ZONE_ACTIVE, Audit{}}
+	err = zones(stub).Create(zone)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	// Verify if issue is open
-	if issue.Status != ISSUE_OPEN {
-		err = errors.New(fmt.Sprintf("Issue %s not open.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Get user state from the ledger
-	userKey, err := getUserKey(stub, issue.UserId)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	userBytes, err := stub.GetState(userKey)
+	// Emit the event
+	event := newEvent(stub, EVENT_ZONE_DEFINED, "").
+		addChange(ZONE, zone.Id, "", ZONE_ACTIVE)
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(userBytes) == 0 {
-		err = errors.New(fmt.Sprintf("User %s not found.", issue.UserId))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("Zone %s defined.\n", zone.Id)
+
+	return shim.Success(nil)
+}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(userBytes, &user)
+// Remove a zone
+func (t *BikeShareWorkflowChaincode) removeZone(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get zone state from the ledger
+	zone, err := zones(stub).MustGet(args.String("ZONE_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Get ride state from the ledger
-	rideKey, err := getRideKey(stub, issue.RideId)
+	// Verify if zone is active
+	event := newEvent(stub, EVENT_ZONE_REMOVED, "")
+	err = fire(stub, zone, "removeZone", event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	rideBytes, err := stub.GetState(rideKey)
+
+	// Write the state to the ledger
+	err = zones(stub).Update(zone)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(rideBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Ride %s not found.", issue.RideId))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(rideBytes, &ride)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("Zone %s removed.\n", zone.Id)
 
-	// Verify if issue is open
-	if ride.Status != RIDE_ISSUE_OPEN {
-		err = errors.New(fmt.Sprintf("Ride %s not associated with an issue.", issue.RideId))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	issue.Status = ISSUE_CLOSED
-	issueBytes, err = json.Marshal(issue)
+// Add funds to the balance of a user
+func (t *BikeShareWorkflowChaincode) topUpBalance(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
 	if err != nil {
-		return shim.Error("Error marshaling issue structure.")
+		return errorResponse(err)
 	}
 
-	user.Balance += ride.Cost
-	userBytes, err = json.Marshal(user)
-	if err != nil {
-		return shim.Error("Error marshaling user structure.")
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	ride.Cost = 0
-	ride.Status = RIDE_ISSUE_CLOSED
-	rideBytes, err = json.Marshal(ride)
-	if err != nil {
-		return shim.Error("Error marshaling ride structure.")
+	// Verify if amount is positive
+	amount := args.Money("AMOUNT")
+	if amount.Amount <= 0 {
+		return errorResponse(badArgument(args, "AMOUNT", "Amount must be positive."))
 	}
 
-	// Write the state to the ledger
-	err = stub.PutState(issueKey, issueBytes)
+	event := newEvent(stub, EVENT_BALANCE_TOPPED_UP, user.Id)
+	err = postBalanceEntry(stub, user, &BalanceEntry{Amount: amount, Reason: REASON_TOP_UP}, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(userKey, userBytes)
+
+	// Write the state to the ledger
+	err = users(stub).Update(user)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(rideKey, rideBytes)
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Issue %s accepted.\n", args[0])
+	fmt.Printf("Balance of user %s topped up by %s.\n", user.Id, amount)
 
 	return shim.Success(nil)
 }
 
-// Reject an issue
-func (t *BikeShareWorkflowChaincode) rejectIssue(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-	var ride *Ride
-	var issue *Issue
-
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+// Withdraw funds from the balance of a user
+func (t *BikeShareWorkflowChaincode) withdrawBalance(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get user state from the ledger
+	user, err := users(stub).MustGet(args.String("USER_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Issue ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller owns the user ID
+	if !t.devMode {
+		err = verifyOwner(stub, user.Owner, "user", user.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	// Get issue state from the ledger
-	issueKey, err := getIssueKey(stub, args[0])
+	// Verify if balance covers the amount
+	amount := args.Money("AMOUNT")
+	err = checkDebit(args, "AMOUNT", user, amount)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	issueBytes, err := stub.GetState(issueKey)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(issueBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Issue %s not found.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(issueBytes, &issue)
+	event := newEvent(stub, EVENT_BALANCE_WITHDRAWN, user.Id)
+	err = postBalanceEntry(stub, user, &BalanceEntry{Amount: amount.Neg(), Reason: REASON_WITHDRAWAL}, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if issue is open
-	if issue.Status != ISSUE_OPEN {
-		err = errors.New(fmt.Sprintf("Issue %s not open.", args[0]))
-		return shim.Error(err.Error())
+	// Write the state to the ledger
+	err = users(stub).Update(user)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get ride state from the ledger
-	rideKey, err := getRideKey(stub, issue.RideId)
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	rideBytes, err := stub.GetState(rideKey)
+	fmt.Printf("%s withdrawn from the balance of user %s.\n", amount, user.Id)
+
+	return shim.Success(nil)
+}
+
+// Transfer funds between the balances of two users
+func (t *BikeShareWorkflowChaincode) transferBalance(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	// Get sender state from the ledger
+	sender, err := users(stub).MustGet(args.String("FROM_USER_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(rideBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Ride %s not found.", issue.RideId))
-		return shim.Error(err.Error())
+
+	// Verify if caller owns the sender ID
+	if !t.devMode {
+		err = verifyOwner(stub, sender.Owner, "user", sender.Id)
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(rideBytes, &ride)
+	// Get recipient state from the ledger
+	recipient, err := users(stub).MustGet(args.String("TO_USER_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-
-	// Verify if issue is open
-	if ride.Status != RIDE_ISSUE_OPEN {
-		err = errors.New(fmt.Sprintf("Ride %s not associated with an issue.", issue.RideId))
-		return shim.Error(err.Error())
+	if recipient.Id == sender.Id {
+		return errorResponse(badArgument(args, "TO_USER_ID", fmt.Sprintf("User %s cannot transfer to itself.", sender.Id)))
 	}
 
-	issue.Status = ISSUE_CLOSED
-	issueBytes, err = json.Marshal(issue)
+	// Verify if balance covers the amount
+	amount := args.Money("AMOUNT")
+	err = checkDebit(args, "AMOUNT", sender, amount)
 	if err != nil {
-		return shim.Error("Error marshaling issue structure.")
+		return errorResponse(err)
 	}
 
-	ride.Status = RIDE_ISSUE_CLOSED
-	rideBytes, err = json.Marshal(ride)
+	event := newEvent(stub, EVENT_BALANCE_TRANSFERRED, sender.Id)
+	err = postBalanceEntry(stub, sender, &BalanceEntry{Amount: amount.Neg(), Reason: REASON_TRANSFER_OUT, CounterpartyId: recipient.Id}, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = postBalanceEntry(stub, recipient, &BalanceEntry{Amount: amount, Reason: REASON_TRANSFER_IN, CounterpartyId: sender.Id}, event)
 	if err != nil {
-		return shim.Error("Error marshaling ride structure.")
+		return errorResponse(err)
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(issueKey, issueBytes)
+	err = users(stub).Update(sender)
+	if err != nil {
+		return errorResponse(err)
+	}
+	err = users(stub).Update(recipient)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(rideKey, rideBytes)
+
+	// Emit the event
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Issue %s rejected.\n", args[0])
+	fmt.Printf("%s transferred from user %s to user %s.\n", amount, sender.Id, recipient.Id)
 
 	return shim.Success(nil)
 }
 
-// Request to repair a bike
-func (t *BikeShareWorkflowChaincode) requestRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Set a new tariff
+func (t *BikeShareWorkflowChaincode) setTariff(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var repairer *Repairer
-	var bike *Bike
 
-	// Access control: Only a Provider Org member can invoke this transaction
-	if !t.devMode && !authenticateProviderOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Provider Org. Access denied.")
+	unlockFee := args.Money("UNLOCK_FEE")
+	perMinuteRate := args.Money("PER_MINUTE_RATE")
+	freeMinutes := args.Int("FREE_MINUTES")
+	dailyCap := args.Money("DAILY_CAP")
+	if freeMinutes < 0 {
+		return errorResponse(badArgument(args, "FREE_MINUTES", "Free minutes must not be negative."))
 	}
-
-	if len(args) != 3 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 3: {Repair ID, Bike ID, Repairer ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	perKmRate := Money{0, unlockFee.Currency}
+	if args.Has("PER_KM_RATE") {
+		perKmRate = args.Money("PER_KM_RATE")
 	}
-
-	// Get repair state from the ledger
-	repairKey, err := getRepairKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
+	if unlockFee.Currency != perMinuteRate.Currency || unlockFee.Currency != dailyCap.Currency || unlockFee.Currency != perKmRate.Currency {
+		return errorResponse(newError(ERR_CURRENCY_MISMATCH, "Tariff amounts must share one currency."))
 	}
-	repairBytes, err := stub.GetState(repairKey)
+	err = checkLedgerCurrency(args, "UNLOCK_FEE", unlockFee)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(repairBytes) != 0 {
-		err = errors.New(fmt.Sprintf("Repair %s already requested.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, args[1])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	bikeBytes, err := stub.GetState(bikeKey)
+	// Get current tariff state from the ledger
+	current, err := getCurrentTariff(stub)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", args[1]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	// Create tariff object with the next version
+	tariff := &Tariff{TARIFF, current.Version + 1, unlockFee, perMinuteRate, freeMinutes, dailyCap, args.String("ROUNDING"), perKmRate}
+	tariffBytes, err := json.Marshal(tariff)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling tariff structure."))
 	}
 
-	// Verify if bike is available
-	if bike.Status != BIKE_AVAILABLE {
-		err = errors.New(fmt.Sprintf("Bike %s not available.", args[1]))
-		return shim.Error(err.Error())
+	// Write the state to the ledger
+	tariffKey, err := getTariffKey(stub, tariff.Version)
+	if err != nil {
+		return errorResponse(err)
 	}
-
-	// Get repairer state from the ledger
-	repairerKey, err := getRepairerKey(stub, args[2])
+	currentTariffKey, err := getCurrentTariffKey(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	repairerBytes, err := stub.GetState(repairerKey)
+	err = stub.PutState(tariffKey, tariffBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(repairerBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repairer %s not found.", args[2]))
-		return shim.Error(err.Error())
+	err = stub.PutState(currentTariffKey, tariffBytes)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairerBytes, &repairer)
+	// Emit the event
+	event := newEvent(stub, EVENT_TARIFF_SET, "").addChange(TARIFF, strconv.Itoa(tariff.Version), "", "")
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("Tariff version %d set.\n", tariff.Version)
 
-	// Create repair object
-	repair := &Repair{REPAIR, args[0], args[1], args[2], REPAIR_REQUESTED}
-	repairBytes, err = json.Marshal(repair)
+	return shim.Success(tariffBytes)
+}
+
+// Change a configuration setting
+func (t *BikeShareWorkflowChaincode) setConfig(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	config, err := getConfig(stub)
 	if err != nil {
-		return shim.Error("Error marshaling repair structure.")
+		return errorResponse(err)
+	}
+
+	if args.String("SETTING") == CONFIG_MAX_CLOCK_SKEW {
+		seconds, err := strconv.Atoi(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Malformed integer %s.", args.String("VALUE"))))
+		}
+		if seconds < 0 {
+			return errorResponse(badArgument(args, "VALUE", "Maximum clock skew must not be negative."))
+		}
+		config.MaxClockSkew = seconds
+	} else if args.String("SETTING") == CONFIG_RICH_QUERIES {
+		enabled, err := strconv.ParseBool(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Malformed boolean %s.", args.String("VALUE"))))
+		}
+		config.RichQueries = enabled
+	} else if args.String("SETTING") == CONFIG_HOLD_POLICY {
+		known := false
+		for _, policy := range holdPolicies {
+			if args.String("VALUE") == policy {
+				known = true
+			}
+		}
+		if !known {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Unknown hold policy %s. Expecting one of %s.", args.String("VALUE"), strings.Join(holdPolicies, ", "))))
+		}
+		config.HoldPolicy = args.String("VALUE")
+	} else if args.String("SETTING") == CONFIG_HOLD_DEPOSIT {
+		deposit, err := parseMoney(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", err.Error()))
+		}
+		err = checkLedgerCurrency(args, "VALUE", deposit)
+		if err != nil {
+			return errorResponse(err)
+		}
+		config.HoldDeposit = deposit
+	} else if args.String("SETTING") == CONFIG_RESERVATION_MINUTES {
+		minutes, err := strconv.Atoi(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Malformed integer %s.", args.String("VALUE"))))
+		}
+		if minutes < 1 || minutes > MAX_RESERVATION_MINUTES {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Reservation minutes must be between 1 and %d.", MAX_RESERVATION_MINUTES)))
+		}
+		config.ReservationMinutes = minutes
+	} else if args.String("SETTING") == CONFIG_NO_SHOW_FEE {
+		fee, err := parseMoney(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", err.Error()))
+		}
+		err = checkLedgerCurrency(args, "VALUE", fee)
+		if err != nil {
+			return errorResponse(err)
+		}
+		config.NoShowFee = fee
+	} else if args.String("SETTING") == CONFIG_NO_SHOW_ALLOWANCE {
+		allowance, err := strconv.Atoi(args.String("VALUE"))
+		if err != nil {
+			return errorResponse(badArgument(args, "VALUE", fmt.Sprintf("Malformed integer %s.", args.String("VALUE"))))
+		}
+		if allowance < 0 {
+			return errorResponse(badArgument(args, "VALUE", "No-show allowance must not be negative."))
+		}
+		config.NoShowAllowance = allowance
+	} else {
+		err = badArgument(args, "SETTING", fmt.Sprintf("Unknown setting %s.", args.String("SETTING")))
+		return errorResponse(err)
 	}
 
-	bike.Status = BIKE_TO_REPAIR
-	bikeBytes, err = json.Marshal(bike)
+	configBytes, err := json.Marshal(config)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling config structure."))
 	}
 
 	// Write the state to the ledger
-	err = stub.PutState(repairKey, repairBytes)
+	configKey, err := getConfigKey(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(bikeKey, bikeBytes)
+	err = stub.PutState(configKey, configBytes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Repair %s requested.\n", args[0])
 
-	return shim.Success(nil)
+	// Emit the event, naming the setting changed
+	event := newEvent(stub, EVENT_CONFIG_CHANGED, "").addChange(CONFIG, args.String("SETTING"), "", "")
+	err = emitEvent(stub, event)
+	if err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Setting %s changed to %s.\n", args.String("SETTING"), args.String("VALUE"))
+
+	return shim.Success(configBytes)
 }
 
-// Accept the request to repair a bike
-func (t *BikeShareWorkflowChaincode) acceptRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Write the secondary index entries of every record of the given object types, or of all indexed types
+func (t *BikeShareWorkflowChaincode) rebuildIndexes(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var repairer *Repairer
-	var bike *Bike
-	var repair *Repair
 
-	// Access control: Only a Repairer Org member can invoke this transaction
-	if !t.devMode && !authenticateRepairerOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Repairer Org. Access denied.")
+	docTypes := indexedObjectTypes
+	if args.Has("DOC_TYPE") {
+		docTypes = []string{args.String("DOC_TYPE")}
 	}
 
-	if len(args) != 2 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Repairer ID, Repair ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	counts := map[string]int{}
+	for _, docType := range docTypes {
+		count, err := rebuildIndexes(stub, docType)
+		if err != nil {
+			return errorResponse(err)
+		}
+		counts[docType] = count
 	}
 
-	// Get repairer state from the ledger
-	repairerKey, err := getRepairerKey(stub, args[0])
+	countsBytes, err := json.Marshal(counts)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling index counts."))
 	}
-	repairerBytes, err := stub.GetState(repairerKey)
+	fmt.Printf("Indexes rebuilt: %s\n", string(countsBytes))
+
+	return shim.Success(countsBytes)
+}
+
+// Replace the ACL
+func (t *BikeShareWorkflowChaincode) setAccessControlList(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+	var acl *AccessControlList
+
+	// Parse and validate the ACL
+	err = json.Unmarshal([]byte(args.String("ACL_JSON")), &acl)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(badArgument(args, "ACL_JSON", fmt.Sprintf("Malformed ACL: %s", err.Error())))
 	}
-	if len(repairerBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repairer %s not found.", args[0]))
-		return shim.Error(err.Error())
+	if acl == nil {
+		return errorResponse(badArgument(args, "ACL_JSON", "ACL must not be null."))
 	}
-
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairerBytes, &repairer)
+	acl.ObjectType = ACL
+	err = validateAccessControlList(acl)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Get repair state from the ledger
-	repairKey, err := getRepairKey(stub, args[1])
+	aclBytes, err := json.Marshal(acl)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling ACL structure."))
 	}
-	repairBytes, err := stub.GetState(repairKey)
+
+	// Write the state to the ledger
+	aclKey, err := getAccessControlListKey(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(repairBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repair %s not found.", args[1]))
-		return shim.Error(err.Error())
+	err = stub.PutState(aclKey, aclBytes)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairBytes, &repair)
+	// Emit the event
+	event := newEvent(stub, EVENT_ACL_REPLACED, "").addChange(ACL, ACL, "", "")
+	err = emitEvent(stub, event)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
+	fmt.Printf("ACL updated with %d rules.\n", len(acl.Rules))
 
-	// Verify if repairer matches
-	if repair.RepairerId != args[0] {
-		err = errors.New(fmt.Sprintf("Actual repairer %s and requested repairer %s not match.", repair.RepairerId, args[0]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nil)
+}
 
-	// Verify if repair is requested
-	if repair.Status != REPAIR_REQUESTED {
-		err = errors.New(fmt.Sprintf("Repair %s already processed.", args[1]))
-		return shim.Error(err.Error())
+// Get all users
+func (t *BikeShareWorkflowChaincode) getUsers(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, repair.BikeId)
+	selector := newSelector(USER)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+
+	return shim.Success(queryResponse)
+}
+
+// Get all repairers
+func (t *BikeShareWorkflowChaincode) getRepairers(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", repair.BikeId))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	selector := newSelector(REPAIRER)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if bike is ready to repair
-	if bike.Status != BIKE_TO_REPAIR {
-		err = errors.New(fmt.Sprintf("Bike %s not ready to repair.", repair.BikeId))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(queryResponse)
+}
 
-	repair.Status = REPAIR_ACCEPTED
-	repairBytes, err = json.Marshal(repair)
-	if err != nil {
-		return shim.Error("Error marshaling repair structure.")
-	}
+// Get all bikes
+func (t *BikeShareWorkflowChaincode) getBikes(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
 
-	bike.Status = BIKE_REPAIRING
-	bikeBytes, err = json.Marshal(bike)
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
 
-	// Write the state to the ledger
-	err = stub.PutState(repairKey, repairBytes)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	err = stub.PutState(bikeKey, bikeBytes)
+	selector := newSelector(BIKE)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Repair %s accepted.\n", args[1])
 
-	return shim.Success(nil)
+	return shim.Success(queryResponse)
 }
 
-// Reject the request to repair a bike
-func (t *BikeShareWorkflowChaincode) rejectRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get bike with specified ID
+func (t *BikeShareWorkflowChaincode) getBikeById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var repairer *Repairer
-	var bike *Bike
-	var repair *Repair
 
-	// Access control: Only a Repairer Org member can invoke this transaction
-	if !t.devMode && !authenticateRepairerOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Repairer Org. Access denied.")
+	selector := newSelector(BIKE).equals("id", args.String("BIKE_ID"))
+	queryResponse, err := getQueryResponse(stub, selector)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 2 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Repairer ID, Repair ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(queryResponse)
+}
 
-	// Get repairer state from the ledger
-	repairerKey, err := getRepairerKey(stub, args[0])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	repairerBytes, err := stub.GetState(repairerKey)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(repairerBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repairer %s not found.", args[0]))
-		return shim.Error(err.Error())
-	}
+// Get all bikes with specified status
+func (t *BikeShareWorkflowChaincode) getBikesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairerBytes, &repairer)
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Get repair state from the ledger
-	repairKey, err := getRepairKey(stub, args[1])
+	selector := newSelector(BIKE).equals("status", args.String("STATUS"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	repairBytes, err := stub.GetState(repairKey)
+
+	return shim.Success(queryResponse)
+}
+
+// Get all bikes docked at specified station
+func (t *BikeShareWorkflowChaincode) getBikesAtStation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(repairBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repair %s not found.", args[1]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairBytes, &repair)
+	selector := newSelector(BIKE).equals("stationId", args.String("STATION_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if repairer matches
-	if repair.RepairerId != args[0] {
-		err = errors.New(fmt.Sprintf("Actual repairer %s and requested repairer %s not match.", repair.RepairerId, args[0]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(queryResponse)
+}
 
-	// Verify if repair is requested
-	if repair.Status != REPAIR_REQUESTED {
-		err = errors.New(fmt.Sprintf("Repair %s already processed.", args[1]))
-		return shim.Error(err.Error())
+// Get the available bikes within a radius of a location, nearest first
+func (t *BikeShareWorkflowChaincode) getBikesNear(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	// Verify the search radius and limit
+	longitude, latitude := args.Float("LONGITUDE"), args.Float("LATITUDE")
+	radius := args.Float("RADIUS_METERS")
+	if radius <= 0 || radius > MAX_NEARBY_RADIUS {
+		return errorResponse(badArgument(args, "RADIUS_METERS", fmt.Sprintf("Radius must be positive and at most %d meters.", MAX_NEARBY_RADIUS)))
+	}
+	limit := DEFAULT_NEARBY_LIMIT
+	if args.Has("LIMIT") {
+		limit = args.Int("LIMIT")
+		if limit < 1 || limit > MAX_NEARBY_LIMIT {
+			return errorResponse(badArgument(args, "LIMIT", fmt.Sprintf("Limit must be between 1 and %d.", MAX_NEARBY_LIMIT)))
+		}
 	}
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, repair.BikeId)
+	now, err := getTxTime(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	bikeBytes, err := stub.GetState(bikeKey)
+	nearby, err := getBikesNear(stub, longitude, latitude, radius, limit, now)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", repair.BikeId))
-		return shim.Error(err.Error())
-	}
-
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	nearbyBytes, err := json.Marshal(nearby)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling nearby bikes."))
 	}
 
-	// Verify if bike is ready to repair
-	if bike.Status != BIKE_TO_REPAIR {
-		err = errors.New(fmt.Sprintf("Bike %s not ready to repair.", repair.BikeId))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(nearbyBytes)
+}
+
+// Get all stations with a free dock
+func (t *BikeShareWorkflowChaincode) getStationsWithFreeDocks(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
 
-	repair.Status = REPAIR_REJECTED
-	repairBytes, err = json.Marshal(repair)
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error("Error marshaling repair structure.")
+		return errorResponse(err)
 	}
 
-	// Write the state to the ledger
-	err = stub.PutState(repairKey, repairBytes)
+	selector := newSelector(STATION).equals("dockAvailability", DOCKS_FREE)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	fmt.Printf("Repair %s rejected.\n", args[1])
 
-	return shim.Success(nil)
+	return shim.Success(queryResponse)
 }
 
-// Complete the repair of a bike
-func (t *BikeShareWorkflowChaincode) completeRepair(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all zones
+func (t *BikeShareWorkflowChaincode) getZones(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
-	var repairer *Repairer
-	var bike *Bike
-	var repair *Repair
 
-	// Access control: Only a Repairer Org member can invoke this transaction
-	if !t.devMode && !authenticateRepairerOrg(creatorOrg, creatorCertIssuer) {
-		return shim.Error("Caller not a member of Repairer Org. Access denied.")
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 2 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 2: {Repairer ID, Repair ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	selector := newSelector(ZONE)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	// Get repairer state from the ledger
-	repairerKey, err := getRepairerKey(stub, args[0])
+	return shim.Success(queryResponse)
+}
+
+// Get the zones containing a location and the fee of ending a ride there
+func (t *BikeShareWorkflowChaincode) checkLocation(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	check, err := checkLocation(stub, args.Float("LONGITUDE"), args.Float("LATITUDE"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	repairerBytes, err := stub.GetState(repairerKey)
+	checkBytes, err := json.Marshal(check)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(repairerBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repairer %s not found.", args[0]))
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling location check structure."))
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairerBytes, &repairer)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
+	return shim.Success(checkBytes)
+}
 
-	// Get repair state from the ledger
-	repairKey, err := getRepairKey(stub, args[1])
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	repairBytes, err := stub.GetState(repairKey)
+// Get all rides
+func (t *BikeShareWorkflowChaincode) getRides(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(repairBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Repair %s not found.", args[1]))
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(repairBytes, &repair)
+	selector := newSelector(RIDE)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if repairer matches
-	if repair.RepairerId != args[0] {
-		err = errors.New(fmt.Sprintf("Actual repairer %s and requested repairer %s not match.", repair.RepairerId, args[0]))
-		return shim.Error(err.Error())
-	}
+	return shim.Success(queryResponse)
+}
 
-	// Verify if repair is accepted
-	if repair.Status != REPAIR_ACCEPTED {
-		err = errors.New(fmt.Sprintf("Repair %s not accepted.", args[1]))
-		return shim.Error(err.Error())
-	}
+// Get ride with specified ID
+func (t *BikeShareWorkflowChaincode) getRideById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
 
-	// Get bike state from the ledger
-	bikeKey, err := getBikeKey(stub, repair.BikeId)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	bikeBytes, err := stub.GetState(bikeKey)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	if len(bikeBytes) == 0 {
-		err = errors.New(fmt.Sprintf("Bike %s not found.", repair.BikeId))
-		return shim.Error(err.Error())
+	// Verify if caller may read the ride
+	if !t.devMode {
+		err = verifyRideReader(stub, creatorOrg, creatorCertIssuer, args.String("RIDE_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	// Unmarshal the JSON
-	err = json.Unmarshal(bikeBytes, &bike)
+	selector := newSelector(RIDE).equals("id", args.String("RIDE_ID"))
+	queryResponse, err := getQueryResponse(stub, selector)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	// Verify if bike is repairing
-	if bike.Status != BIKE_REPAIRING {
-		err = errors.New(fmt.Sprintf("Bike %s not repairing.", repair.BikeId))
-		return shim.Error(err.Error())
+	return shim.Success(queryResponse)
+}
+
+// Get the GPS track of a ride and verify it against its Merkle root
+func (t *BikeShareWorkflowChaincode) getRideTrack(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	// Verify if caller may read the ride
+	if !t.devMode {
+		err = verifyRideReader(stub, creatorOrg, creatorCertIssuer, args.String("RIDE_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	repair.Status = REPAIR_COMPLETED
-	repairBytes, err = json.Marshal(repair)
+	ride, err := rides(stub).MustGet(args.String("RIDE_ID"))
 	if err != nil {
-		return shim.Error("Error marshaling repair structure.")
+		return errorResponse(err)
 	}
-	
-	bike.Status = BIKE_REPAIRED
-	bikeBytes, err = json.Marshal(bike)
+	points, err := getTrackPoints(stub, ride.Id)
 	if err != nil {
-		return shim.Error("Error marshaling bike structure.")
+		return errorResponse(err)
 	}
 
-	// Write the state to the ledger
-	err = stub.PutState(repairKey, repairBytes)
+	// Recompute the root from the stored samples
+	_, root, err := appendTrackLeaves([]string{}, 0, points)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
-	err = stub.PutState(bikeKey, bikeBytes)
+	track := &RideTrack{ride.Id, []TrackSample{}, ride.TrackRoot, root == ride.TrackRoot, ride.DistanceMeters}
+	for _, point := range points {
+		track.Samples = append(track.Samples, point.sample())
+	}
+
+	trackBytes, err := json.Marshal(track)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling ride track structure."))
 	}
-	fmt.Printf("Repair %s completed.\n", args[1])
 
-	return shim.Success(nil)
+	return shim.Success(trackBytes)
 }
 
-// Construct JSON array from a given query results iterator
-func constructQueryResponseFromIterator(iterator shim.StateQueryIteratorInterface) (*bytes.Buffer, error) {
-	var queryResponseArray bytes.Buffer
+// Get all rides with specified user
+func (t *BikeShareWorkflowChaincode) getRidesByUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
 
-	queryResponseArray.WriteString("[")
-	isArrayMemberAlreadyWritten := false
-	for iterator.HasNext() {
-		queryResponse, err := iterator.Next()
+	// Verify if caller may read the records of the user
+	if !t.devMode {
+		err = verifyUserReader(stub, creatorOrg, creatorCertIssuer, args.String("USER_ID"))
 		if err != nil {
-			return nil, err
-		}
-		// Add a comma before array members, suppress it for the first array member
-		if isArrayMemberAlreadyWritten == true {
-			queryResponseArray.WriteString(",")
+			return errorResponse(err)
 		}
-		queryResponseArray.WriteString("{\"Key\":")
-		queryResponseArray.WriteString("\"")
-		queryResponseArray.WriteString(queryResponse.Key)
-		queryResponseArray.WriteString("\"")
-		queryResponseArray.WriteString(",\"Value\":")
-		// Value is a JSON object, so we write as-is
-		queryResponseArray.WriteString(string(queryResponse.Value))
-		queryResponseArray.WriteString("}")
-		isArrayMemberAlreadyWritten = true
 	}
-	queryResponseArray.WriteString("]")
-
-	return &queryResponseArray, nil
-}
 
-func getQueryResponse(stub shim.ChaincodeStubInterface, queryString string) ([]byte, error) {
-	fmt.Printf("Query String: %s\n", queryString)
-
-	iterator, err := stub.GetQueryResult(queryString)
+	pageSize, bookmark, err := parsePagination(args)
 	if err != nil {
-		return nil, err
+		return errorResponse(err)
 	}
-	defer iterator.Close()
 
-	queryResponse, err := constructQueryResponseFromIterator(iterator)
+	selector := newSelector(RIDE).equals("userId", args.String("USER_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return nil, err
+		return errorResponse(err)
 	}
 
-	fmt.Printf("Query Result: %s\n", queryResponse.String())
-
-	return queryResponse.Bytes(), nil
+	return shim.Success(queryResponse)
 }
 
-// Get all users
-func (t *BikeShareWorkflowChaincode) getUsers(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all rides with specified bike
+func (t *BikeShareWorkflowChaincode) getRidesByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", USER)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(RIDE).equals("bikeId", args.String("BIKE_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all repairers
-func (t *BikeShareWorkflowChaincode) getRepairers(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all rides with specified status
+func (t *BikeShareWorkflowChaincode) getRidesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", REPAIRER)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(RIDE).equals("status", args.String("STATUS"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all bikes
-func (t *BikeShareWorkflowChaincode) getBikes(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all issues
+func (t *BikeShareWorkflowChaincode) getIssues(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User/Repairer Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", BIKE)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get bike with specified ID
-func (t *BikeShareWorkflowChaincode) getBikeById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get issue with specified ID
+func (t *BikeShareWorkflowChaincode) getIssueById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User/Repairer Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller may read the records of the user of the issue
+	if !t.devMode {
+		issue, err := issues(stub).Get(args.String("ISSUE_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
+		if issue != nil {
+			err = verifyUserReader(stub, creatorOrg, creatorCertIssuer, issue.UserId)
+			if err != nil {
+				return errorResponse(err)
+			}
+		}
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"id\":\"%s\"}}", BIKE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE).equals("id", args.String("ISSUE_ID"))
+	queryResponse, err := getQueryResponse(stub, selector)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all bikes with specified status
-func (t *BikeShareWorkflowChaincode) getBikesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all issues with specified user
+func (t *BikeShareWorkflowChaincode) getIssuesByUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User/Repairer Org. Access denied.")
+	// Verify if caller may read the records of the user
+	if !t.devMode {
+		err = verifyUserReader(stub, creatorOrg, creatorCertIssuer, args.String("USER_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Status}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"status\":\"%s\"}}", BIKE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE).equals("userId", args.String("USER_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all rides
-func (t *BikeShareWorkflowChaincode) getRides(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all issues with specified bike
+func (t *BikeShareWorkflowChaincode) getIssuesByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", RIDE)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE).equals("bikeId", args.String("BIKE_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get ride with specified ID
-func (t *BikeShareWorkflowChaincode) getRideById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get issue with specified ride
+func (t *BikeShareWorkflowChaincode) getIssueByRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Ride ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	// Verify if caller may read the ride
+	if !t.devMode {
+		err = verifyRideReader(stub, creatorOrg, creatorCertIssuer, args.String("RIDE_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"id\":\"%s\"}}", RIDE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE).equals("rideId", args.String("RIDE_ID"))
+	queryResponse, err := getQueryResponse(stub, selector)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all rides with specified user
-func (t *BikeShareWorkflowChaincode) getRidesByUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all issues with specified status
+func (t *BikeShareWorkflowChaincode) getIssuesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {User ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"userId\":\"%s\"}}", RIDE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(ISSUE).equals("status", args.String("STATUS"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all rides with specified bike
-func (t *BikeShareWorkflowChaincode) getRidesByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all repairs
+func (t *BikeShareWorkflowChaincode) getRepairs(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"bikeId\":\"%s\"}}", RIDE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(REPAIR)
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all rides with specified status
-func (t *BikeShareWorkflowChaincode) getRidesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get repair with specified ID
+func (t *BikeShareWorkflowChaincode) getRepairById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
+	selector := newSelector(REPAIR).equals("id", args.String("REPAIR_ID"))
+	queryResponse, err := getQueryResponse(stub, selector)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Status}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	return shim.Success(queryResponse)
+}
+
+// Get all repairs with specified bike
+func (t *BikeShareWorkflowChaincode) getRepairsByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"status\":\"%s\"}}", RIDE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(REPAIR).equals("bikeId", args.String("BIKE_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all issues
-func (t *BikeShareWorkflowChaincode) getIssues(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all repairs with specified repairer
+func (t *BikeShareWorkflowChaincode) getRepairsByRepairer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", ISSUE)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(REPAIR).equals("repairerId", args.String("REPAIRER_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get issue with specified ID
-func (t *BikeShareWorkflowChaincode) getIssueById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get all repairs with specified status
+func (t *BikeShareWorkflowChaincode) getRepairsByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Issue ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"id\":\"%s\"}}", ISSUE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(REPAIR).equals("status", args.String("STATUS"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all issues with specified user
-func (t *BikeShareWorkflowChaincode) getIssuesByUser(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the balance entries of a user, oldest first
+func (t *BikeShareWorkflowChaincode) getBalanceStatement(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
+	// Verify if caller may read the records of the user
+	if !t.devMode {
+		err = verifyUserReader(stub, creatorOrg, creatorCertIssuer, args.String("USER_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {User ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"userId\":\"%s\"}}", ISSUE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	selector := newSelector(BALANCE_ENTRY).equals("userId", args.String("USER_ID"))
+	queryResponse, err := getQueryPageResponse(stub, selector, pageSize, bookmark)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
 	return shim.Success(queryResponse)
 }
 
-// Get all issues with specified bike
-func (t *BikeShareWorkflowChaincode) getIssuesByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the current tariff or the tariff with specified version
+func (t *BikeShareWorkflowChaincode) getTariff(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
+	var tariff *Tariff
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
+	if args.Has("VERSION") {
+		tariff, err = getTariffByVersion(stub, args.Int("VERSION"))
+	} else {
+		tariff, err = getCurrentTariff(stub)
 	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"bikeId\":\"%s\"}}", ISSUE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	tariffBytes, err := json.Marshal(tariff)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling tariff structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(tariffBytes)
 }
 
-// Get issue with specified ride
-func (t *BikeShareWorkflowChaincode) getIssueByRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the price breakdown of a ride with specified duration under the current tariff
+func (t *BikeShareWorkflowChaincode) quoteRide(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
+	duration := args.Float("DURATION_MINUTES")
+	if duration < 0 {
+		return errorResponse(badArgument(args, "DURATION_MINUTES", "Duration must not be negative."))
+	}
+
+	tariff, err := getCurrentTariff(stub)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Ride ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	var distance int64
+	if args.Has("DISTANCE_METERS") {
+		meters := args.Float("DISTANCE_METERS")
+		if meters < 0 {
+			return errorResponse(badArgument(args, "DISTANCE_METERS", "Distance must not be negative."))
+		}
+		distance = int64(meters + 0.5)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"rideId\":\"%s\"}}", ISSUE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	quote, err := computeFare(tariff, duration, distance)
+	if err != nil {
+		return errorResponse(err)
+	}
+	quoteBytes, err := json.Marshal(quote)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling quote structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(quoteBytes)
 }
 
-// Get all issues with specified status
-func (t *BikeShareWorkflowChaincode) getIssuesByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the configuration
+func (t *BikeShareWorkflowChaincode) getConfig(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/User Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateUserOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/User Org. Access denied.")
-	}
-
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Status}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	config, err := getConfig(stub)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"status\":\"%s\"}}", ISSUE, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	configBytes, err := json.Marshal(config)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling config structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(configBytes)
 }
 
-// Get all repairs
-func (t *BikeShareWorkflowChaincode) getRepairs(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the ACL in force
+func (t *BikeShareWorkflowChaincode) getAccessControlList(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
-	}
-
-	if len(args) != 0 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 0. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	acl, err := getAccessControlList(stub)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\"}}", REPAIR)
-	queryResponse, err := getQueryResponse(stub, queryString)
+	aclBytes, err := json.Marshal(acl)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling ACL structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(aclBytes)
 }
 
-// Get repair with specified ID
-func (t *BikeShareWorkflowChaincode) getRepairById(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the chaincode version and whether access control is active
+func (t *BikeShareWorkflowChaincode) getChaincodeInfo(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
+	info := &ChaincodeInfo{CHAINCODE_VERSION, os.Getenv("CORE_CHAINCODE_ID_NAME"), t.devMode, !t.devMode}
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling chaincode info structure."))
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Repair ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	return shim.Success(infoBytes)
+}
+
+// Get the history of the user with specified ID
+func (t *BikeShareWorkflowChaincode) getUserHistory(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	// Verify if caller may read the records of the user
+	if !t.devMode {
+		err = verifyUserReader(stub, creatorOrg, creatorCertIssuer, args.String("USER_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"id\":\"%s\"}}", REPAIR, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	userKey, err := getUserKey(stub, args.String("USER_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	return shim.Success(queryResponse)
+	return getHistoryResponse(stub, userKey, args)
 }
 
-// Get all repairs with specified bike
-func (t *BikeShareWorkflowChaincode) getRepairsByBike(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the history of the bike with specified ID
+func (t *BikeShareWorkflowChaincode) getBikeHistory(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
+	bikeKey, err := getBikeKey(stub, args.String("BIKE_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Bike ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	return getHistoryResponse(stub, bikeKey, args)
+}
+
+// Get the history of the ride with specified ID
+func (t *BikeShareWorkflowChaincode) getRideHistory(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	var err error
+
+	// Verify if caller may read the ride
+	if !t.devMode {
+		err = verifyRideReader(stub, creatorOrg, creatorCertIssuer, args.String("RIDE_ID"))
+		if err != nil {
+			return errorResponse(err)
+		}
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"bikeId\":\"%s\"}}", REPAIR, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	rideKey, err := getRideKey(stub, args.String("RIDE_ID"))
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	return shim.Success(queryResponse)
+	return getHistoryResponse(stub, rideKey, args)
 }
 
-// Get all repairs with specified repairer
-func (t *BikeShareWorkflowChaincode) getRepairsByRepairer(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
+// Get the history of the repair with specified ID
+func (t *BikeShareWorkflowChaincode) getRepairHistory(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
 	var err error
 
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
+	repairKey, err := getRepairKey(stub, args.String("REPAIR_ID"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Repairer ID}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	return getHistoryResponse(stub, repairKey, args)
+}
+
+// Get a page of the history of a key, given the optional {Page Size, Bookmark, From Time, To Time} arguments
+func getHistoryResponse(stub shim.ChaincodeStubInterface, key string, args *Args) pb.Response {
+	pageSize, bookmark, err := parsePagination(args)
+	if err != nil {
+		return errorResponse(err)
+	}
+	from, to, err := parseTimeRange(args)
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"repairerId\":\"%s\"}}", REPAIR, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	page, err := getHistoryPage(stub, key, pageSize, bookmark, from, to)
+	if err != nil {
+		return errorResponse(err)
+	}
+	pageBytes, err := json.Marshal(page)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling history structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(pageBytes)
 }
 
-// Get all repairs with specified status
-func (t *BikeShareWorkflowChaincode) getRepairsByStatus(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args []string) pb.Response {
-	var err error
-
-	// Access control: Only a Provider/Repairer Org member can invoke this transaction
-	if !t.devMode && !(authenticateProviderOrg(creatorOrg, creatorCertIssuer) || authenticateRepairerOrg(creatorOrg, creatorCertIssuer)) {
-		return shim.Error("Caller not a member of Provider/Repairer Org. Access denied.")
+// List the invocable functions with their roles and argument schemas
+func (t *BikeShareWorkflowChaincode) listFunctions(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	registryBytes, err := json.Marshal(getFunctionRegistry())
+	if err != nil {
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling function registry."))
 	}
 
-	if len(args) != 1 {
-		err = errors.New(fmt.Sprintf("Incorrect number of arguments. Expecting 1: {Status}. Found %d.", len(args)))
-		return shim.Error(err.Error())
+	return shim.Success(registryBytes)
+}
+
+// Get the state machine of an object type
+func (t *BikeShareWorkflowChaincode) getStateMachine(stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response {
+	machine, err := getStateMachine(args.String("OBJECT_TYPE"))
+	if err != nil {
+		return errorResponse(err)
 	}
 
-	queryString := fmt.Sprintf("{\"selector\":{\"docType\":\"%s\",\"status\":\"%s\"}}", REPAIR, args[0])
-	queryResponse, err := getQueryResponse(stub, queryString)
+	machineBytes, err := json.Marshal(machine)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(newError(ERR_INTERNAL, "Error marshaling state machine structure."))
 	}
 
-	return shim.Success(queryResponse)
+	return shim.Success(machineBytes)
 }
 
 func main() {
 	bswc := new(BikeShareWorkflowChaincode)
-	bswc.devMode = true
-	err := shim.Start(bswc)
+	devMode, err := resolveDevMode(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Printf("Error starting Bike Share Workflow chaincode: %s\n", err)
+		os.Exit(1)
+	}
+	bswc.devMode = devMode
+	logDevMode(bswc.devMode)
+	err = shim.Start(bswc)
 	if err != nil {
 		fmt.Printf("Error starting Bike Share Workflow chaincode: %s", err)
 	}
 }
+
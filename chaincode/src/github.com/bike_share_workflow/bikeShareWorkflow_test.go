@@ -0,0 +1,2118 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bike_share_workflow/shimtest"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/attrmgr"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspproto "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Chaincode in dev mode on a shimtest.Stub, whose clock advances one minute per transaction
+type testStub struct {
+	*shimtest.Stub
+	t			*testing.T
+	txCount		int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	stub := &testStub{Stub: shimtest.NewStub("bikeShareWorkflow", &BikeShareWorkflowChaincode{devMode: true}), t: t}
+	stub.TxTime = time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC)
+	return stub
+}
+
+// Stub checking the ACL and record owners like a network peer; set a creator before invoking
+func newNetworkTestStub(t *testing.T) *testStub {
+	stub := &testStub{Stub: shimtest.NewStub("bikeShareWorkflow", &BikeShareWorkflowChaincode{}), t: t}
+	stub.TxTime = time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC)
+	return stub
+}
+
+// Invoke a function in a transaction of its own; the writes of a failed transaction are discarded
+func (s *testStub) invoke(function string, args ...string) pb.Response {
+	s.txCount++
+
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+	response := s.MockInvoke(s.txID(s.txCount), invokeArgs)
+	s.TxTime = s.TxTime.Add(time.Minute)
+
+	if s.TxEventCount() > 1 {
+		s.t.Errorf("%s set %d events; Fabric keeps one per transaction", function, s.TxEventCount())
+	}
+
+	return response
+}
+
+// Invoke a function that must succeed
+func (s *testStub) mustInvoke(function string, args ...string) []byte {
+	response := s.invoke(function, args...)
+	if response.Status != shim.OK {
+		s.t.Fatalf("%s %v failed: %s", function, args, response.Message)
+	}
+	return response.Payload
+}
+
+// Invoke a function and decode the error of its response; nil when the call succeeds
+func (s *testStub) invokeError(function string, args ...string) *ChaincodeError {
+	response := s.invoke(function, args...)
+	if response.Status == shim.OK {
+		return nil
+	}
+	return decodeError(s.t, response)
+}
+
+func decodeError(t *testing.T, response pb.Response) *ChaincodeError {
+	var chaincodeError *ChaincodeError
+	err := json.Unmarshal([]byte(response.Message), &chaincodeError)
+	if err != nil || chaincodeError == nil || chaincodeError.Code == "" {
+		t.Fatalf("Malformed error response %q", response.Message)
+	}
+	return chaincodeError
+}
+
+// Make the following transactions come from an identity enrolled by a CA, with the given
+// certificate attributes
+func (s *testStub) setCreator(mspID string, issuerCN string, commonName string, attributes map[string]string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: issuerCN}}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: commonName},
+		NotBefore: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter: time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if attributes != nil {
+		value, err := json.Marshal(&attrmgr.Attributes{Attrs: attributes})
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attrmgr.AttrOID, Value: value}}
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, key)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	identity := &mspproto.SerializedIdentity{Mspid: mspID, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})}
+	s.Creator, err = proto.Marshal(identity)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *testStub) txID(count int) string {
+	return fmt.Sprintf("tx%d", count)
+}
+
+// Decode the payload of the last event committed
+func (s *testStub) lastEvent() *Event {
+	var event *Event
+	chaincodeEvent := s.Events[len(s.Events) - 1]
+	err := json.Unmarshal(chaincodeEvent.Payload, &event)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if event.Type != chaincodeEvent.EventName {
+		s.t.Errorf("Event name %s and payload type %s differ", chaincodeEvent.EventName, event.Type)
+	}
+	return event
+}
+
+// Read the status of an entity straight from the state
+func (s *testStub) status(docType string, id string) string {
+	key, err := getPrimaryKey(s, docType, id)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var document struct {
+		Status		string		`json:"status"`
+	}
+	value := s.State[key]
+	if len(value) == 0 {
+		return ""
+	}
+	err = json.Unmarshal(value, &document)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return document.Status
+}
+
+// Read a user straight from the state
+func (s *testStub) user(id string) *User {
+	var user *User
+	userKey, err := getUserKey(s, id)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	err = json.Unmarshal(s.State[userKey], &user)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+type invocation struct {
+	function	string
+	args		[]string
+}
+
+func call(function string, args ...string) invocation {
+	return invocation{function, args}
+}
+
+func steps(sequences ...[]invocation) []invocation {
+	all := []invocation{}
+	for _, sequence := range sequences {
+		all = append(all, sequence...)
+	}
+	return all
+}
+
+// Ledger fixtures, each building on the previous ones
+var (
+	registered = []invocation{
+		call("registerUser", "u1", "100.00"),
+		call("registerUser", "u2", "0"),
+		call("registerRepairer", "r1"),
+		call("registerRepairer", "r2"),
+		call("registerBike", "b1"),
+		call("registerBike", "b2"),
+	}
+	rideOngoing = steps(registered, []invocation{call("startRide", "u1", "ride1", "b1", "8.54", "47.37")})
+	rideCompleted = steps(rideOngoing, []invocation{call("endRide", "u1", "ride1", "8.55", "47.38")})
+	issueOpen = steps(rideCompleted, []invocation{call("reportIssue", "u1", "i1", "ride1")})
+	repairRequested = steps(registered, []invocation{call("requestRepair", "rep1", "b1", "r1")})
+	repairAccepted = steps(repairRequested, []invocation{call("acceptRepair", "r1", "rep1")})
+	repairRejected = steps(repairRequested, []invocation{call("rejectRepair", "r1", "rep1")})
+	repairCompleted = steps(repairAccepted, []invocation{call("completeRepair", "r1", "rep1")})
+	bikeDiscarded = steps(registered, []invocation{call("discardBike", "b2")})
+	bikeReserved = steps(registered, []invocation{call("reserveBike", "u1", "b1"), call("registerUser", "u3", "5")})
+	// Each transaction of the test stub is a minute apart, so the reservation has expired by the next one
+	bikeReservationExpired = steps([]invocation{call("setConfig", CONFIG_RESERVATION_MINUTES, "1")}, registered, []invocation{call("reserveBike", "u1", "b1")})
+	stationsRegistered = steps(registered, []invocation{
+		call("registerStation", "s1", "8.54", "47.37", "2"),
+		call("registerStation", "s2", "8.55", "47.38", "1"),
+	})
+	serviceArea = `[[8.50, 47.30], [8.60, 47.30], [8.60, 47.40], [8.50, 47.40]]`
+	noParking = `[[8.545, 47.375], [8.555, 47.375], [8.555, 47.385], [8.545, 47.385]]`
+	preferredParking = `[[8.535, 47.365], [8.545, 47.365], [8.545, 47.375], [8.535, 47.375]]`
+	zonesDefined = steps(registered, []invocation{
+		call("defineZone", "z1", ZONE_SERVICE_AREA, serviceArea, "5.00"),
+		call("defineZone", "z2", ZONE_NO_PARKING, noParking, "2.00"),
+		call("defineZone", "z3", ZONE_PREFERRED_PARKING, preferredParking, "0.50"),
+	})
+	trackSamples = `[{"longitude": 8.545, "latitude": 47.375, "time": "2018-06-01T08:07:00Z"}]`
+	bikeDocked = steps(stationsRegistered, []invocation{
+		call("startRide", "u1", "ride1", "b1", "8.54", "47.37"),
+		call("endRide", "u1", "ride1", "8.55", "47.38", "", "s2"),
+	})
+)
+
+type transactionTest struct {
+	name		string
+	setup		[]invocation
+	call		invocation
+	err			string				// Expected error substring; empty when the call must succeed
+	states		map[string]string	// Expected statuses after the call, keyed by "DOC_TYPE/ID"
+	event		string				// Expected event type
+}
+
+var transactionTests = []transactionTest{
+	{"registerUser", nil, call("registerUser", "u1", "12.50"), "", map[string]string{"USER/u1": USER_FREE}, EVENT_USER_REGISTERED},
+	{"registerUser duplicate", registered, call("registerUser", "u1", "12.50"), "User u1 already exists.", nil, ""},
+	{"registerUser malformed balance", nil, call("registerUser", "u1", "12.505"), "Malformed amount", nil, ""},
+	{"registerUser other currency", nil, call("registerUser", "u1", "12.50 EUR"), "Currency mismatch: USD and EUR.", nil, ""},
+	{"registerUser empty ID", nil, call("registerUser", "", "12.50"), "Argument USER_ID must not be empty.", nil, ""},
+	{"registerRepairer", nil, call("registerRepairer", "r1"), "", nil, EVENT_REPAIRER_REGISTERED},
+	{"registerRepairer duplicate", registered, call("registerRepairer", "r1"), "Repairer r1 already exists.", nil, ""},
+	{"registerBike", nil, call("registerBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE}, EVENT_BIKE_REGISTERED},
+	{"registerBike duplicate", registered, call("registerBike", "b1"), "Bike b1 already exists.", nil, ""},
+
+	{"reactivateBike repaired", repairCompleted, call("reactivateBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE}, EVENT_BIKE_REACTIVATED},
+	{"reactivateBike repair rejected", repairRejected, call("reactivateBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE}, EVENT_BIKE_REACTIVATED},
+	{"reactivateBike repair requested", repairRequested, call("reactivateBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE, "REPAIR/rep1": REPAIR_CANCELLED}, EVENT_BIKE_REACTIVATED},
+	{"reactivateBike available", registered, call("reactivateBike", "b1"), "Bike b1 active.", nil, ""},
+	{"reactivateBike repairing", repairAccepted, call("reactivateBike", "b1"), "Bike b1 repairing.", nil, ""},
+	{"reactivateBike discarded", bikeDiscarded, call("reactivateBike", "b2"), "Bike b2 discarded.", nil, ""},
+	{"reactivateBike not found", registered, call("reactivateBike", "b9"), "Bike b9 not found.", nil, ""},
+
+	{"discardBike", registered, call("discardBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_DISCARDED}, EVENT_BIKE_DISCARDED},
+	{"discardBike reservation expired", bikeReservationExpired, call("discardBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_DISCARDED, "USER/u1": USER_FREE}, EVENT_BIKE_DISCARDED},
+	{"discardBike reserved", bikeReserved, call("discardBike", "b1"), "Bike b1 not available.", nil, ""},
+	{"discardBike in use", rideOngoing, call("discardBike", "b1"), "Bike b1 not available.", nil, ""},
+	{"discardBike not found", registered, call("discardBike", "b9"), "Bike b9 not found.", nil, ""},
+
+	{"updateBikeLocation", registered, call("updateBikeLocation", "b1", "8.54", "47.37"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE}, EVENT_BIKE_LOCATION_UPDATED},
+	{"updateBikeLocation discarded", bikeDiscarded, call("updateBikeLocation", "b2", "8.54", "47.37"), "Bike b2 already discarded.", nil, ""},
+	{"updateBikeLocation malformed longitude", registered, call("updateBikeLocation", "b1", "east", "47.37"), "Argument LONGITUDE: Malformed number east.", nil, ""},
+	{"updateBikeLocation longitude out of range", registered, call("updateBikeLocation", "b1", "181", "47.37"), "Argument LONGITUDE: Number 181 out of range. Expecting -180 to 180.", nil, ""},
+	{"updateBikeLocation latitude not finite", registered, call("updateBikeLocation", "b1", "8.54", "NaN"), "Argument LATITUDE: Number NaN is not finite.", nil, ""},
+	{"updateBikeLocation not found", registered, call("updateBikeLocation", "b9", "8.54", "47.37"), "Bike b9 not found.", nil, ""},
+
+	{"reserveBike", registered, call("reserveBike", "u1", "b1"), "", map[string]string{"BIKE/b1": BIKE_RESERVED, "USER/u1": USER_FREE}, EVENT_BIKE_RESERVED},
+	{"reserveBike reserved", bikeReserved, call("reserveBike", "u3", "b1"), "Bike b1 reserved by another user.", nil, ""},
+	{"reserveBike second bike", bikeReserved, call("reserveBike", "u1", "b2"), "User u1 already holds a reservation of bike b1.", nil, ""},
+	{"reserveBike after expiry", bikeReservationExpired, call("reserveBike", "u1", "b2"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE, "BIKE/b2": BIKE_RESERVED}, EVENT_BIKE_RESERVED},
+	{"reserveBike expired by another user", steps(bikeReservationExpired, []invocation{call("registerUser", "u3", "5")}), call("reserveBike", "u3", "b1"), "", map[string]string{"BIKE/b1": BIKE_RESERVED, "USER/u1": USER_FREE}, EVENT_BIKE_RESERVED},
+	{"reserveBike in use", rideOngoing, call("reserveBike", "u1", "b2"), "User u1 has an ongoing ride.", nil, ""},
+	{"reserveBike bike in use", steps(rideOngoing, []invocation{call("registerUser", "u3", "5")}), call("reserveBike", "u3", "b1"), "Bike b1 not available.", nil, ""},
+	{"reserveBike no balance", registered, call("reserveBike", "u2", "b1"), "User u2 has negative balance.", nil, ""},
+	{"reserveBike not found", registered, call("reserveBike", "u1", "b9"), "Bike b9 not found.", nil, ""},
+
+	{"cancelReservation", bikeReserved, call("cancelReservation", "u1", "b1"), "", map[string]string{"BIKE/b1": BIKE_AVAILABLE, "USER/u1": USER_FREE}, EVENT_RESERVATION_CANCELLED},
+	{"cancelReservation not reserved", registered, call("cancelReservation", "u1", "b1"), "Bike b1 not reserved.", nil, ""},
+	{"cancelReservation other user", bikeReserved, call("cancelReservation", "u3", "b1"), "Bike b1 reserved by another user.", nil, ""},
+	{"cancelReservation expired", bikeReservationExpired, call("cancelReservation", "u1", "b1"), "Reservation of bike b1 expired.", nil, ""},
+
+	{"startRide", registered, call("startRide", "u1", "ride1", "b1", "8.54", "47.37"), "", map[string]string{"RIDE/ride1": RIDE_ONGOING, "USER/u1": USER_IN_RIDE, "BIKE/b1": BIKE_IN_USE}, EVENT_RIDE_STARTED},
+	{"startRide device time", registered, call("startRide", "u1", "ride1", "b1", "8.54", "47.37", "2018-06-01T08:07:30Z"), "", map[string]string{"RIDE/ride1": RIDE_ONGOING}, EVENT_RIDE_STARTED},
+	{"startRide device time skewed", registered, call("startRide", "u1", "ride1", "b1", "8.54", "47.37", "2018-06-01T09:00:00Z"), "differs from transaction time", nil, ""},
+	{"startRide user not found", registered, call("startRide", "u9", "ride1", "b1", "8.54", "47.37"), "User u9 not found.", nil, ""},
+	{"startRide user in ride", rideOngoing, call("startRide", "u1", "ride2", "b2", "8.54", "47.37"), "User u1 has another ongoing ride.", nil, ""},
+	{"startRide no balance", registered, call("startRide", "u2", "ride1", "b1", "8.54", "47.37"), "User u2 has negative balance.", nil, ""},
+	{"startRide ride exists", rideCompleted, call("startRide", "u1", "ride1", "b2", "8.54", "47.37"), "Ride ride1 already exists.", nil, ""},
+	{"startRide bike in use", steps(rideOngoing, []invocation{call("registerUser", "u3", "5")}), call("startRide", "u3", "ride2", "b1", "8.54", "47.37"), "Bike b1 not available.", nil, ""},
+	{"startRide bike not found", registered, call("startRide", "u1", "ride1", "b9", "8.54", "47.37"), "Bike b9 not found.", nil, ""},
+	{"startRide at station", bikeDocked, call("startRide", "u1", "ride2", "b1", "8.55", "47.38", "", "s2"), "", map[string]string{"BIKE/b1": BIKE_IN_USE, "STATION/s2": STATION_ACTIVE}, EVENT_RIDE_STARTED},
+	{"startRide other station", bikeDocked, call("startRide", "u1", "ride2", "b1", "8.55", "47.38", "", "s1"), "Bike b1 not docked at station s1.", nil, ""},
+	{"startRide undocked bike at station", stationsRegistered, call("startRide", "u1", "ride1", "b1", "8.54", "47.37", "", "s1"), "Bike b1 not docked at station s1.", nil, ""},
+	{"startRide reserved", bikeReserved, call("startRide", "u1", "ride1", "b1", "8.54", "47.37"), "", map[string]string{"BIKE/b1": BIKE_IN_USE, "USER/u1": USER_IN_RIDE}, EVENT_RIDE_STARTED},
+	{"startRide reserved by another user", bikeReserved, call("startRide", "u3", "ride1", "b1", "8.54", "47.37"), "Bike b1 reserved by another user.", nil, ""},
+	{"startRide holding another reservation", bikeReserved, call("startRide", "u1", "ride1", "b2", "8.54", "47.37"), "User u1 holds a reservation of bike b1.", nil, ""},
+	{"startRide reservation expired", steps(bikeReservationExpired, []invocation{call("registerUser", "u3", "5")}), call("startRide", "u3", "ride1", "b1", "8.54", "47.37"), "", map[string]string{"BIKE/b1": BIKE_IN_USE, "USER/u1": USER_FREE}, EVENT_RIDE_STARTED},
+	{"startRide malformed latitude", registered, call("startRide", "u1", "ride1", "b1", "8.54", "north"), "Argument LATITUDE: Malformed number north.", nil, ""},
+	{"startRide latitude out of range", registered, call("startRide", "u1", "ride1", "b1", "8.54", "-90.5"), "Argument LATITUDE: Number -90.5 out of range. Expecting -90 to 90.", nil, ""},
+	{"startRide longitude not finite", registered, call("startRide", "u1", "ride1", "b1", "Inf", "47.37"), "Argument LONGITUDE: Number Inf is not finite.", nil, ""},
+
+	{"endRide", rideOngoing, call("endRide", "u1", "ride1", "8.55", "47.38"), "", map[string]string{"RIDE/ride1": RIDE_COMPLETED, "USER/u1": USER_FREE, "BIKE/b1": BIKE_AVAILABLE}, EVENT_RIDE_ENDED},
+	{"endRide not in ride", registered, call("endRide", "u1", "ride1", "8.55", "47.38"), "User u1 doesn't have an ongoing ride.", nil, ""},
+	{"endRide ride not found", rideOngoing, call("endRide", "u1", "ride9", "8.55", "47.38"), "Ride ride9 not found.", nil, ""},
+	{"endRide other ride", steps(rideOngoing, []invocation{call("registerUser", "u3", "5"), call("startRide", "u3", "ride2", "b2", "8.54", "47.37")}), call("endRide", "u1", "ride2", "8.55", "47.38"), "Actual ride ride1 and requested ride ride2 not match.", nil, ""},
+	{"discardBike docked", bikeDocked, call("discardBike", "b1"), "", map[string]string{"BIKE/b1": BIKE_DISCARDED, "STATION/s2": STATION_ACTIVE}, EVENT_BIKE_DISCARDED},
+	{"requestRepair docked", bikeDocked, call("requestRepair", "rep1", "b1", "r1"), "", map[string]string{"BIKE/b1": BIKE_TO_REPAIR, "STATION/s2": STATION_ACTIVE}, EVENT_REPAIR_REQUESTED},
+	{"retireStation after discarding its bike", steps(bikeDocked, []invocation{call("discardBike", "b1")}), call("retireStation", "s2"), "", map[string]string{"STATION/s2": STATION_RETIRED}, EVENT_STATION_RETIRED},
+	{"endRide at station", steps(stationsRegistered, rideOngoing[len(registered):]), call("endRide", "u1", "ride1", "8.55", "47.38", "", "s2"), "", map[string]string{"RIDE/ride1": RIDE_COMPLETED, "STATION/s2": STATION_ACTIVE}, EVENT_RIDE_ENDED},
+	{"endRide station full", steps(bikeDocked, []invocation{call("startRide", "u1", "ride2", "b2", "8.54", "47.37")}), call("endRide", "u1", "ride2", "8.55", "47.38", "", "s2"), "Station s2 has no free dock.", nil, ""},
+	{"endRide station retired", steps(stationsRegistered, []invocation{call("retireStation", "s1")}, rideOngoing[len(registered):]), call("endRide", "u1", "ride1", "8.55", "47.38", "", "s1"), "Station s1 retired.", nil, ""},
+	{"endRide station not found", rideOngoing, call("endRide", "u1", "ride1", "8.55", "47.38", "", "s9"), "Station s9 not found.", nil, ""},
+	{"endRide malformed longitude", rideOngoing, call("endRide", "u1", "ride1", "west", "47.38"), "Argument LONGITUDE: Malformed number west.", nil, ""},
+	{"endRide longitude out of range", rideOngoing, call("endRide", "u1", "ride1", "-180.01", "47.38"), "Argument LONGITUDE: Number -180.01 out of range. Expecting -180 to 180.", nil, ""},
+	{"endRide latitude not finite", rideOngoing, call("endRide", "u1", "ride1", "8.55", "-Infinity"), "Argument LATITUDE: Number -Infinity is not finite.", nil, ""},
+
+	{"appendRideTrack", rideOngoing, call("appendRideTrack", "u1", "ride1", trackSamples), "", map[string]string{"RIDE/ride1": RIDE_ONGOING}, EVENT_RIDE_TRACK_APPENDED},
+	{"appendRideTrack not ongoing", rideCompleted, call("appendRideTrack", "u1", "ride1", trackSamples), "Ride ride1 not ongoing.", nil, ""},
+	{"appendRideTrack other user", steps(rideOngoing, []invocation{call("registerUser", "u3", "5")}), call("appendRideTrack", "u3", "ride1", trackSamples), "Actual user u1 and requested user u3 not match.", nil, ""},
+	{"appendRideTrack no samples", rideOngoing, call("appendRideTrack", "u1", "ride1", "[]"), "Between 1 and 500 samples may be appended at a time.", nil, ""},
+	{"appendRideTrack before start", rideOngoing, call("appendRideTrack", "u1", "ride1", `[{"longitude": 8.54, "latitude": 47.37, "time": "2018-06-01T08:00:00Z"}]`), "before the ride start", nil, ""},
+	{"appendRideTrack after transaction", rideOngoing, call("appendRideTrack", "u1", "ride1", `[{"longitude": 8.54, "latitude": 47.37, "time": "2018-06-01T09:00:00Z"}]`), "after the transaction time", nil, ""},
+	{"appendRideTrack out of range", rideOngoing, call("appendRideTrack", "u1", "ride1", `[{"longitude": 8.54, "latitude": 97.37, "time": "2018-06-01T08:07:00Z"}]`), "Sample 1 must have a longitude between", nil, ""},
+	{"appendRideTrack not found", rideOngoing, call("appendRideTrack", "u1", "ride9", trackSamples), "Ride ride9 not found.", nil, ""},
+
+	{"voidRide", rideOngoing, call("voidRide", "ride1"), "", map[string]string{"RIDE/ride1": RIDE_VOIDED, "USER/u1": USER_FREE, "BIKE/b1": BIKE_AVAILABLE}, EVENT_RIDE_VOIDED},
+	{"voidRide completed", rideCompleted, call("voidRide", "ride1"), "Ride ride1 not ongoing.", nil, ""},
+	{"voidRide not found", rideOngoing, call("voidRide", "ride9"), "Ride ride9 not found.", nil, ""},
+
+	{"reportIssue", rideCompleted, call("reportIssue", "u1", "i1", "ride1"), "", map[string]string{"ISSUE/i1": ISSUE_OPEN, "RIDE/ride1": RIDE_ISSUE_OPEN}, EVENT_ISSUE_REPORTED},
+	{"reportIssue ride ongoing", rideOngoing, call("reportIssue", "u1", "i1", "ride1"), "Ride ride1 not completed.", nil, ""},
+	{"reportIssue other user", rideCompleted, call("reportIssue", "u2", "i1", "ride1"), "Actual user u1 and requested user u2 not match.", nil, ""},
+	{"reportIssue duplicate", issueOpen, call("reportIssue", "u1", "i1", "ride1"), "Issue i1 already exists.", nil, ""},
+	{"reportIssue ride not found", rideCompleted, call("reportIssue", "u1", "i1", "ride9"), "Ride ride9 not found.", nil, ""},
+
+	{"acceptIssue", issueOpen, call("acceptIssue", "i1"), "", map[string]string{"ISSUE/i1": ISSUE_CLOSED, "RIDE/ride1": RIDE_ISSUE_CLOSED}, EVENT_ISSUE_ACCEPTED},
+	{"acceptIssue closed", steps(issueOpen, []invocation{call("rejectIssue", "i1")}), call("acceptIssue", "i1"), "Issue i1 not open.", nil, ""},
+	{"acceptIssue not found", issueOpen, call("acceptIssue", "i9"), "Issue i9 not found.", nil, ""},
+
+	{"rejectIssue", issueOpen, call("rejectIssue", "i1"), "", map[string]string{"ISSUE/i1": ISSUE_CLOSED, "RIDE/ride1": RIDE_ISSUE_CLOSED}, EVENT_ISSUE_REJECTED},
+	{"rejectIssue closed", steps(issueOpen, []invocation{call("acceptIssue", "i1")}), call("rejectIssue", "i1"), "Issue i1 not open.", nil, ""},
+	{"rejectIssue not found", issueOpen, call("rejectIssue", "i9"), "Issue i9 not found.", nil, ""},
+
+	{"requestRepair", registered, call("requestRepair", "rep1", "b1", "r1"), "", map[string]string{"REPAIR/rep1": REPAIR_REQUESTED, "BIKE/b1": BIKE_TO_REPAIR}, EVENT_REPAIR_REQUESTED},
+	{"requestRepair bike in use", rideOngoing, call("requestRepair", "rep1", "b1", "r1"), "Bike b1 not available.", nil, ""},
+	{"requestRepair repairer not found", registered, call("requestRepair", "rep1", "b1", "r9"), "Repairer r9 not found.", nil, ""},
+	{"requestRepair duplicate", repairRequested, call("requestRepair", "rep1", "b2", "r1"), "Repair rep1 already exists.", nil, ""},
+
+	{"acceptRepair", repairRequested, call("acceptRepair", "r1", "rep1"), "", map[string]string{"REPAIR/rep1": REPAIR_ACCEPTED, "BIKE/b1": BIKE_REPAIRING}, EVENT_REPAIR_ACCEPTED},
+	{"acceptRepair other repairer", repairRequested, call("acceptRepair", "r2", "rep1"), "Actual repairer r1 and requested repairer r2 not match.", nil, ""},
+	{"acceptRepair processed", repairRejected, call("acceptRepair", "r1", "rep1"), "Repair rep1 already processed.", nil, ""},
+	{"acceptRepair cancelled", steps(repairRequested, []invocation{call("reactivateBike", "b1")}), call("acceptRepair", "r1", "rep1"), "Repair rep1 already processed.", nil, ""},
+	{"acceptRepair repairer not found", repairRequested, call("acceptRepair", "r9", "rep1"), "Repairer r9 not found.", nil, ""},
+
+	{"rejectRepair", repairRequested, call("rejectRepair", "r1", "rep1"), "", map[string]string{"REPAIR/rep1": REPAIR_REJECTED, "BIKE/b1": BIKE_TO_REPAIR}, EVENT_REPAIR_REJECTED},
+	{"rejectRepair processed", repairAccepted, call("rejectRepair", "r1", "rep1"), "Repair rep1 already processed.", nil, ""},
+	{"rejectRepair not found", repairRequested, call("rejectRepair", "r1", "rep9"), "Repair rep9 not found.", nil, ""},
+
+	{"completeRepair", repairAccepted, call("completeRepair", "r1", "rep1"), "", map[string]string{"REPAIR/rep1": REPAIR_COMPLETED, "BIKE/b1": BIKE_REPAIRED}, EVENT_REPAIR_COMPLETED},
+	{"completeRepair not accepted", repairRequested, call("completeRepair", "r1", "rep1"), "Repair rep1 not accepted.", nil, ""},
+	{"completeRepair other repairer", repairAccepted, call("completeRepair", "r2", "rep1"), "Actual repairer r1 and requested repairer r2 not match.", nil, ""},
+
+	{"registerStation", nil, call("registerStation", "s1", "8.54", "47.37", "10"), "", map[string]string{"STATION/s1": STATION_ACTIVE}, EVENT_STATION_REGISTERED},
+	{"registerStation duplicate", stationsRegistered, call("registerStation", "s1", "8.54", "47.37", "10"), "Station s1 already exists.", nil, ""},
+	{"registerStation no docks", nil, call("registerStation", "s1", "8.54", "47.37", "0"), "Capacity must be between 1 and 500.", nil, ""},
+
+	{"resizeStation", bikeDocked, call("resizeStation", "s2", "4"), "", map[string]string{"STATION/s2": STATION_ACTIVE}, EVENT_STATION_RESIZED},
+	{"resizeStation docked slot removed", steps(bikeDocked, []invocation{call("startRide", "u1", "ride2", "b2", "8.54", "47.37"), call("endRide", "u1", "ride2", "8.54", "47.37", "", "s1"), call("resizeStation", "s2", "2"), call("startRide", "u1", "ride3", "b1", "8.55", "47.38", "", "s2"), call("endRide", "u1", "ride3", "8.54", "47.37", "", "s1")}), call("resizeStation", "s1", "1"), "Station s1 has bike b1 docked in slot 2.", nil, ""},
+	{"resizeStation retired", steps(stationsRegistered, []invocation{call("retireStation", "s1")}), call("resizeStation", "s1", "4"), "Station s1 retired.", nil, ""},
+	{"resizeStation too large", stationsRegistered, call("resizeStation", "s1", "501"), "Capacity must be between 1 and 500.", nil, ""},
+
+	{"retireStation", stationsRegistered, call("retireStation", "s1"), "", map[string]string{"STATION/s1": STATION_RETIRED}, EVENT_STATION_RETIRED},
+	{"retireStation bikes docked", bikeDocked, call("retireStation", "s2"), "Station s2 has bikes docked.", nil, ""},
+	{"retireStation retired", steps(stationsRegistered, []invocation{call("retireStation", "s1")}), call("retireStation", "s1"), "Station s1 retired.", nil, ""},
+
+	{"defineZone", nil, call("defineZone", "z1", ZONE_SERVICE_AREA, serviceArea, "5.00"), "", map[string]string{"ZONE/z1": ZONE_ACTIVE}, EVENT_ZONE_DEFINED},
+	{"defineZone duplicate", zonesDefined, call("defineZone", "z1", ZONE_NO_PARKING, noParking, "1.00"), "Zone z1 already exists.", nil, ""},
+	{"defineZone two vertices", nil, call("defineZone", "z1", ZONE_NO_PARKING, `[[8.54, 47.37], [8.55, 47.38]]`, "1.00"), "Polygon must have between 3 and 1000 vertices.", nil, ""},
+	{"defineZone latitude out of range", nil, call("defineZone", "z1", ZONE_NO_PARKING, `[[8.54, 47.37], [8.55, 47.38], [8.55, 97.38]]`, "1.00"), "Vertex 3 must be a [longitude, latitude] pair.", nil, ""},
+	{"defineZone fee other currency", nil, call("defineZone", "z1", ZONE_NO_PARKING, noParking, "2.00 EUR"), "Currency mismatch: USD and EUR.", nil, ""},
+	{"defineZone unknown type", nil, call("defineZone", "z1", "ZONE_SCENIC", serviceArea, "1.00"), "Argument ZONE_TYPE: Unknown value ZONE_SCENIC.", nil, ""},
+
+	{"removeZone", zonesDefined, call("removeZone", "z2"), "", map[string]string{"ZONE/z2": ZONE_REMOVED}, EVENT_ZONE_REMOVED},
+	{"removeZone removed", steps(zonesDefined, []invocation{call("removeZone", "z2")}), call("removeZone", "z2"), "Zone z2 removed.", nil, ""},
+	{"removeZone not found", zonesDefined, call("removeZone", "z9"), "Zone z9 not found.", nil, ""},
+
+	{"topUpBalance", registered, call("topUpBalance", "u2", "20.00"), "", nil, EVENT_BALANCE_TOPPED_UP},
+	{"topUpBalance not positive", registered, call("topUpBalance", "u2", "0"), "Amount must be positive.", nil, ""},
+	{"topUpBalance other currency", registered, call("topUpBalance", "u2", "20.00 EUR"), "Currency mismatch", nil, ""},
+	{"topUpBalance not found", registered, call("topUpBalance", "u9", "20.00"), "User u9 not found.", nil, ""},
+
+	{"withdrawBalance", registered, call("withdrawBalance", "u1", "100.00"), "", nil, EVENT_BALANCE_WITHDRAWN},
+	{"withdrawBalance insufficient", registered, call("withdrawBalance", "u1", "100.01"), "User u1 has insufficient available balance 100.00 USD for 100.01 USD.", nil, ""},
+	{"withdrawBalance zero", registered, call("withdrawBalance", "u1", "0.00"), "Amount must be positive.", nil, ""},
+
+	{"transferBalance", registered, call("transferBalance", "u1", "u2", "40.00"), "", nil, EVENT_BALANCE_TRANSFERRED},
+	{"transferBalance insufficient", registered, call("transferBalance", "u2", "u1", "1.00"), "User u2 has insufficient available balance 0.00 USD for 1.00 USD.", nil, ""},
+	{"transferBalance to itself", registered, call("transferBalance", "u1", "u1", "1.00"), "User u1 cannot transfer to itself.", nil, ""},
+	{"transferBalance recipient not found", registered, call("transferBalance", "u1", "u9", "1.00"), "User u9 not found.", nil, ""},
+
+	{"setTariff", nil, call("setTariff", "1.00", "0.15", "5", "15.00", ROUNDING_UP), "", nil, EVENT_TARIFF_SET},
+	{"setTariff unknown rounding", nil, call("setTariff", "1.00", "0.15", "5", "15.00", "ROUNDING_SIDEWAYS"), "Argument ROUNDING: Unknown value ROUNDING_SIDEWAYS.", nil, ""},
+	{"setTariff other currency", nil, call("setTariff", "1.00 EUR", "0.15 EUR", "5", "15.00 EUR", ROUNDING_UP), "Currency mismatch: USD and EUR.", nil, ""},
+	{"setTariff mixed currencies", nil, call("setTariff", "1.00 EUR", "0.15", "5", "15.00", ROUNDING_UP), "Tariff amounts must share one currency.", nil, ""},
+
+	{"setConfig", nil, call("setConfig", CONFIG_MAX_CLOCK_SKEW, "60"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig rich queries", nil, call("setConfig", CONFIG_RICH_QUERIES, "false"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig hold policy", nil, call("setConfig", CONFIG_HOLD_POLICY, HOLD_DEPOSIT), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig hold deposit", nil, call("setConfig", CONFIG_HOLD_DEPOSIT, "20.00"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig unknown hold policy", nil, call("setConfig", CONFIG_HOLD_POLICY, "HOLD_ALL"), "Unknown hold policy HOLD_ALL.", nil, ""},
+	{"setConfig deposit other currency", nil, call("setConfig", CONFIG_HOLD_DEPOSIT, "5.00 EUR"), "Currency mismatch: USD and EUR.", nil, ""},
+	{"setConfig malformed deposit", nil, call("setConfig", CONFIG_HOLD_DEPOSIT, "twenty"), "Malformed amount", nil, ""},
+	{"setConfig reservation minutes", nil, call("setConfig", CONFIG_RESERVATION_MINUTES, "10"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig reservation minutes out of range", nil, call("setConfig", CONFIG_RESERVATION_MINUTES, "0"), "Reservation minutes must be between 1 and 1440.", nil, ""},
+	{"setConfig no-show fee", nil, call("setConfig", CONFIG_NO_SHOW_FEE, "2.00"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig no-show fee other currency", nil, call("setConfig", CONFIG_NO_SHOW_FEE, "2.00 EUR"), "Currency mismatch: USD and EUR.", nil, ""},
+	{"setConfig no-show allowance", nil, call("setConfig", CONFIG_NO_SHOW_ALLOWANCE, "0"), "", nil, EVENT_CONFIG_CHANGED},
+	{"setConfig negative no-show allowance", nil, call("setConfig", CONFIG_NO_SHOW_ALLOWANCE, "-1"), "No-show allowance must not be negative.", nil, ""},
+	{"setConfig unknown setting", nil, call("setConfig", "MAX_SPEED", "25"), "Argument SETTING: Unknown value MAX_SPEED.", nil, ""},
+	{"setConfig negative skew", nil, call("setConfig", CONFIG_MAX_CLOCK_SKEW, "-1"), "Maximum clock skew must not be negative.", nil, ""},
+
+	{"rebuildIndexes", rideCompleted, call("rebuildIndexes"), "", nil, ""},
+	{"rebuildIndexes unindexed type", nil, call("rebuildIndexes", TARIFF), "Argument DOC_TYPE: Unknown value TARIFF.", nil, ""},
+
+	{"setAccessControlList malformed", nil, call("setAccessControlList", "{"), "Argument ACL_JSON: Malformed JSON.", nil, ""},
+	{"setAccessControlList drops admin attribute", nil, call("setAccessControlList", `{"roles": {"PROVIDER": []}, "rules": {"setAccessControlList": {"roles": ["PROVIDER"]}}}`), "ACL must require attribute bsn.admin=true for setAccessControlList.", nil, ""},
+	{"setAccessControlList locks out admin", nil, call("setAccessControlList", `{"roles": {}, "rules": {}}`), "ACL must keep a rule allowing setAccessControlList.", nil, ""},
+}
+
+func TestTransactions(t *testing.T) {
+	aclBytes, err := json.Marshal(getDefaultAccessControlList())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := append(transactionTests, transactionTest{"setAccessControlList", nil, call("setAccessControlList", string(aclBytes)), "", nil, EVENT_ACL_REPLACED})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := newTestStub(t)
+			for _, step := range test.setup {
+				stub.mustInvoke(step.function, step.args...)
+			}
+			eventCount := len(stub.Events)
+
+			response := stub.invoke(test.call.function, test.call.args...)
+			if test.err != "" {
+				if response.Status == shim.OK {
+					t.Fatalf("%s succeeded; expected error %q", test.call.function, test.err)
+				}
+				failure := decodeError(t, response)
+				if !strings.Contains(failure.Message, test.err) {
+					t.Fatalf("%s failed with %q; expected %q", test.call.function, failure.Message, test.err)
+				}
+				if len(stub.Events) != eventCount {
+					t.Errorf("%s failed but emitted an event", test.call.function)
+				}
+				return
+			}
+			if response.Status != shim.OK {
+				t.Fatalf("%s failed: %s", test.call.function, response.Message)
+			}
+
+			for entity, expected := range test.states {
+				parts := strings.SplitN(entity, "/", 2)
+				actual := stub.status(parts[0], parts[1])
+				if actual != expected {
+					t.Errorf("%s status %q; expected %q", entity, actual, expected)
+				}
+			}
+			if test.event != "" {
+				if len(stub.Events) != eventCount + 1 {
+					t.Fatalf("%s emitted no event; expected %s", test.call.function, test.event)
+				}
+				event := stub.lastEvent()
+				if event.Type != test.event || event.SchemaVersion != EVENT_SCHEMA_VERSION || event.TxId != stub.txID(stub.txCount) {
+					t.Errorf("Event %+v; expected type %s in transaction %s", event, test.event, stub.txID(stub.txCount))
+				}
+				for _, change := range event.Changes {
+					if expected, ok := test.states[change.EntityType + "/" + change.EntityId]; ok && change.NewStatus != expected {
+						t.Errorf("Event change %+v; expected new status %s", change, expected)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Events name the calling identity, and the user or repairer it acts as
+func TestEventActor(t *testing.T) {
+	stub := newNetworkTestStub(t)
+
+	stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "operator1", nil)
+	stub.mustInvoke("registerBike", "b1")
+	event := stub.lastEvent()
+	if !strings.HasPrefix(event.Actor, "ProviderOrgMSP/") || len(event.Actor) <= len("ProviderOrgMSP/") || event.ActingAs != "" {
+		t.Errorf("Event of a provider %+v; expected the caller's identity", event)
+	}
+	provider := event.Actor
+
+	stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "alice", map[string]string{ID_ATTRIBUTE: "u1"})
+	stub.mustInvoke("registerUser", "u1", "10.00")
+	if event = stub.lastEvent(); !strings.HasPrefix(event.Actor, "UserOrgMSP/") || event.ActingAs != "u1" {
+		t.Errorf("Event of a user %+v; expected the caller's identity acting as u1", event)
+	}
+	if event.Actor == provider {
+		t.Errorf("Events of different callers share actor %s", provider)
+	}
+}
+
+// Records are bound to the identity that registered them: another identity of the same
+// organization can neither act as their owner nor read their user-scoped records
+func TestOwnership(t *testing.T) {
+	stub := newNetworkTestStub(t)
+	creators := map[string]func(){
+		"provider": func() { stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "operator1", nil) },
+		"alice": func() { stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "alice", map[string]string{ID_ATTRIBUTE: "u1"}) },
+		"bob": func() { stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "bob", map[string]string{ID_ATTRIBUTE: "u2"}) },
+		"mallory": func() { stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "mallory", nil) },
+		"fixer1": func() { stub.setCreator("RepairerOrgMSP", "ca.repairerorg.bikeshare.com", "fixer1", map[string]string{ID_ATTRIBUTE: "r1"}) },
+		"fixer2": func() { stub.setCreator("RepairerOrgMSP", "ca.repairerorg.bikeshare.com", "fixer2", map[string]string{ID_ATTRIBUTE: "r2"}) },
+	}
+
+	tests := []struct {
+		creator			string
+		call			invocation
+		code			string		// Expected error code; empty when the call must succeed
+		message			string
+	}{
+		{"mallory", call("registerUser", "u3", "10.00"), ERR_ACCESS_DENIED, "Certificate lacks attribute bsn.id required to register u3."},
+		{"alice", call("registerUser", "u2", "10.00"), ERR_ACCESS_DENIED, "Certificate attribute bsn.id is u1, not u2."},
+		{"alice", call("registerUser", "u1", "100.00"), "", ""},
+		{"bob", call("registerUser", "u2", "10.00"), "", ""},
+		{"fixer2", call("registerRepairer", "r1"), ERR_ACCESS_DENIED, "Certificate attribute bsn.id is r2, not r1."},
+		{"fixer1", call("registerRepairer", "r1"), "", ""},
+		{"fixer2", call("registerRepairer", "r2"), "", ""},
+		{"provider", call("registerBike", "b1"), "", ""},
+		{"provider", call("registerBike", "b2"), "", ""},
+		{"bob", call("startRide", "u1", "ride1", "b1", "8.54", "47.37"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"alice", call("startRide", "u1", "ride1", "b1", "8.54", "47.37"), "", ""},
+		{"bob", call("endRide", "u1", "ride1", "8.55", "47.38"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"alice", call("endRide", "u1", "ride1", "8.55", "47.38"), "", ""},
+		{"bob", call("reportIssue", "u1", "i1", "ride1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"alice", call("reportIssue", "u1", "i1", "ride1"), "", ""},
+		{"provider", call("requestRepair", "rep1", "b2", "r1"), "", ""},
+		{"fixer2", call("acceptRepair", "r1", "rep1"), ERR_ACCESS_DENIED, "Caller not the owner of repairer r1. Access denied."},
+		{"fixer1", call("acceptRepair", "r1", "rep1"), "", ""},
+
+		// User-scoped reads
+		{"bob", call("getBalanceStatement", "u1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getUserHistory", "u1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getRidesByUser", "u1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getIssuesByUser", "u1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getRideById", "ride1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getRideTrack", "ride1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getRideHistory", "ride1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getIssueByRide", "ride1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getIssueById", "i1"), ERR_ACCESS_DENIED, "Caller not the owner of user u1. Access denied."},
+		{"bob", call("getRides"), ERR_ACCESS_DENIED, "Caller not permitted to invoke getRides. Access denied."},
+		{"bob", call("getBalanceStatement", "u2"), "", ""},
+		{"alice", call("getBalanceStatement", "u1"), "", ""},
+		{"alice", call("getRideTrack", "ride1"), "", ""},
+		{"alice", call("getIssueById", "i1"), "", ""},
+		{"provider", call("getBalanceStatement", "u1"), "", ""},
+		{"provider", call("getRideTrack", "ride1"), "", ""},
+	}
+	for _, test := range tests {
+		creators[test.creator]()
+		failure := stub.invokeError(test.call.function, test.call.args...)
+		if test.code == "" && failure != nil {
+			t.Errorf("%s %s %v: %+v", test.creator, test.call.function, test.call.args, failure)
+		}
+		if test.code != "" && (failure == nil || failure.Code != test.code || failure.Message != test.message) {
+			t.Errorf("%s %s %v: %+v; expected %s %q", test.creator, test.call.function, test.call.args, failure, test.code, test.message)
+		}
+	}
+}
+
+// Only providers carrying the admin attribute may replace the ACL
+func TestAccessControlListAdmin(t *testing.T) {
+	stub := newNetworkTestStub(t)
+	aclBytes, err := json.Marshal(getDefaultAccessControlList())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "operator1", nil)
+	failure := stub.invokeError("setAccessControlList", string(aclBytes))
+	if failure == nil || failure.Code != ERR_ACCESS_DENIED || failure.Message != "Caller lacks attribute bsn.admin required for setAccessControlList. Access denied." {
+		t.Errorf("setAccessControlList by a provider without the admin attribute: %+v", failure)
+	}
+	stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "operator1", map[string]string{ADMIN_ATTRIBUTE: "false"})
+	if failure = stub.invokeError("setAccessControlList", string(aclBytes)); failure == nil || failure.Code != ERR_ACCESS_DENIED {
+		t.Errorf("setAccessControlList by a provider with bsn.admin=false: %+v", failure)
+	}
+
+	stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "admin1", map[string]string{ADMIN_ATTRIBUTE: "true"})
+	stub.mustInvoke("setAccessControlList", string(aclBytes))
+	stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "alice", map[string]string{ADMIN_ATTRIBUTE: "true"})
+	if failure = stub.invokeError("setAccessControlList", string(aclBytes)); failure == nil || failure.Code != ERR_ACCESS_DENIED {
+		t.Errorf("setAccessControlList by a user with the admin attribute: %+v", failure)
+	}
+
+	// A table stored before a function existed leaves it to its default rule
+	acl := getDefaultAccessControlList()
+	delete(acl.Rules, "getBikesNear")
+	acl.Rules["getZones"] = AccessRule{Roles: []string{ROLE_PROVIDER}}
+	aclBytes, err = json.Marshal(acl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.setCreator("ProviderOrgMSP", "ca.providerorg.bikeshare.com", "admin1", map[string]string{ADMIN_ATTRIBUTE: "true"})
+	stub.mustInvoke("setAccessControlList", string(aclBytes))
+	stub.setCreator("UserOrgMSP", "ca.userorg.bikeshare.com", "alice", nil)
+	stub.mustInvoke("getBikesNear", "8.54", "47.37", "100")
+	if failure = stub.invokeError("getZones"); failure == nil || failure.Code != ERR_ACCESS_DENIED {
+		t.Errorf("getZones by a user after the stored rule limited it to providers: %+v", failure)
+	}
+}
+
+// Each function with too few or too many arguments
+var badArgumentTests = []invocation{
+	call("registerUser", "u1"),
+	call("registerRepairer"),
+	call("registerBike", "b1", "b2"),
+	call("reactivateBike"),
+	call("discardBike"),
+	call("updateBikeLocation", "b1", "8.54"),
+	call("reserveBike", "u1"),
+	call("cancelReservation", "u1", "b1", "b2"),
+	call("startRide", "u1", "ride1", "b1", "8.54"),
+	call("endRide", "u1", "ride1", "8.55"),
+	call("appendRideTrack", "u1", "ride1"),
+	call("voidRide"),
+	call("reportIssue", "u1", "i1"),
+	call("acceptIssue"),
+	call("rejectIssue", "i1", "i2"),
+	call("requestRepair", "rep1", "b1"),
+	call("acceptRepair", "r1"),
+	call("rejectRepair", "r1"),
+	call("completeRepair", "r1"),
+	call("registerStation", "s1", "8.54", "47.37"),
+	call("resizeStation", "s1"),
+	call("retireStation"),
+	call("defineZone", "z1", ZONE_SERVICE_AREA, serviceArea),
+	call("removeZone"),
+	call("topUpBalance", "u1"),
+	call("withdrawBalance", "u1", "1.00", "2.00"),
+	call("transferBalance", "u1", "u2"),
+	call("setTariff", "1.00", "0.15", "5", "15.00"),
+	call("setConfig", CONFIG_MAX_CLOCK_SKEW),
+	call("rebuildIndexes", BIKE, RIDE),
+	call("setAccessControlList"),
+	call("getUsers", "10", "", ""),
+	call("getRepairers", "10", "", ""),
+	call("getBikes", "10", "", ""),
+	call("getBikeById"),
+	call("getBikesByStatus"),
+	call("getBikesAtStation"),
+	call("getBikesNear", "8.54", "47.37"),
+	call("getStationsWithFreeDocks", "10", "", ""),
+	call("getZones", "10", "", ""),
+	call("checkLocation", "8.54"),
+	call("getRides", "10", "", ""),
+	call("getRideById"),
+	call("getRideTrack"),
+	call("getRidesByUser"),
+	call("getRidesByBike"),
+	call("getRidesByStatus", RIDE_ONGOING, "10", "", ""),
+	call("getIssues", "10", "", ""),
+	call("getIssueById"),
+	call("getIssuesByUser"),
+	call("getIssuesByBike"),
+	call("getIssueByRide"),
+	call("getIssuesByStatus"),
+	call("getRepairs", "10", "", ""),
+	call("getRepairById"),
+	call("getRepairsByBike"),
+	call("getRepairsByRepairer"),
+	call("getRepairsByStatus"),
+	call("getBalanceStatement"),
+	call("getUserHistory"),
+	call("getBikeHistory", "b1", "10", "", "", "", ""),
+	call("getRideHistory"),
+	call("getRepairHistory"),
+	call("getTariff", "1", "2"),
+	call("quoteRide"),
+	call("getConfig", "all"),
+	call("getAccessControlList", "all"),
+	call("getChaincodeInfo", "all"),
+	call("listFunctions", "all"),
+	call("getStateMachine"),
+}
+
+func TestBadArguments(t *testing.T) {
+	for _, test := range badArgumentTests {
+		t.Run(test.function, func(t *testing.T) {
+			stub := newTestStub(t)
+			failure := stub.invokeError(test.function, test.args...)
+			if failure == nil || failure.Code != ERR_BAD_ARGUMENT || !strings.HasPrefix(failure.Message, "Incorrect number of arguments.") {
+				t.Errorf("%s with %d arguments: %+v", test.function, len(test.args), failure)
+			}
+		})
+	}
+}
+
+type errorCodeTest struct {
+	setup		[]invocation
+	call		invocation
+	code		string
+	entityType	string
+	entityId	string
+	argIndex	int
+}
+
+var errorCodeTests = []errorCodeTest{
+	{nil, call("stealBike", "b1"), ERR_UNKNOWN_FUNCTION, "", "", -1},
+	{nil, call("registerUser", "", "12.50"), ERR_BAD_ARGUMENT, "", "", 0},
+	{registered, call("updateBikeLocation", "b1", "east", "47.37"), ERR_BAD_ARGUMENT, "", "", 1},
+	{nil, call("setTariff", "1.00", "0.15", "-1", "15.00", ROUNDING_UP), ERR_BAD_ARGUMENT, "", "", 2},
+	{nil, call("getRides", "0"), ERR_BAD_ARGUMENT, "", "", 0},
+	{registered, call("getBikeHistory", "b1", "", "", "2018-06-01T09:00:00Z", "2018-06-01T08:00:00Z"), ERR_BAD_ARGUMENT, "", "", 4},
+	{nil, call("setAccessControlList", `{"roles": {}, "rules": {}}`), ERR_INVALID_ACL, "", "", -1},
+	{registered, call("registerBike", "b1"), ERR_ALREADY_EXISTS, BIKE, "b1", -1},
+	{registered, call("reactivateBike", "b9"), ERR_NOT_FOUND, BIKE, "b9", -1},
+	{nil, call("getTariff", "7"), ERR_NOT_FOUND, TARIFF, "7", -1},
+	{registered, call("startRide", "u2", "ride1", "b1", "8.54", "47.37"), ERR_INSUFFICIENT_BALANCE, USER, "u2", -1},
+	{bikeReserved, call("startRide", "u3", "ride1", "b1", "8.54", "47.37"), ERR_BIKE_RESERVED, BIKE, "b1", -1},
+	{bikeReserved, call("reserveBike", "u1", "b2"), ERR_USER_HAS_RESERVATION, USER, "u1", -1},
+	{registered, call("cancelReservation", "u1", "b1"), ERR_BIKE_NOT_RESERVED, BIKE, "b1", -1},
+	{steps(rideOngoing, []invocation{call("registerUser", "u3", "5")}), call("startRide", "u3", "ride2", "b1", "8.54", "47.37"), ERR_BIKE_NOT_AVAILABLE, BIKE, "b1", -1},
+	{registered, call("startRide", "u1", "ride1", "b1", "8.54", "47.37", "2018-06-01T09:00:00Z"), ERR_DEVICE_TIME_SKEWED, "", "", -1},
+	{bikeDiscarded, call("reactivateBike", "b2"), ERR_BIKE_DISCARDED, BIKE, "b2", -1},
+	{steps(issueOpen, []invocation{call("rejectIssue", "i1")}), call("acceptIssue", "i1"), ERR_ISSUE_NOT_OPEN, ISSUE, "i1", -1},
+	{repairRequested, call("acceptRepair", "r2", "rep1"), ERR_REPAIRER_MISMATCH, REPAIR, "rep1", -1},
+	{nil, call("setTariff", "1.00 EUR", "0.15", "5", "15.00", ROUNDING_UP), ERR_CURRENCY_MISMATCH, "", "", -1},
+	{steps([]invocation{call("setConfig", CONFIG_HOLD_POLICY, HOLD_DEPOSIT), call("setConfig", CONFIG_HOLD_DEPOSIT, "10.00")}, registered, []invocation{call("registerUser", "u3", "5")}), call("startRide", "u3", "ride1", "b1", "8.54", "47.37"), ERR_INSUFFICIENT_BALANCE, USER, "u3", -1},
+	{nil, call("setConfig", CONFIG_HOLD_POLICY, "HOLD_ALL"), ERR_BAD_ARGUMENT, "", "", 1},
+	{steps(bikeDocked, []invocation{call("startRide", "u1", "ride2", "b2", "8.54", "47.37")}), call("endRide", "u1", "ride2", "8.55", "47.38", "", "s2"), ERR_STATION_FULL, STATION, "s2", -1},
+	{bikeDocked, call("startRide", "u1", "ride2", "b1", "8.55", "47.38", "", "s1"), ERR_BIKE_NOT_AT_STATION, BIKE, "b1", -1},
+	{nil, call("registerStation", "s1", "8.54", "47.37", "0"), ERR_BAD_ARGUMENT, "", "", 3},
+	{registered, call("withdrawBalance", "u2", "1.00"), ERR_INSUFFICIENT_BALANCE, USER, "u2", -1},
+	{registered, call("transferBalance", "u1", "u2", "1.00 EUR"), ERR_CURRENCY_MISMATCH, "", "", 2},
+	{nil, call("registerUser", "u1", "1.00 EUR"), ERR_CURRENCY_MISMATCH, "", "", 1},
+	{registered, call("topUpBalance", "u1", "0.00"), ERR_BAD_ARGUMENT, "", "", 1},
+}
+
+// Failures carry a code, the offending entity and the index of the offending argument
+func TestErrorCodes(t *testing.T) {
+	for _, test := range errorCodeTests {
+		stub := newTestStub(t)
+		for _, step := range test.setup {
+			stub.mustInvoke(step.function, step.args...)
+		}
+
+		failure := stub.invokeError(test.call.function, test.call.args...)
+		if failure == nil {
+			t.Errorf("%s %v succeeded; expected %s", test.call.function, test.call.args, test.code)
+			continue
+		}
+		if failure.Code != test.code || failure.EntityType != test.entityType || failure.EntityId != test.entityId || failure.ArgIndex != test.argIndex {
+			t.Errorf("%s %v failed with %+v; expected %s %s/%s argument %d", test.call.function, test.call.args, failure, test.code, test.entityType, test.entityId, test.argIndex)
+		}
+	}
+}
+
+func TestUnknownFunction(t *testing.T) {
+	stub := newTestStub(t)
+	failure := stub.invokeError("stealBike", "b1")
+	if failure == nil || failure.Code != ERR_UNKNOWN_FUNCTION || failure.Message != "Invalid invoke function name." {
+		t.Errorf("Unknown function: %+v", failure)
+	}
+}
+
+// Ledger with several records of each type for the query tests
+var queryFixture = steps(issueOpen, []invocation{
+	call("startRide", "u1", "ride2", "b2", "8.54", "47.37"),
+	call("endRide", "u1", "ride2", "8.55", "47.38"),
+	call("registerUser", "u3", "20.00"),
+	call("startRide", "u3", "ride3", "b1", "8.54", "47.37"),
+	call("registerBike", "b3"),
+	call("requestRepair", "rep1", "b3", "r1"),
+	call("acceptRepair", "r1", "rep1"),
+	call("registerBike", "b4"),
+	call("requestRepair", "rep2", "b4", "r2"),
+	call("registerStation", "s1", "8.54", "47.37", "2"),
+	call("registerStation", "s2", "8.55", "47.38", "1"),
+	call("registerStation", "s3", "8.56", "47.39", "1"),
+	call("retireStation", "s3"),
+	call("defineZone", "z1", ZONE_SERVICE_AREA, serviceArea, "5.00"),
+	call("defineZone", "z2", ZONE_NO_PARKING, noParking, "2.00"),
+	call("removeZone", "z2"),
+})
+
+type queryTest struct {
+	call		invocation
+	ids			[]string	// Expected record IDs in order
+	err			string		// Expected error substring
+}
+
+var queryTests = []queryTest{
+	{call("getUsers"), []string{"u1", "u2", "u3"}, ""},
+	{call("getRepairers"), []string{"r1", "r2"}, ""},
+	{call("getBikes"), []string{"b1", "b2", "b3", "b4"}, ""},
+	{call("getBikeById", "b2"), []string{"b2"}, ""},
+	{call("getBikeById", "b9"), []string{}, ""},
+	{call("getBikesByStatus", BIKE_AVAILABLE), []string{"b2"}, ""},
+	{call("getBikesByStatus", BIKE_IN_USE), []string{"b1"}, ""},
+	{call("getBikesByStatus", BIKE_REPAIRING), []string{"b3"}, ""},
+	{call("getBikesByStatus", "BIKE_STOLEN"), nil, "Argument STATUS: Unknown value BIKE_STOLEN."},
+	{call("getBikesAtStation", "s1"), []string{}, ""},
+	{call("getBikesNear", "8.55", "47.38", "100"), []string{"b2"}, ""},
+	{call("getBikesNear", "8.54", "47.37", "100"), []string{}, ""},
+	{call("getBikesNear", "8.54", "47.37", "2000", "1"), []string{"b2"}, ""},
+	{call("getBikesNear", "8.54", "47.37", "50001"), nil, "Radius must be positive and at most 50000 meters."},
+	{call("getBikesNear", "8.54", "47.37", "100", "101"), nil, "Limit must be between 1 and 100."},
+	{call("getBikesNear", "181", "47.37", "100"), nil, "Argument LONGITUDE: Number 181 out of range. Expecting -180 to 180."},
+	{call("getBikesNear", "8.54", "47.37", "NaN"), nil, "Argument RADIUS_METERS: Number NaN is not finite."},
+	{call("getStationsWithFreeDocks"), []string{"s1", "s2"}, ""},
+	{call("getStationsWithFreeDocks", "1001"), nil, "Page size must be between 1 and 1000."},
+	{call("getZones"), []string{"z1", "z2"}, ""},
+	{call("getZones", "-1"), nil, "Page size must be between 1 and 1000."},
+	{call("checkLocation", "8.54", "north"), nil, "Argument LATITUDE: Malformed number north."},
+	{call("getRides"), []string{"ride1", "ride2", "ride3"}, ""},
+	{call("getRideById", "ride2"), []string{"ride2"}, ""},
+	{call("getRideTrack", "ride9"), nil, "Ride ride9 not found."},
+	{call("getRidesByUser", "u1"), []string{"ride1", "ride2"}, ""},
+	{call("getRidesByUser", `u1", "docType": {"$gt": ""`), []string{}, ""},
+	{call("getRidesByBike", "b1"), []string{"ride1", "ride3"}, ""},
+	{call("getRidesByStatus", RIDE_ISSUE_OPEN), []string{"ride1"}, ""},
+	{call("getRidesByStatus", RIDE_ONGOING), []string{"ride3"}, ""},
+	{call("getRidesByStatus", ISSUE_OPEN), nil, "Argument STATUS: Unknown value ISSUE_OPEN."},
+	{call("getIssues"), []string{"i1"}, ""},
+	{call("getIssueById", "i1"), []string{"i1"}, ""},
+	{call("getIssuesByUser", "u1"), []string{"i1"}, ""},
+	{call("getIssuesByUser", "u2"), []string{}, ""},
+	{call("getIssuesByBike", "b1"), []string{"i1"}, ""},
+	{call("getIssueByRide", "ride1"), []string{"i1"}, ""},
+	{call("getIssuesByStatus", ISSUE_OPEN), []string{"i1"}, ""},
+	{call("getIssuesByStatus", "ISSUE_LOST"), nil, "Argument STATUS: Unknown value ISSUE_LOST."},
+	{call("getRepairs"), []string{"rep1", "rep2"}, ""},
+	{call("getRepairById", "rep2"), []string{"rep2"}, ""},
+	{call("getRepairsByBike", "b3"), []string{"rep1"}, ""},
+	{call("getRepairsByRepairer", "r2"), []string{"rep2"}, ""},
+	{call("getRepairsByStatus", REPAIR_REQUESTED), []string{"rep2"}, ""},
+	{call("getRepairsByStatus", "REPAIR_LOST"), nil, "Argument STATUS: Unknown value REPAIR_LOST."},
+	{call("getBalanceStatement", "u1"), []string{"u1-0000000001", "u1-0000000002", "u1-0000000003"}, ""},
+	{call("getBalanceStatement", "u2"), []string{}, ""},
+	{call("getBalanceStatement", "u1", "0"), nil, "Page size must be between 1 and 1000."},
+	{call("getStateMachine", TARIFF), nil, "Argument OBJECT_TYPE: Unknown value TARIFF."},
+	{call("getRides", "0"), nil, "Page size must be between 1 and 1000."},
+	{call("getRides", "ten"), nil, "Argument PAGE_SIZE: Malformed integer ten."},
+	{call("getRides", "10", "%%%"), nil, "Malformed bookmark %%%."},
+}
+
+// Decode the IDs of the records of a query page or plain record array
+func recordIDs(t *testing.T, payload []byte) []string {
+	var records []QueryRecord
+	if strings.HasPrefix(string(payload), "[") {
+		err := json.Unmarshal(payload, &records)
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		var page struct {
+			Records		[]QueryRecord	`json:"records"`
+			FetchedCount	int			`json:"fetchedCount"`
+		}
+		err := json.Unmarshal(payload, &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.FetchedCount != len(page.Records) {
+			t.Errorf("Fetched count %d for %d records", page.FetchedCount, len(page.Records))
+		}
+		records = page.Records
+	}
+
+	ids := []string{}
+	for _, record := range records {
+		var document struct {
+			Id			string		`json:"id"`
+		}
+		err := json.Unmarshal(record.Value, &document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, document.Id)
+	}
+	return ids
+}
+
+// Run a test against the rich query shim and against the key indexes
+func forEachQueryPath(t *testing.T, test func(t *testing.T, stub *testStub)) {
+	for _, richQueries := range []bool{true, false} {
+		t.Run(fmt.Sprintf("richQueries=%t", richQueries), func(t *testing.T) {
+			stub := newTestStub(t)
+			stub.mustInvoke("setConfig", CONFIG_RICH_QUERIES, strconv.FormatBool(richQueries))
+			test(t, stub)
+		})
+	}
+}
+
+func TestQueries(t *testing.T) {
+	forEachQueryPath(t, func(t *testing.T, stub *testStub) {
+		for _, step := range queryFixture {
+			stub.mustInvoke(step.function, step.args...)
+		}
+
+		for _, test := range queryTests {
+			response := stub.invoke(test.call.function, test.call.args...)
+			if test.err != "" {
+				if response.Status == shim.OK || !strings.Contains(decodeError(t, response).Message, test.err) {
+					t.Errorf("%s %v: %q; expected error %q", test.call.function, test.call.args, response.Message, test.err)
+				}
+				continue
+			}
+			if response.Status != shim.OK {
+				t.Errorf("%s %v failed: %s", test.call.function, test.call.args, response.Message)
+				continue
+			}
+			ids := recordIDs(t, response.Payload)
+			if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+				t.Errorf("%s %v returned %v; expected %v", test.call.function, test.call.args, ids, test.ids)
+			}
+		}
+	})
+}
+
+func TestPagination(t *testing.T) {
+	forEachQueryPath(t, func(t *testing.T, stub *testStub) {
+		for _, step := range queryFixture {
+			stub.mustInvoke(step.function, step.args...)
+		}
+
+		ids := []string{}
+		bookmark := ""
+		for pages := 0; pages < 10; pages++ {
+			var page QueryPage
+			payload := stub.mustInvoke("getRidesByBike", "b1", "1", bookmark)
+			ids = append(ids, recordIDs(t, payload)...)
+			err := json.Unmarshal(payload, &page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bookmark = page.Bookmark
+			if bookmark == "" {
+				break
+			}
+		}
+		if strings.Join(ids, ",") != "ride1,ride3" {
+			t.Errorf("Pages returned %v; expected [ride1 ride3]", ids)
+		}
+
+		// Unfiltered queries page through the whole object type
+		ids = []string{}
+		bookmark = ""
+		for pages := 0; pages < 10; pages++ {
+			var page QueryPage
+			payload := stub.mustInvoke("getRides", "2", bookmark)
+			ids = append(ids, recordIDs(t, payload)...)
+			err := json.Unmarshal(payload, &page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bookmark = page.Bookmark
+			if bookmark == "" {
+				break
+			}
+		}
+		if strings.Join(ids, ",") != "ride1,ride2,ride3" {
+			t.Errorf("Pages returned %v; expected [ride1 ride2 ride3]", ids)
+		}
+	})
+}
+
+// The RICH_QUERIES setting alone picks the query path; a failed rich query is never
+// retried on the key indexes
+func TestRichQuerySetting(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range queryFixture {
+		stub.mustInvoke(step.function, step.args...)
+	}
+
+	stub.QueryError = errors.New("GET_QUERY_RESULT failed: ExecuteQuery not supported for leveldb")
+	failure := stub.invokeError("getRidesByBike", "b1")
+	if failure == nil || failure.Code != ERR_INTERNAL || failure.Message != stub.QueryError.Error() {
+		t.Errorf("Rides with rich queries refused: %+v", failure)
+	}
+
+	stub.mustInvoke("setConfig", CONFIG_RICH_QUERIES, "false")
+	ids := recordIDs(t, stub.mustInvoke("getRidesByBike", "b1"))
+	if strings.Join(ids, ",") != "ride1,ride3" {
+		t.Errorf("Rides with rich queries disabled %v; expected [ride1 ride3]", ids)
+	}
+}
+
+// Chaincode running a function as its Invoke transaction
+type transactionFunc func(stub shim.ChaincodeStubInterface) pb.Response
+
+func (f transactionFunc) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (f transactionFunc) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	return f(stub)
+}
+
+// An entity written twice in a transaction keeps only the index entries of its last value,
+// although the transaction reads the committed value both times
+func TestIndexesFollowWritesInTransaction(t *testing.T) {
+	stub := shimtest.NewStub("indexes", transactionFunc(func(stub shim.ChaincodeStubInterface) pb.Response {
+		txStub := newTransactionStub(stub)
+		key, err := getBikeKey(txStub, "b1")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		for _, status := range []string{BIKE_RESERVED, BIKE_AVAILABLE, BIKE_IN_USE} {
+			err = putState(txStub, key, []byte(fmt.Sprintf(`{"docType": %q, "id": "b1", "status": %q}`, BIKE, status)))
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		return shim.Success(nil)
+	}))
+	if response := stub.MockInvoke("tx1", nil); response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+
+	for _, status := range []string{BIKE_RESERVED, BIKE_AVAILABLE, BIKE_IN_USE} {
+		key, err := createIndexKey("status~bike", []string{status, "b1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := stub.State[key]; ok != (status == BIKE_IN_USE) {
+			t.Errorf("Index entry of b1 as %s present %t; expected %t", status, ok, status == BIKE_IN_USE)
+		}
+	}
+}
+
+// Index entries must follow the records through every transition
+func TestIndexesFollowTransitions(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setConfig", CONFIG_RICH_QUERIES, "false")
+	for _, step := range repairCompleted {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("reactivateBike", "b1")
+
+	for _, status := range []string{BIKE_TO_REPAIR, BIKE_REPAIRING, BIKE_REPAIRED} {
+		ids := recordIDs(t, stub.mustInvoke("getBikesByStatus", status))
+		if len(ids) != 0 {
+			t.Errorf("Bikes %v still indexed as %s", ids, status)
+		}
+	}
+	ids := recordIDs(t, stub.mustInvoke("getBikesByStatus", BIKE_AVAILABLE))
+	if strings.Join(ids, ",") != "b1,b2" {
+		t.Errorf("Available bikes %v; expected [b1 b2]", ids)
+	}
+
+	// Rebuilding drops entries left behind and leaves exactly one entry per record and index
+	stub.MockTransactionStart("direct")
+	staleKey, err := createIndexKey("status~bike", []string{BIKE_TO_REPAIR, "b1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.PutState(staleKey, indexEntryValue)
+	stub.MockTransactionEnd("direct")
+	stub.mustInvoke("rebuildIndexes")
+	ids = recordIDs(t, stub.mustInvoke("getBikesByStatus", BIKE_AVAILABLE))
+	if strings.Join(ids, ",") != "b1,b2" {
+		t.Errorf("Available bikes after rebuild %v; expected [b1 b2]", ids)
+	}
+	if _, ok := stub.State[staleKey]; ok {
+		t.Errorf("Stale index entry %q kept by rebuild", staleKey)
+	}
+}
+
+func TestRideFare(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setTariff", "1.00", "0.20", "1", "0", ROUNDING_UP)
+	for _, step := range registered {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("startRide", "u1", "ride1", "b1", "8.54", "47.37")
+	stub.TxTime = stub.TxTime.Add(28 * time.Minute + 30 * time.Second)
+	stub.mustInvoke("endRide", "u1", "ride1", "8.55", "47.38")
+
+	// 30 minutes rounded up, 1 free: 1.00 + 29 * 0.20
+	var ride *Ride
+	rides := []QueryRecord{}
+	err := json.Unmarshal(stub.mustInvoke("getRideById", "ride1"), &rides)
+	if err != nil || len(rides) != 1 {
+		t.Fatalf("getRideById: %v %v", err, rides)
+	}
+	err = json.Unmarshal(rides[0].Value, &ride)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ride.Cost != (Money{680, DEFAULT_CURRENCY}) || ride.TariffVersion != 1 {
+		t.Errorf("Ride cost %s under tariff %d; expected 6.80 USD under tariff 1", ride.Cost, ride.TariffVersion)
+	}
+
+	// Accepting an issue refunds the fare
+	stub.mustInvoke("reportIssue", "u1", "i1", "ride1")
+	stub.mustInvoke("acceptIssue", "i1")
+	if user := stub.user("u1"); user.Balance != (Money{10000, DEFAULT_CURRENCY}) {
+		t.Errorf("Balance %s after refund; expected 100.00 USD", user.Balance)
+	}
+}
+
+// Every balance change leaves an entry with the resulting balance, in the order written
+func TestBalanceStatement(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setTariff", "1.00", "0.20", "1", "0", ROUNDING_UP)
+	for _, step := range issueOpen {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("acceptIssue", "i1")
+	stub.mustInvoke("topUpBalance", "u1", "5.00")
+	stub.mustInvoke("withdrawBalance", "u1", "2.50")
+	stub.mustInvoke("transferBalance", "u1", "u2", "10.00")
+
+	expected := []struct {
+		reason		string
+		amount		Money
+		balance		Money
+	}{
+		{REASON_REGISTRATION, Money{10000, DEFAULT_CURRENCY}, Money{10000, DEFAULT_CURRENCY}},
+		{REASON_RIDE_CHARGE, Money{-100, DEFAULT_CURRENCY}, Money{9900, DEFAULT_CURRENCY}},
+		{REASON_ISSUE_REFUND, Money{100, DEFAULT_CURRENCY}, Money{10000, DEFAULT_CURRENCY}},
+		{REASON_TOP_UP, Money{500, DEFAULT_CURRENCY}, Money{10500, DEFAULT_CURRENCY}},
+		{REASON_WITHDRAWAL, Money{-250, DEFAULT_CURRENCY}, Money{10250, DEFAULT_CURRENCY}},
+		{REASON_TRANSFER_OUT, Money{-1000, DEFAULT_CURRENCY}, Money{9250, DEFAULT_CURRENCY}},
+	}
+	var page struct {
+		Records		[]QueryRecord	`json:"records"`
+	}
+	err := json.Unmarshal(stub.mustInvoke("getBalanceStatement", "u1"), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != len(expected) {
+		t.Fatalf("Statement of %d entries; expected %d", len(page.Records), len(expected))
+	}
+	for i, record := range page.Records {
+		var entry *BalanceEntry
+		err = json.Unmarshal(record.Value, &entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Reason != expected[i].reason || entry.Amount != expected[i].amount || entry.Balance != expected[i].balance || entry.TxId != entry.CreatedTxId {
+			t.Errorf("Entry %d %+v; expected %s of %s leaving %s", i, entry, expected[i].reason, expected[i].amount, expected[i].balance)
+		}
+		if entry.Reason == REASON_ISSUE_REFUND && (entry.RideId != "ride1" || entry.IssueId != "i1") {
+			t.Errorf("Refund entry %+v; expected ride ride1 and issue i1", entry)
+		}
+		if entry.Reason == REASON_TRANSFER_OUT && entry.CounterpartyId != "u2" {
+			t.Errorf("Transfer entry %+v; expected counterparty u2", entry)
+		}
+	}
+
+	// The recipient's statement holds the other side of the transfer
+	err = json.Unmarshal(stub.mustInvoke("getBalanceStatement", "u2"), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry *BalanceEntry
+	if len(page.Records) != 1 || json.Unmarshal(page.Records[0].Value, &entry) != nil || entry.Reason != REASON_TRANSFER_IN || entry.CounterpartyId != "u1" || entry.Balance != (Money{1000, DEFAULT_CURRENCY}) {
+		t.Errorf("Statement of u2 %+v; expected one transfer of 10.00 USD from u1", page.Records)
+	}
+}
+
+// startRide holds the unlock fee and daily cap until endRide settles the fare or voidRide releases it
+func TestRideHold(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range registered {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("registerUser", "u3", "0.01")
+
+	// The default tariff has no cap, so the default deposit is held
+	failure := stub.invokeError("startRide", "u3", "ride1", "b1", "8.54", "47.37")
+	if failure == nil || failure.Message != "User u3 has insufficient available balance 0.01 USD for a hold of 5.00 USD." {
+		t.Errorf("startRide with one cent under the default configuration: %+v", failure)
+	}
+	stub.mustInvoke("topUpBalance", "u3", "9.99")
+
+	stub.mustInvoke("setTariff", "1.00", "0.20", "0", "15.00", ROUNDING_UP)
+	failure = stub.invokeError("startRide", "u3", "ride1", "b1", "8.54", "47.37")
+	if failure == nil || failure.Message != "User u3 has insufficient available balance 10.00 USD for a hold of 16.00 USD." {
+		t.Errorf("startRide with a balance below the hold: %+v", failure)
+	}
+
+	stub.mustInvoke("startRide", "u1", "ride1", "b1", "8.54", "47.37")
+	user := stub.user("u1")
+	if user.Balance != (Money{10000, DEFAULT_CURRENCY}) || user.Held != (Money{1600, DEFAULT_CURRENCY}) || user.Available != (Money{8400, DEFAULT_CURRENCY}) {
+		t.Errorf("User during the ride %+v; expected 16.00 USD of 100.00 USD held", user)
+	}
+	failure = stub.invokeError("withdrawBalance", "u1", "90.00")
+	if failure == nil || failure.Message != "User u1 has insufficient available balance 84.00 USD for 90.00 USD." {
+		t.Errorf("Withdrawal of held funds: %+v", failure)
+	}
+
+	// The fare of 1.00 + 2 * 0.20 is charged and the rest of the hold released
+	stub.mustInvoke("endRide", "u1", "ride1", "8.55", "47.38")
+	user = stub.user("u1")
+	if user.Balance != (Money{9860, DEFAULT_CURRENCY}) || user.Held != (Money{0, DEFAULT_CURRENCY}) || user.Available != user.Balance {
+		t.Errorf("User after the ride %+v; expected 98.60 USD available", user)
+	}
+
+	// A voided ride releases its hold without a charge
+	stub.mustInvoke("setConfig", CONFIG_HOLD_POLICY, HOLD_DEPOSIT)
+	stub.mustInvoke("setConfig", CONFIG_HOLD_DEPOSIT, "5.00")
+	stub.mustInvoke("startRide", "u3", "ride2", "b2", "8.54", "47.37")
+	if user = stub.user("u3"); user.Held != (Money{500, DEFAULT_CURRENCY}) || user.Available != (Money{500, DEFAULT_CURRENCY}) {
+		t.Errorf("User during the ride %+v; expected a deposit of 5.00 USD held", user)
+	}
+	stub.mustInvoke("voidRide", "ride2")
+	if user = stub.user("u3"); user.Balance != (Money{1000, DEFAULT_CURRENCY}) || user.Held != (Money{0, DEFAULT_CURRENCY}) || user.EntryCount != 2 {
+		t.Errorf("User after the voided ride %+v; expected 10.00 USD and no charge", user)
+	}
+}
+
+// A fare beyond the hold is charged in full and may leave the balance negative, which blocks
+// further rides and withdrawals until the user tops up
+func TestRideHoldOverrun(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range zonesDefined {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("registerUser", "u3", "20.00")
+	stub.mustInvoke("setTariff", "1.00", "0.20", "0", "15.00", ROUNDING_UP, "1.00")
+
+	// Two days and ten minutes over 1343 meters, ending in the no-parking zone:
+	// 1.00 + 2 * 15.00 + 10 * 0.20 + 1.34 + 2.00 against a hold of 16.00
+	stub.mustInvoke("startRide", "u3", "ride1", "b1", "8.54", "47.37")
+	stub.TxTime = stub.TxTime.Add(48 * time.Hour + 9 * time.Minute)
+	stub.mustInvoke("endRide", "u3", "ride1", "8.55", "47.38")
+
+	var ride *Ride
+	records := []QueryRecord{}
+	err := json.Unmarshal(stub.mustInvoke("getRideById", "ride1"), &records)
+	if err != nil || len(records) != 1 || json.Unmarshal(records[0].Value, &ride) != nil {
+		t.Fatalf("getRideById: %v", err)
+	}
+	if ride.Hold != (Money{1600, DEFAULT_CURRENCY}) || ride.DistanceMeters != 1343 || ride.Cost != (Money{3634, DEFAULT_CURRENCY}) {
+		t.Fatalf("Ride %+v; expected 36.34 USD charged against a hold of 16.00 USD", ride)
+	}
+	user := stub.user("u3")
+	if user.Balance != (Money{-1634, DEFAULT_CURRENCY}) || user.Held.Amount != 0 || user.Available != user.Balance {
+		t.Errorf("User after the ride %+v; expected a balance of -16.34 USD", user)
+	}
+
+	// The debt blocks the next ride, reservations and withdrawals
+	failure := stub.invokeError("startRide", "u3", "ride2", "b1", "8.55", "47.38")
+	if failure == nil || failure.Message != "User u3 has negative balance." {
+		t.Errorf("startRide with negative balance: %+v", failure)
+	}
+	failure = stub.invokeError("reserveBike", "u3", "b1")
+	if failure == nil || failure.Message != "User u3 has negative balance." {
+		t.Errorf("reserveBike with negative balance: %+v", failure)
+	}
+	failure = stub.invokeError("withdrawBalance", "u3", "1.00")
+	if failure == nil || failure.Code != ERR_INSUFFICIENT_BALANCE {
+		t.Errorf("withdrawBalance with negative balance: %+v", failure)
+	}
+
+	// Topping up the debt and the next hold allows riding again
+	stub.mustInvoke("topUpBalance", "u3", "32.34")
+	stub.mustInvoke("startRide", "u3", "ride2", "b1", "8.55", "47.38")
+}
+
+// Expired reservations release their bike at the next touch and count no-shows, charged beyond the allowance
+func TestReservations(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setConfig", CONFIG_NO_SHOW_FEE, "1.00")
+	stub.mustInvoke("setConfig", CONFIG_NO_SHOW_ALLOWANCE, "1")
+	stub.mustInvoke("setConfig", CONFIG_RESERVATION_MINUTES, "1")
+	for _, step := range registered {
+		stub.mustInvoke(step.function, step.args...)
+	}
+
+	// The first no-show is free, the second is charged
+	stub.mustInvoke("reserveBike", "u1", "b1")
+	stub.mustInvoke("reserveBike", "u1", "b1")
+	if user := stub.user("u1"); user.NoShowCount != 1 || user.Balance != (Money{10000, DEFAULT_CURRENCY}) || user.ReservedBikeId != "b1" {
+		t.Errorf("User after one no-show %+v; expected no fee", user)
+	}
+	stub.mustInvoke("reserveBike", "u1", "b2")
+	if user := stub.user("u1"); user.NoShowCount != 2 || user.Balance != (Money{9900, DEFAULT_CURRENCY}) || user.ReservedBikeId != "b2" {
+		t.Errorf("User after two no-shows %+v; expected a fee of 1.00", user)
+	}
+	if status := stub.status(BIKE, "b1"); status != BIKE_AVAILABLE {
+		t.Errorf("Bike b1 %s after its reservation expired; expected available", status)
+	}
+	var page struct {
+		Records		[]QueryRecord	`json:"records"`
+	}
+	var entry *BalanceEntry
+	err := json.Unmarshal(stub.mustInvoke("getBalanceStatement", "u1"), &page)
+	if err != nil || len(page.Records) != 2 || json.Unmarshal(page.Records[1].Value, &entry) != nil || entry.Reason != REASON_NO_SHOW_FEE || entry.BikeId != "b1" {
+		t.Errorf("Balance statement %v %+v; expected a no-show fee for b1", err, entry)
+	}
+
+	// A provider touching the bike expires the reservation too, charging the holder
+	stub.mustInvoke("setConfig", CONFIG_RESERVATION_MINUTES, "15")
+	stub.mustInvoke("discardBike", "b2")
+	if user := stub.user("u1"); user.NoShowCount != 3 || user.Balance != (Money{9800, DEFAULT_CURRENCY}) || user.ReservedBikeId != "" {
+		t.Errorf("User after three no-shows %+v; expected no reservation and fees of 2.00", user)
+	}
+	if event := stub.lastEvent(); len(event.Changes) != 3 {
+		t.Errorf("Event %+v; expected changes of the bike, the user and the balance entry", event)
+	}
+
+	// A ride started from a reservation ends it and clears the no-shows
+	stub.mustInvoke("reserveBike", "u1", "b1")
+	stub.mustInvoke("startRide", "u1", "ride1", "b1", "8.54", "47.37")
+	if user := stub.user("u1"); user.NoShowCount != 0 || user.ReservedBikeId != "" {
+		t.Errorf("User after a reserved ride %+v; expected no reservation and no-shows", user)
+	}
+
+	// A fee in another currency, written before setConfig refused it, is skipped and the reservation still expires
+	stub.MockTransactionStart("direct")
+	config := getDefaultConfig()
+	config.ReservationMinutes, config.NoShowFee, config.NoShowAllowance = 1, Money{200, "EUR"}, 0
+	configKey, _ := getConfigKey(stub)
+	configBytes, _ := json.Marshal(config)
+	stub.PutState(configKey, configBytes)
+	stub.MockTransactionEnd("direct")
+	stub.mustInvoke("registerUser", "u3", "10.00")
+	stub.mustInvoke("registerBike", "b3")
+	stub.mustInvoke("reserveBike", "u3", "b3")
+	stub.mustInvoke("discardBike", "b3")
+	if user := stub.user("u3"); user.NoShowCount != 1 || user.Balance != (Money{1000, DEFAULT_CURRENCY}) || user.ReservedBikeId != "" {
+		t.Errorf("User after a no-show with a fee in another currency %+v; expected no fee", user)
+	}
+}
+
+// Docking keeps the slots, docked count and availability of the stations in step with the bikes
+func TestStations(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range bikeDocked {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("startRide", "u1", "ride2", "b2", "8.54", "47.37")
+	stub.mustInvoke("endRide", "u1", "ride2", "8.54", "47.37", "", "s1")
+
+	station := func(id string) *Station {
+		var station *Station
+		key, err := getStationKey(stub, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(stub.State[key], &station)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return station
+	}
+	s1, s2 := station("s1"), station("s2")
+	if strings.Join(s1.Docks, ",") != "b2," || s1.DockedCount != 1 || s1.DockAvailability != DOCKS_FREE {
+		t.Errorf("Station s1 %+v; expected b2 in the first of two docks", s1)
+	}
+	if s2.DockedCount != 1 || s2.DockAvailability != DOCKS_FULL {
+		t.Errorf("Station s2 %+v; expected full", s2)
+	}
+
+	ids := recordIDs(t, stub.mustInvoke("getBikesAtStation", "s1"))
+	if strings.Join(ids, ",") != "b2" {
+		t.Errorf("Bikes at s1 %v; expected [b2]", ids)
+	}
+	ids = recordIDs(t, stub.mustInvoke("getStationsWithFreeDocks"))
+	if strings.Join(ids, ",") != "s1" {
+		t.Errorf("Stations with free docks %v; expected [s1]", ids)
+	}
+
+	// Taking a bike out of its dock frees it, whether by a ride or by moving the bike
+	stub.mustInvoke("startRide", "u1", "ride3", "b1", "8.55", "47.38", "", "s2")
+	stub.mustInvoke("updateBikeLocation", "b2", "8.60", "47.40")
+	ids = recordIDs(t, stub.mustInvoke("getStationsWithFreeDocks"))
+	if strings.Join(ids, ",") != "s1,s2" {
+		t.Errorf("Stations with free docks %v; expected [s1 s2]", ids)
+	}
+	if s1 = station("s1"); s1.DockedCount != 0 {
+		t.Errorf("Station s1 %+v; expected empty", s1)
+	}
+
+	var ride *Ride
+	rides := []QueryRecord{}
+	err := json.Unmarshal(stub.mustInvoke("getRideById", "ride3"), &rides)
+	if err != nil || len(rides) != 1 || json.Unmarshal(rides[0].Value, &ride) != nil || ride.StartStationId != "s2" {
+		t.Errorf("Ride ride3 %v %+v; expected start at s2", err, ride)
+	}
+
+	// A discarded bike leaves its dock, so the station can be retired
+	stub.mustInvoke("endRide", "u1", "ride3", "8.54", "47.37", "", "s1")
+	stub.mustInvoke("discardBike", "b1")
+	if s1 = station("s1"); s1.DockedCount != 0 || strings.Join(s1.Docks, ",") != "," {
+		t.Errorf("Station s1 %+v; expected empty after discarding b1", s1)
+	}
+	stub.mustInvoke("retireStation", "s1")
+}
+
+// The geohash index follows bike locations; the search returns available bikes nearest first
+func TestBikesNear(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range registered {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	stub.mustInvoke("registerBike", "b3")
+	stub.mustInvoke("registerBike", "b4")
+	stub.mustInvoke("updateBikeLocation", "b1", "8.5410", "47.3700")
+	stub.mustInvoke("updateBikeLocation", "b2", "8.5400", "47.3705")
+	stub.mustInvoke("updateBikeLocation", "b3", "8.5400", "47.3800")
+	stub.mustInvoke("updateBikeLocation", "b4", "8.5400", "47.3731")
+
+	nearby := func(args ...string) []NearbyBike {
+		var bikes []NearbyBike
+		err := json.Unmarshal(stub.mustInvoke("getBikesNear", args...), &bikes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bikes
+	}
+	ids := func(bikes []NearbyBike) string {
+		ids := []string{}
+		for _, bike := range bikes {
+			ids = append(ids, bike.Value.Id)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	bikes := nearby("8.5400", "47.3730", "500")
+	if ids(bikes) != "b4,b2,b1" {
+		t.Errorf("Bikes near 8.54, 47.373 %s; expected b4,b2,b1", ids(bikes))
+	}
+	if len(bikes) == 3 && (bikes[0].DistanceMeters > 15 || bikes[1].DistanceMeters < 270 || bikes[1].DistanceMeters > 290) {
+		t.Errorf("Distances %v, %v; expected about 11 and 278 meters", bikes[0].DistanceMeters, bikes[1].DistanceMeters)
+	}
+	if bikes = nearby("8.5400", "47.3730", "500", "2"); ids(bikes) != "b4,b2" {
+		t.Errorf("Two bikes near 8.54, 47.373 %s; expected b4,b2", ids(bikes))
+	}
+	if bikes = nearby("8.5400", "47.3730", "2000"); ids(bikes) != "b4,b2,b1,b3" {
+		t.Errorf("Bikes within 2 km %s; expected b4,b2,b1,b3", ids(bikes))
+	}
+
+	// Rides take bikes out of the results and put them back where they end
+	stub.mustInvoke("startRide", "u1", "ride1", "b4", "8.5400", "47.3731")
+	if bikes = nearby("8.5400", "47.3730", "500"); ids(bikes) != "b2,b1" {
+		t.Errorf("Bikes near 8.54, 47.373 during a ride %s; expected b2,b1", ids(bikes))
+	}
+	stub.mustInvoke("endRide", "u1", "ride1", "8.6000", "47.4000")
+	if bikes = nearby("8.6000", "47.4000", "50"); ids(bikes) != "b4" {
+		t.Errorf("Bikes near the end of the ride %s; expected b4", ids(bikes))
+	}
+	var bike *Bike
+	key, err := getBikeKey(stub, "b4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(stub.State[key], &bike)
+	if err != nil || bike.Geohash != encodeGeohash(float64(float32(8.6)), float64(float32(47.4)), GEOHASH_PRECISION) {
+		t.Errorf("Bike b4 %v %+v; expected the geohash of the end location", err, bike)
+	}
+
+	// Only the entry of the current location is kept
+	count := 0
+	iterator, err := getIndexRange(stub, GEOHASH_INDEX, []string{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for iterator.HasNext() {
+		_, err = iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	iterator.Close()
+	if count != 4 {
+		t.Errorf("%d geohash index entries; expected 4", count)
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value			string
+		amount			Money
+		err				bool
+	}{
+		{"12", Money{1200, DEFAULT_CURRENCY}, false},
+		{"12.5", Money{1250, DEFAULT_CURRENCY}, false},
+		{"0.05 EUR", Money{5, "EUR"}, false},
+		{"999999999999.99", Money{99999999999999, DEFAULT_CURRENCY}, false},
+		{"12.505", Money{}, true},
+		{"-1.00", Money{}, true},
+		{"+1.00", Money{}, true},
+		{"", Money{}, true},
+		{"USD", Money{}, true},
+		{" USD", Money{}, true},
+		{".50", Money{}, true},
+		{"1.", Money{}, true},
+		{"1e3", Money{}, true},
+		{"1.00 usd", Money{}, true},
+		{"1.00  USD", Money{}, true},
+		{"1000000000000", Money{}, true},
+		{"99999999999999999999", Money{}, true},
+	}
+	for _, test := range tests {
+		amount, err := parseMoney(test.value)
+		if (err != nil) != test.err || amount != test.amount {
+			t.Errorf("parseMoney(%q) %v %v; expected %v, error %t", test.value, amount, err, test.amount, test.err)
+		}
+	}
+}
+
+func TestParseFloatArg(t *testing.T) {
+	tests := []struct {
+		spec			ArgSpec
+		value			string
+		err				string
+	}{
+		{required("RADIUS_METERS", ARG_FLOAT), "1e3", ""},
+		{required("RADIUS_METERS", ARG_FLOAT), "-0.5", ""},
+		{required("RADIUS_METERS", ARG_FLOAT), "1e400", "Malformed number 1e400."},
+		{required("RADIUS_METERS", ARG_FLOAT), "NaN", "Number NaN is not finite."},
+		{required("RADIUS_METERS", ARG_FLOAT), "+Inf", "Number +Inf is not finite."},
+		{required("RADIUS_METERS", ARG_FLOAT), "-infinity", "Number -infinity is not finite."},
+		{between("LONGITUDE", -180, 180), "-180", ""},
+		{between("LONGITUDE", -180, 180), "180", ""},
+		{between("LONGITUDE", -180, 180), "180.000001", "Number 180.000001 out of range. Expecting -180 to 180."},
+		{between("LATITUDE", -90, 90), "90", ""},
+		{between("LATITUDE", -90, 90), "-91", "Number -91 out of range. Expecting -90 to 90."},
+		{between("LATITUDE", -90, 90), "nan", "Number nan is not finite."},
+	}
+	for _, test := range tests {
+		_, err := parseArg(test.spec, test.value)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("parseArg(%s, %q) %v; expected %q", test.spec.Name, test.value, err, test.err)
+		}
+	}
+}
+
+// Ledger data written by earlier versions holds float amounts in major units
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json			string
+		amount			Money
+		err				bool
+	}{
+		{`{"amount": 1250, "currency": "EUR"}`, Money{1250, "EUR"}, false},
+		{`{"amount": 1250}`, Money{1250, DEFAULT_CURRENCY}, false},
+		{`12.5`, Money{1250, DEFAULT_CURRENCY}, false},
+		{`0.29`, Money{29, DEFAULT_CURRENCY}, false},
+		{`-3.1`, Money{-310, DEFAULT_CURRENCY}, false},
+		{`0`, Money{0, DEFAULT_CURRENCY}, false},
+		{`null`, Money{}, false},
+		{`"12.50"`, Money{}, true},
+		{`{"amount": 12.5}`, Money{}, true},
+	}
+	for _, test := range tests {
+		var amount Money
+		err := json.Unmarshal([]byte(test.json), &amount)
+		if (err != nil) != test.err || amount != test.amount {
+			t.Errorf("Unmarshal %s %v %v; expected %v, error %t", test.json, amount, err, test.amount, test.err)
+		}
+	}
+
+	var user User
+	err := json.Unmarshal([]byte(`{"docType": "user", "id": "u1", "balance": 20.1}`), &user)
+	if err != nil || user.Balance != (Money{2010, DEFAULT_CURRENCY}) {
+		t.Errorf("Legacy user %v %+v; expected a balance of 20.10 USD", err, user)
+	}
+}
+
+// Dev mode turns off access control, so it is refused unless the peer runs dev-mode networking
+func TestResolveDevMode(t *testing.T) {
+	tests := []struct {
+		args			[]string
+		env				map[string]string
+		devMode			bool
+		err				bool
+	}{
+		{nil, nil, false, false},
+		{nil, map[string]string{"CORE_PEER_ADDRESS": "peer:7052"}, false, false},
+		{nil, map[string]string{DEV_MODE_ENV: "false"}, false, false},
+		{nil, map[string]string{DEV_MODE_ENV: "true", "CORE_PEER_ADDRESS": "peer:7052"}, true, false},
+		{nil, map[string]string{DEV_MODE_ENV: "1", "CORE_PEER_ADDRESS": "peer:7052"}, true, false},
+		{[]string{"-peer.address=peer:7052"}, map[string]string{DEV_MODE_ENV: "false"}, false, false},
+
+		// Outside the dev network
+		{nil, map[string]string{DEV_MODE_ENV: "true"}, false, true},
+		{[]string{"-peer.address=peer:7052"}, map[string]string{DEV_MODE_ENV: "true"}, false, true},
+		{[]string{"--peer.address", "peer:7052"}, map[string]string{DEV_MODE_ENV: "true"}, false, true},
+		{[]string{"-peer.address=peer:7052"}, map[string]string{DEV_MODE_ENV: "true", "CORE_PEER_ADDRESS": "peer:7052"}, false, true},
+		{nil, map[string]string{DEV_MODE_ENV: "yes", "CORE_PEER_ADDRESS": "peer:7052"}, false, true},
+	}
+	for _, test := range tests {
+		env := test.env
+		devMode, err := resolveDevMode(test.args, func(name string) string { return env[name] })
+		if devMode != test.devMode || (err != nil) != test.err {
+			t.Errorf("Dev mode with %v and %v: %t %v; expected %t, error %t", test.args, test.env, devMode, err, test.devMode, test.err)
+		}
+	}
+}
+
+func TestGeohash(t *testing.T) {
+	if hash := encodeGeohash(-5.6, 42.6, 5); hash != "ezs42" {
+		t.Errorf("Geohash of -5.6, 42.6 %s; expected ezs42", hash)
+	}
+	if hash := encodeGeohash(8.5417, 47.3769, 9); !strings.HasPrefix(hash, "u0qj") {
+		t.Errorf("Geohash of Zurich %s; expected prefix u0qj", hash)
+	}
+	cells := getGeohashSearchCells(179.9999, 0, 100)
+	if len(cells) != 9 || cells[0][0] != '2' || cells[8][0] != 'x' {
+		t.Errorf("Cells across the antimeridian %v; expected 9 cells on both sides", cells)
+	}
+	if cells = getGeohashSearchCells(0, 89.99, 40000); len(cells) != 1 || cells[0] != "" {
+		t.Errorf("Cells near the pole %v; expected the whole index", cells)
+	}
+	if distance := haversineDistance(8.54, 47.37, 8.55, 47.38); distance < 1340 || distance > 1350 {
+		t.Errorf("Distance %v; expected about 1345 meters", distance)
+	}
+}
+
+// Tracks appended in batches keep a Merkle root matching the stored samples, and endRide
+// prices and records the distance along the track
+func TestRideTrack(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setTariff", "0", "0", "0", "0", ROUNDING_NONE, "1.00")
+	for _, step := range registered {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	getRide := func(id string) *Ride {
+		var ride *Ride
+		records := []QueryRecord{}
+		err := json.Unmarshal(stub.mustInvoke("getRideById", id), &records)
+		if err != nil || len(records) != 1 || json.Unmarshal(records[0].Value, &ride) != nil {
+			t.Fatalf("getRideById %s: %v %v", id, err, records)
+		}
+		return ride
+	}
+	getTrack := func(id string) *RideTrack {
+		var track *RideTrack
+		err := json.Unmarshal(stub.mustInvoke("getRideTrack", id), &track)
+		if err != nil {
+			t.Fatalf("getRideTrack %s: %v", id, err)
+		}
+		return track
+	}
+
+	stub.mustInvoke("startRide", "u1", "ride1", "b1", "8.54", "47.37")
+	var segment *TrackSegment
+	err := json.Unmarshal(stub.mustInvoke("appendRideTrack", "u1", "ride1", fmt.Sprintf(`[{"longitude": 8.545, "latitude": 47.375, "time": "%s"}]`, formatTimestamp(stub.TxTime))), &segment)
+	if err != nil || segment.Id != "ride1-000001" || segment.FirstSample != 0 || segment.SampleCount != 1 {
+		t.Errorf("First segment %v %+v", err, segment)
+	}
+	stub.mustInvoke("appendRideTrack", "u1", "ride1", fmt.Sprintf(`[{"longitude": 8.55, "latitude": 47.38, "time": "%s"}, {"longitude": 8.5500004, "latitude": 47.38, "time": "%s"}]`, formatTimestamp(stub.TxTime.Add(-time.Second)), formatTimestamp(stub.TxTime)))
+	failure := stub.invokeError("appendRideTrack", "u1", "ride1", fmt.Sprintf(`[{"longitude": 8.55, "latitude": 47.38, "time": "%s"}]`, formatTimestamp(stub.TxTime.Add(-2 * time.Minute))))
+	if failure == nil || failure.Code != ERR_BAD_ARGUMENT || !strings.Contains(failure.Message, "before the ride start or the previous sample") {
+		t.Errorf("Sample before the previous one: %+v", failure)
+	}
+
+	ride := getRide("ride1")
+	track := getTrack("ride1")
+	if ride.TrackSampleCount != 3 || ride.TrackSegmentCount != 2 || ride.TrackRoot == "" || len(ride.TrackFrontier) != 2 {
+		t.Errorf("Ride after two segments %+v; expected 3 samples in 2 segments", ride)
+	}
+	if !track.Verified || track.TrackRoot != ride.TrackRoot || len(track.Samples) != 3 || track.Samples[1].Latitude != 47.38 {
+		t.Errorf("Track %+v; expected 3 verified samples", track)
+	}
+	// Coordinates are kept to millionths of a degree
+	if track.Samples[2].Longitude != 8.55 {
+		t.Errorf("Longitude %v; expected 8.55", track.Samples[2].Longitude)
+	}
+
+	// Distance from the start through the samples to the end, charged at 1.00 per kilometer
+	stub.mustInvoke("endRide", "u1", "ride1", "8.55", "47.38")
+	ride = getRide("ride1")
+	expected := getTrackDistance([]float32{8.54, 47.37}, []trackPoint{{8545000, 47375000, 0}, {8550000, 47380000, 0}}, []float32{8.55, 47.38})
+	if ride.DistanceMeters != expected || expected < 1340 || expected > 1350 {
+		t.Errorf("Ride distance %d; expected %d", ride.DistanceMeters, expected)
+	}
+	if ride.Cost != (Money{(ride.DistanceMeters * 100 + 500) / 1000, DEFAULT_CURRENCY}) {
+		t.Errorf("Ride cost %s for %d meters; expected 1.00 per kilometer", ride.Cost, ride.DistanceMeters)
+	}
+	if track = getTrack("ride1"); !track.Verified || track.DistanceMeters != ride.DistanceMeters {
+		t.Errorf("Track of the completed ride %+v", track)
+	}
+
+	// Rides without a track are measured from start to end; voided rides are not counted
+	stub.mustInvoke("startRide", "u1", "ride2", "b1", "8.55", "47.38")
+	stub.mustInvoke("endRide", "u1", "ride2", "8.56", "47.38")
+	stub.mustInvoke("startRide", "u1", "ride3", "b1", "8.56", "47.38")
+	stub.mustInvoke("voidRide", "ride3")
+	second := getRide("ride2")
+	if distance := int64(haversineDistance(8.55, 47.38, 8.56, 47.38)); second.DistanceMeters < distance - 1 || second.DistanceMeters > distance + 1 {
+		t.Errorf("Distance of a ride without track %d; expected about %d", second.DistanceMeters, distance)
+	}
+	var bikeRecords []QueryRecord
+	var bike *Bike
+	err = json.Unmarshal(stub.mustInvoke("getBikeById", "b1"), &bikeRecords)
+	if err != nil || len(bikeRecords) != 1 || json.Unmarshal(bikeRecords[0].Value, &bike) != nil {
+		t.Fatalf("getBikeById b1: %v", err)
+	}
+	if bike.OdometerMeters != ride.DistanceMeters + second.DistanceMeters {
+		t.Errorf("Odometer %d; expected %d", bike.OdometerMeters, ride.DistanceMeters + second.DistanceMeters)
+	}
+	if track = getTrack("ride3"); !track.Verified || track.TrackRoot != "" || len(track.Samples) != 0 {
+		t.Errorf("Track of a ride without samples %+v", track)
+	}
+
+	var quote *FareQuote
+	err = json.Unmarshal(stub.mustInvoke("quoteRide", "10", "2500"), &quote)
+	if err != nil || quote.DistanceCharge != (Money{250, DEFAULT_CURRENCY}) || quote.Total != (Money{250, DEFAULT_CURRENCY}) {
+		t.Errorf("quoteRide 10 2500: %v %+v", err, quote)
+	}
+	failure = stub.invokeError("quoteRide", "10", "-1")
+	if failure == nil || failure.Message != "Distance must not be negative." {
+		t.Errorf("quoteRide 10 -1: %+v", failure)
+	}
+}
+
+func TestTrackEncoding(t *testing.T) {
+	points := []trackPoint{{8540000, 47370000, 1527840000}, {8539999, 47370123, 1527840005}, {-179999999, -89999999, 1527840005}}
+	decoded, err := decodeTrack(encodeTrack(points))
+	if err != nil || fmt.Sprint(decoded) != fmt.Sprint(points) {
+		t.Errorf("Decoded track %v %v; expected %v", err, decoded, points)
+	}
+	if _, err = decodeTrack(encodeTrack(points)[:5]); err == nil {
+		t.Errorf("Truncated track decoded")
+	}
+
+	// Root of three leaves as in RFC 6962, whether appended at once or one by one
+	expected := hex.EncodeToString(hashTrackNode(hashTrackNode(hashTrackLeaf(points[0]), hashTrackLeaf(points[1])), hashTrackLeaf(points[2])))
+	_, root, err := appendTrackLeaves([]string{}, 0, points)
+	if err != nil || root != expected {
+		t.Errorf("Root %v %s; expected %s", err, root, expected)
+	}
+	frontier := []string{}
+	for i, point := range points {
+		frontier, root, err = appendTrackLeaves(frontier, i, []trackPoint{point})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if root != expected || len(frontier) != 2 {
+		t.Errorf("Root appended one by one %s with frontier %v; expected %s", root, frontier, expected)
+	}
+}
+
+// endRide charges the fee of the zones the ride ends in and records the zone deciding it
+func TestZones(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range zonesDefined {
+		stub.mustInvoke(step.function, step.args...)
+	}
+
+	var check *LocationCheck
+	err := json.Unmarshal(stub.mustInvoke("checkLocation", "8.55", "47.38"), &check)
+	if err != nil || !check.InServiceArea || len(check.Zones) != 2 || check.Zones[0].Id != "z1" || check.Zones[1].Id != "z2" || check.ZoneId != "z2" || check.Fee != (Money{200, DEFAULT_CURRENCY}) {
+		t.Errorf("checkLocation in a no-parking zone: %v %+v", err, check)
+	}
+	err = json.Unmarshal(stub.mustInvoke("checkLocation", "9.00", "47.38"), &check)
+	if err != nil || check.InServiceArea || len(check.Zones) != 0 || check.ZoneId != "" || check.Fee != (Money{500, DEFAULT_CURRENCY}) {
+		t.Errorf("checkLocation outside the service area: %v %+v", err, check)
+	}
+
+	// Rides of one minute cost 0.10 under the default tariff
+	tests := []struct {
+		longitude	string
+		latitude	string
+		zoneId		string
+		cost		Money
+	}{
+		{"8.55", "47.38", "z2", Money{210, DEFAULT_CURRENCY}},
+		{"8.54", "47.37", "z3", Money{0, DEFAULT_CURRENCY}},
+		{"8.58", "47.32", "", Money{10, DEFAULT_CURRENCY}},
+		{"8.70", "47.32", "", Money{510, DEFAULT_CURRENCY}},
+	}
+	for i, test := range tests {
+		rideID := fmt.Sprintf("ride%d", i + 1)
+		stub.mustInvoke("startRide", "u1", rideID, "b1", "8.54", "47.37")
+		stub.mustInvoke("endRide", "u1", rideID, test.longitude, test.latitude)
+
+		var ride *Ride
+		records := []QueryRecord{}
+		err = json.Unmarshal(stub.mustInvoke("getRideById", rideID), &records)
+		if err != nil || len(records) != 1 || json.Unmarshal(records[0].Value, &ride) != nil {
+			t.Fatalf("getRideById %s: %v", rideID, err)
+		}
+		if ride.EndZoneId != test.zoneId || ride.Cost != test.cost {
+			t.Errorf("Ride ending at %s, %s in zone %q costs %s; expected zone %q and %s", test.longitude, test.latitude, ride.EndZoneId, ride.Cost, test.zoneId, test.cost)
+		}
+	}
+
+	// Removed zones no longer apply
+	stub.mustInvoke("removeZone", "z2")
+	err = json.Unmarshal(stub.mustInvoke("checkLocation", "8.55", "47.38"), &check)
+	if err != nil || len(check.Zones) != 1 || check.ZoneId != "" || check.Fee.Amount != 0 {
+		t.Errorf("checkLocation after removing the no-parking zone: %v %+v", err, check)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range rideOngoing {
+		stub.mustInvoke(step.function, step.args...)
+	}
+	startTx := stub.txID(stub.txCount)
+	stub.mustInvoke("endRide", "u1", "ride1", "8.55", "47.38")
+	endTx := stub.txID(stub.txCount)
+
+	stub.MockTransactionStart("direct")
+	defer stub.MockTransactionEnd("direct")
+
+	ride, err := rides(stub).MustGet("ride1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ride.CreatedTxId != startTx || ride.UpdatedTxId != endTx || ride.CreatedAt != ride.StartTime || ride.UpdatedAt != ride.EndTime {
+		t.Errorf("Ride audit fields %+v; expected creation in %s and update in %s", ride.Audit, startTx, endTx)
+	}
+
+	user, err := users(stub).Get("u9")
+	if user != nil || err != nil {
+		t.Errorf("Get of a missing user: %v %v", user, err)
+	}
+	_, err = users(stub).MustGet("u9")
+	if err == nil || err.Error() != "User u9 not found." {
+		t.Errorf("MustGet of a missing user: %v", err)
+	}
+	err = users(stub).Update(&User{USER, "u9", "", newMoney(0), newMoney(0), newMoney(0), 0, "", "", 0, USER_FREE, Audit{}})
+	if err == nil || err.Error() != "User u9 not found." {
+		t.Errorf("Update of a missing user: %v", err)
+	}
+	err = bikes(stub).Create(&Bike{BIKE, "b1", []float32{}, "", "", "", "", 0, BIKE_AVAILABLE, Audit{}})
+	if err == nil || err.Error() != "Bike b1 already exists." {
+		t.Errorf("Create of an existing bike: %v", err)
+	}
+
+	// Updates keep the secondary indexes in step
+	bike, err := bikes(stub).MustGet("b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bike.Status = BIKE_TO_REPAIR
+	err = bikes(stub).Update(bike)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _, err := getIndexQueryPage(stub, newSelector(BIKE).equals("status", BIKE_TO_REPAIR), 0, "")
+	if err != nil || len(records) != 1 {
+		t.Errorf("Bikes to repair after update: %v %v", err, records)
+	}
+}
+
+// A bike moved out of use behind the ride's back is reported by its own ID
+func TestEndRideBikeNotInUse(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range rideOngoing {
+		stub.mustInvoke(step.function, step.args...)
+	}
+
+	stub.MockTransactionStart("direct")
+	bike, err := bikes(stub).MustGet("b1")
+	if err == nil {
+		bike.Status = BIKE_AVAILABLE
+		err = bikes(stub).Update(bike)
+	}
+	stub.MockTransactionEnd("direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := stub.invokeError("endRide", "u1", "ride1", "8.55", "47.38")
+	if failure == nil || failure.Message != "Bike b1 not in use." {
+		t.Errorf("endRide with the bike available: %+v", failure)
+	}
+}
+
+func TestSettingsQueries(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustInvoke("setTariff", "1.00", "0.20", "0", "5.00", ROUNDING_NONE)
+	stub.mustInvoke("setConfig", CONFIG_MAX_CLOCK_SKEW, "60")
+
+	var tariff *Tariff
+	err := json.Unmarshal(stub.mustInvoke("getTariff"), &tariff)
+	if err != nil || tariff.Version != 1 {
+		t.Errorf("getTariff: %v %+v", err, tariff)
+	}
+	err = json.Unmarshal(stub.mustInvoke("getTariff", "0"), &tariff)
+	if err != nil || tariff.Version != 0 || tariff.PerMinuteRate.Amount != 10 {
+		t.Errorf("getTariff 0: %v %+v", err, tariff)
+	}
+	failure := stub.invokeError("getTariff", "7")
+	if failure == nil || failure.Message != "Tariff version 7 not found." {
+		t.Errorf("getTariff 7: %+v", failure)
+	}
+
+	var quote *FareQuote
+	err = json.Unmarshal(stub.mustInvoke("quoteRide", "45"), &quote)
+	if err != nil || quote.Total != (Money{600, DEFAULT_CURRENCY}) || !quote.CapApplied {
+		t.Errorf("quoteRide 45: %v %+v", err, quote)
+	}
+	failure = stub.invokeError("quoteRide", "-5")
+	if failure == nil || failure.Message != "Duration must not be negative." {
+		t.Errorf("quoteRide -5: %+v", failure)
+	}
+
+	var config *Config
+	err = json.Unmarshal(stub.mustInvoke("getConfig"), &config)
+	if err != nil || config.MaxClockSkew != 60 || !config.RichQueries {
+		t.Errorf("getConfig: %v %+v", err, config)
+	}
+
+	var acl *AccessControlList
+	err = json.Unmarshal(stub.mustInvoke("getAccessControlList"), &acl)
+	if err != nil || len(acl.Rules) != len(getDefaultAccessControlList().Rules) {
+		t.Errorf("getAccessControlList: %v", err)
+	}
+
+	var info *ChaincodeInfo
+	err = json.Unmarshal(stub.mustInvoke("getChaincodeInfo"), &info)
+	if err != nil || info.Version != CHAINCODE_VERSION || !info.DevMode || info.AccessControl {
+		t.Errorf("getChaincodeInfo: %v %+v", err, info)
+	}
+}
+
+func TestListFunctions(t *testing.T) {
+	stub := newTestStub(t)
+
+	var functions []*FunctionSpec
+	err := json.Unmarshal(stub.mustInvoke("listFunctions"), &functions)
+	if err != nil || len(functions) != len(getFunctionRegistry()) {
+		t.Fatalf("listFunctions: %v %d", err, len(functions))
+	}
+
+	rules := getDefaultAccessControlList().Rules
+	names := map[string]bool{}
+	for _, spec := range functions {
+		if names[spec.Name] {
+			t.Errorf("Function %s registered twice", spec.Name)
+		}
+		names[spec.Name] = true
+		if len(spec.Roles) == 0 || len(rules[spec.Name].Roles) != len(spec.Roles) {
+			t.Errorf("Function %s has roles %v and default rule %v", spec.Name, spec.Roles, rules[spec.Name])
+		}
+		// Optional arguments may only be omitted from the end
+		for i := 1; i < len(spec.Args); i++ {
+			if spec.Args[i - 1].Optional && !spec.Args[i].Optional {
+				t.Errorf("Function %s declares required %s after an optional argument", spec.Name, spec.Args[i].Name)
+			}
+		}
+	}
+	if len(rules) != len(names) {
+		t.Errorf("Default ACL has %d rules for %d functions", len(rules), len(names))
+	}
+	if err = validateAccessControlList(getDefaultAccessControlList()); err != nil || rules["setAccessControlList"].Attributes[ADMIN_ATTRIBUTE] != "true" {
+		t.Errorf("Default ACL %v; expected setAccessControlList to require %s", err, ADMIN_ATTRIBUTE)
+	}
+
+	balance := functions[0].Args[1]
+	if functions[0].Name != "registerUser" || balance.Name != "BALANCE" || balance.Type != ARG_MONEY || balance.Optional {
+		t.Errorf("registerUser arguments: %+v", functions[0].Args)
+	}
+
+	failure := stub.invokeError("getRidesByStatus")
+	expected := "Incorrect number of arguments. Expecting 1 to 3: {STATUS, [PAGE_SIZE], [BOOKMARK]}. Found 0."
+	if failure == nil || failure.Message != expected {
+		t.Errorf("getRidesByStatus without arguments: %+v", failure)
+	}
+}
+
+func TestHistoryQueries(t *testing.T) {
+	stub := newTestStub(t)
+	for _, step := range steps(issueOpen, repairRequested[len(registered):]) {
+		stub.mustInvoke(step.function, step.args...)
+	}
+
+	historyTests := []struct {
+		call		invocation
+		statuses	[]string
+	}{
+		{call("getUserHistory", "u1"), []string{USER_FREE, USER_IN_RIDE, USER_FREE}},
+		{call("getBikeHistory", "b1"), []string{BIKE_AVAILABLE, BIKE_IN_USE, BIKE_AVAILABLE, BIKE_TO_REPAIR}},
+		{call("getBikeHistory", "b1", "2"), []string{BIKE_AVAILABLE, BIKE_IN_USE}},
+		{call("getBikeHistory", "b1", "", "", "2018-06-01T08:07:00Z"), []string{BIKE_AVAILABLE, BIKE_TO_REPAIR}},
+		{call("getBikeHistory", "b1", "", "", "", "2018-06-01T08:05:00Z"), []string{BIKE_AVAILABLE}},
+		{call("getRideHistory", "ride1"), []string{RIDE_ONGOING, RIDE_COMPLETED, RIDE_ISSUE_OPEN}},
+		{call("getRepairHistory", "rep1"), []string{REPAIR_REQUESTED}},
+	}
+	for _, test := range historyTests {
+		var page struct {
+			Records		[]HistoryEntry	`json:"records"`
+		}
+		err := json.Unmarshal(stub.mustInvoke(test.call.function, test.call.args...), &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses := []string{}
+		for _, entry := range page.Records {
+			var document struct {
+				Status		string		`json:"status"`
+			}
+			err = json.Unmarshal(entry.Value, &document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses = append(statuses, document.Status)
+		}
+		if strings.Join(statuses, ",") != strings.Join(test.statuses, ",") {
+			t.Errorf("%s %v returned %v; expected %v", test.call.function, test.call.args, statuses, test.statuses)
+		}
+	}
+
+	failure := stub.invokeError("getBikeHistory", "b1", "", "", "2018-06-01T09:00:00Z", "2018-06-01T08:00:00Z")
+	if failure == nil || failure.Message != "End of time range before its start." {
+		t.Errorf("Inverted time range: %+v", failure)
+	}
+}
+
+// Every declared status must be reachable from the initial one, through transitions named after functions
+func TestStateMachines(t *testing.T) {
+	stub := newTestStub(t)
+	for _, objectType := range []string{USER, BIKE, RIDE, ISSUE, REPAIR} {
+		var machine StateMachine
+		err := json.Unmarshal(stub.mustInvoke("getStateMachine", objectType), &machine)
+		if err != nil || machine.ObjectType != objectType {
+			t.Fatalf("getStateMachine %s: %v %+v", objectType, err, machine)
+		}
+
+		declared := map[string]bool{}
+		for _, state := range machine.States {
+			declared[state] = true
+		}
+		if !declared[machine.Initial] {
+			t.Errorf("%s initial status %s not declared", objectType, machine.Initial)
+		}
+		for _, transition := range machine.Transitions {
+			if _, ok := findFunction(transition.Name); !ok {
+				t.Errorf("%s transition %s is not a function", objectType, transition.Name)
+			}
+			for _, state := range append(transition.From, transition.To) {
+				if !declared[state] {
+					t.Errorf("%s transition %s uses undeclared status %s", objectType, transition.Name, state)
+				}
+			}
+		}
+
+		reached := map[string]bool{machine.Initial: true}
+		for changed := true; changed; {
+			changed = false
+			for _, transition := range machine.Transitions {
+				for _, from := range transition.From {
+					if reached[from] && !reached[transition.To] {
+						reached[transition.To] = true
+						changed = true
+					}
+				}
+			}
+		}
+		for _, state := range machine.States {
+			if !reached[state] {
+				t.Errorf("%s status %s unreachable", objectType, state)
+			}
+		}
+	}
+}
+
+// Every function in the registry needs a success and a failure case above
+func TestEveryFunctionCovered(t *testing.T) {
+	succeeds, fails := map[string]bool{"setAccessControlList": true}, map[string]bool{}
+	for _, test := range transactionTests {
+		if test.err == "" {
+			succeeds[test.call.function] = true
+		} else {
+			fails[test.call.function] = true
+		}
+	}
+	for _, test := range queryTests {
+		if test.err == "" {
+			succeeds[test.call.function] = true
+		} else {
+			fails[test.call.function] = true
+		}
+	}
+	for _, function := range []string{"getTariff", "quoteRide", "getConfig", "getAccessControlList", "getChaincodeInfo", "listFunctions", "getStateMachine", "checkLocation", "getRideTrack", "getUserHistory", "getBikeHistory", "getRideHistory", "getRepairHistory"} {
+		succeeds[function] = true
+	}
+	badArguments := map[string]bool{}
+	for _, test := range badArgumentTests {
+		badArguments[test.function] = true
+		fails[test.function] = true
+	}
+
+	for _, spec := range getFunctionRegistry() {
+		function := spec.Name
+		if !succeeds[function] {
+			t.Errorf("No success case for %s", function)
+		}
+		if !fails[function] {
+			t.Errorf("No failure case for %s", function)
+		}
+		if !badArguments[function] {
+			t.Errorf("No bad arguments case for %s", function)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Configuration used before the provider has changed any setting
+func getDefaultConfig() *Config {
+	return &Config{CONFIG, 300, true, HOLD_DAILY_CAP, newMoney(DEFAULT_HOLD_DEPOSIT), 15, newMoney(0), 2}
+}
+
+// Get the chaincode configuration
+func getConfig(stub shim.ChaincodeStubInterface) (*Config, error) {
+	var config *Config
+
+	configKey, err := getConfigKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	configBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(configBytes) == 0 {
+		return getDefaultConfig(), nil
+	}
+
+	config = getDefaultConfig()
+	err = json.Unmarshal(configBytes, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -8,8 +8,77 @@ const (
 	RIDE				= "RIDE"
 	ISSUE				= "ISSUE"
 	REPAIR				= "REPAIR"
+	BALANCE_ENTRY		= "BALANCE_ENTRY"
+	TRACK_SEGMENT		= "TRACK_SEGMENT"
+	STATION				= "STATION"
+	ZONE				= "ZONE"
+	TARIFF				= "TARIFF"
+	CONFIG				= "CONFIG"
+	ACL					= "ACL"
 )
 
+// Access control roles
+const (
+	ROLE_PROVIDER		= "PROVIDER"
+	ROLE_USER			= "USER"
+	ROLE_REPAIRER		= "REPAIRER"
+)
+
+// Page sizes of paginated queries
+const (
+	DEFAULT_PAGE_SIZE	= 100
+	MAX_PAGE_SIZE		= 1000
+)
+
+// Chaincode version reported by getChaincodeInfo
+const CHAINCODE_VERSION = "1.1.0"
+
+// Environment variable enabling dev mode, which disables access control
+const DEV_MODE_ENV = "BSN_DEV_MODE"
+
+// Version of the chaincode event payload schema
+const EVENT_SCHEMA_VERSION = 2
+
+// Chaincode event types
+const (
+	EVENT_USER_REGISTERED		= "USER_REGISTERED"
+	EVENT_REPAIRER_REGISTERED	= "REPAIRER_REGISTERED"
+	EVENT_BIKE_REGISTERED		= "BIKE_REGISTERED"
+	EVENT_BIKE_REACTIVATED		= "BIKE_REACTIVATED"
+	EVENT_BIKE_DISCARDED		= "BIKE_DISCARDED"
+	EVENT_BIKE_LOCATION_UPDATED	= "BIKE_LOCATION_UPDATED"
+	EVENT_BIKE_RESERVED			= "BIKE_RESERVED"
+	EVENT_RESERVATION_CANCELLED	= "RESERVATION_CANCELLED"
+	EVENT_RIDE_STARTED			= "RIDE_STARTED"
+	EVENT_RIDE_ENDED			= "RIDE_ENDED"
+	EVENT_RIDE_VOIDED			= "RIDE_VOIDED"
+	EVENT_RIDE_TRACK_APPENDED	= "RIDE_TRACK_APPENDED"
+	EVENT_ISSUE_REPORTED		= "ISSUE_REPORTED"
+	EVENT_ISSUE_ACCEPTED		= "ISSUE_ACCEPTED"
+	EVENT_ISSUE_REJECTED		= "ISSUE_REJECTED"
+	EVENT_REPAIR_REQUESTED		= "REPAIR_REQUESTED"
+	EVENT_REPAIR_ACCEPTED		= "REPAIR_ACCEPTED"
+	EVENT_REPAIR_REJECTED		= "REPAIR_REJECTED"
+	EVENT_REPAIR_COMPLETED		= "REPAIR_COMPLETED"
+	EVENT_BALANCE_TOPPED_UP		= "BALANCE_TOPPED_UP"
+	EVENT_BALANCE_WITHDRAWN		= "BALANCE_WITHDRAWN"
+	EVENT_BALANCE_TRANSFERRED	= "BALANCE_TRANSFERRED"
+	EVENT_STATION_REGISTERED	= "STATION_REGISTERED"
+	EVENT_STATION_RESIZED		= "STATION_RESIZED"
+	EVENT_STATION_RETIRED		= "STATION_RETIRED"
+	EVENT_ZONE_DEFINED			= "ZONE_DEFINED"
+	EVENT_ZONE_REMOVED			= "ZONE_REMOVED"
+	EVENT_TARIFF_SET			= "TARIFF_SET"
+	EVENT_CONFIG_CHANGED		= "CONFIG_CHANGED"
+	EVENT_ACL_REPLACED			= "ACL_REPLACED"
+)
+
+// Certificate attribute holding the user or repairer ID an identity was enrolled for
+const ID_ATTRIBUTE = "bsn.id"
+
+// Certificate attribute, set to "true", that setAccessControlList requires of the provider administrators
+const ADMIN_ATTRIBUTE = "bsn.admin"
+
 // User state values
 const (
 	USER_FREE			= "USER_FREE"
@@ -19,6 +88,7 @@ const (
 // Bike state values
 const (
 	BIKE_AVAILABLE		= "BIKE_AVAILABLE"
+	BIKE_RESERVED		= "BIKE_RESERVED"
 	BIKE_IN_USE			= "BIKE_IN_USE"
 	BIKE_TO_REPAIR		= "BIKE_TO_REPAIR"
 	BIKE_REPAIRING		= "BIKE_REPAIRING"
@@ -32,6 +102,7 @@ const (
 	RIDE_COMPLETED		= "RIDE_COMPLETED"
 	RIDE_ISSUE_OPEN		= "RIDE_ISSUE_OPEN"
 	RIDE_ISSUE_CLOSED	= "RIDE_ISSUE_CLOSED"
+	RIDE_VOIDED			= "RIDE_VOIDED"
 )
 
 // Issue state values
@@ -46,4 +117,110 @@ const (
 	REPAIR_ACCEPTED		= "REPAIR_ACCEPTED"
 	REPAIR_REJECTED		= "REPAIR_REJECTED"
 	REPAIR_COMPLETED	= "REPAIR_COMPLETED"
+	REPAIR_CANCELLED	= "REPAIR_CANCELLED"
 )
+
+// Station state values
+const (
+	STATION_ACTIVE		= "STATION_ACTIVE"
+	STATION_RETIRED		= "STATION_RETIRED"
+)
+
+// Whether a station can take another bike
+const (
+	DOCKS_FREE			= "DOCKS_FREE"
+	DOCKS_FULL			= "DOCKS_FULL"
+	DOCKS_CLOSED		= "DOCKS_CLOSED"		// Retired
+)
+
+// Zone state values
+const (
+	ZONE_ACTIVE			= "ZONE_ACTIVE"
+	ZONE_REMOVED		= "ZONE_REMOVED"
+)
+
+// Zone types, with the fee each one applies to rides ending in or out of it
+const (
+	ZONE_SERVICE_AREA		= "ZONE_SERVICE_AREA"		// Surcharge for ending outside every service area
+	ZONE_NO_PARKING			= "ZONE_NO_PARKING"			// Surcharge for ending inside
+	ZONE_PREFERRED_PARKING	= "ZONE_PREFERRED_PARKING"	// Discount for ending inside
+)
+
+// Largest number of vertices of a zone polygon
+const MAX_ZONE_VERTICES = 1000
+
+// Longest reservation window
+const MAX_RESERVATION_MINUTES = 1440
+
+// Largest number of dock slots of a station
+const MAX_STATION_CAPACITY = 500
+
+// Key index of bike locations, one attribute per geohash character
+const GEOHASH_INDEX = "geohash~bike"
+
+// Geohash characters kept for a bike location, a cell of about 5 by 5 meters
+const GEOHASH_PRECISION = 9
+
+// Mean earth radius used for haversine distances
+const EARTH_RADIUS_METERS = 6371000
+
+// Ride track limits
+const (
+	MAX_TRACK_APPEND_SAMPLES	= 500
+	MAX_TRACK_SAMPLES			= 20000
+)
+
+// Track coordinates are stored in millionths of a degree, about 0.1 meters
+const TRACK_COORDINATE_SCALE = 1000000
+
+// Nearby bike search limits
+const (
+	MAX_NEARBY_RADIUS		= 50000		// Meters
+	DEFAULT_NEARBY_LIMIT	= 10
+	MAX_NEARBY_LIMIT		= 100
+)
+
+// Reasons of balance entries
+const (
+	REASON_REGISTRATION		= "REGISTRATION"
+	REASON_TOP_UP			= "TOP_UP"
+	REASON_WITHDRAWAL		= "WITHDRAWAL"
+	REASON_TRANSFER_OUT		= "TRANSFER_OUT"
+	REASON_TRANSFER_IN		= "TRANSFER_IN"
+	REASON_RIDE_CHARGE		= "RIDE_CHARGE"
+	REASON_ISSUE_REFUND		= "ISSUE_REFUND"
+	REASON_NO_SHOW_FEE		= "NO_SHOW_FEE"
+)
+
+// Currency of amounts given without a currency code
+const DEFAULT_CURRENCY = "USD"
+
+// Tariff rounding rules applied to the ride duration in minutes
+const (
+	ROUNDING_NONE		= "ROUNDING_NONE"
+	ROUNDING_UP			= "ROUNDING_UP"
+	ROUNDING_DOWN		= "ROUNDING_DOWN"
+	ROUNDING_NEAREST	= "ROUNDING_NEAREST"
+)
+
+// Configuration setting names
+const (
+	CONFIG_MAX_CLOCK_SKEW	= "MAX_CLOCK_SKEW_SECONDS"
+	CONFIG_RICH_QUERIES		= "RICH_QUERIES"
+	CONFIG_HOLD_POLICY		= "RIDE_HOLD_POLICY"
+	CONFIG_HOLD_DEPOSIT		= "RIDE_HOLD_DEPOSIT"
+	CONFIG_RESERVATION_MINUTES	= "RESERVATION_MINUTES"
+	CONFIG_NO_SHOW_FEE		= "NO_SHOW_FEE"
+	CONFIG_NO_SHOW_ALLOWANCE	= "NO_SHOW_ALLOWANCE"
+)
+
+// Amounts held from the balance of a user while a ride is ongoing
+const (
+	HOLD_NONE			= "HOLD_NONE"
+	HOLD_DEPOSIT		= "HOLD_DEPOSIT"		// The configured deposit
+	HOLD_DAILY_CAP		= "HOLD_DAILY_CAP"		// Unlock fee and daily cap of the tariff, or the deposit without a cap
+)
+
+// Deposit held before the provider sets one, in minor units, so that rides need a balance
+// to cover their start even under the default tariff, which has no daily cap
+const DEFAULT_HOLD_DEPOSIT = 500
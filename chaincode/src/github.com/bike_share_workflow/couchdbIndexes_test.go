@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const COUCHDB_INDEX_DIR = "META-INF/statedb/couchdb/indexes"
+
+type couchDBIndex struct {
+	Index	struct {
+		Fields	[]string	`json:"fields"`
+	}						`json:"index"`
+	Ddoc	string			`json:"ddoc"`
+	Name	string			`json:"name"`
+	Type	string			`json:"type"`
+}
+
+// Selector built in the chaincode source with newSelector(...).equals(...)
+type parsedSelector struct {
+	Position	string
+	DocType		string
+	Fields		[]string
+}
+
+// Collect the string constants declared in the package
+func parseStringConstants(files []*ast.File) map[string]string {
+	constants := map[string]string{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				valueSpec := spec.(*ast.ValueSpec)
+				for i, name := range valueSpec.Names {
+					if i >= len(valueSpec.Values) {
+						continue
+					}
+					literal, ok := valueSpec.Values[i].(*ast.BasicLit)
+					if !ok || literal.Kind != token.STRING {
+						continue
+					}
+					value, err := strconv.Unquote(literal.Value)
+					if err == nil {
+						constants[name.Name] = value
+					}
+				}
+			}
+		}
+	}
+	return constants
+}
+
+// Unwind a newSelector(DOC_TYPE).equals("field", ...) chain
+func parseSelectorChain(expr ast.Expr) (string, []string, bool) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return "", nil, false
+	}
+
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		if fun.Name != "newSelector" || len(call.Args) != 1 {
+			return "", nil, false
+		}
+		docType, ok := call.Args[0].(*ast.Ident)
+		if !ok {
+			return "", nil, false
+		}
+		return docType.Name, []string{}, true
+	case *ast.SelectorExpr:
+		if fun.Sel.Name != "equals" || len(call.Args) != 2 {
+			return "", nil, false
+		}
+		docType, fields, ok := parseSelectorChain(fun.X)
+		if !ok {
+			return "", nil, false
+		}
+		field, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || field.Kind != token.STRING {
+			return "", nil, false
+		}
+		name, err := strconv.Unquote(field.Value)
+		if err != nil {
+			return "", nil, false
+		}
+		return docType, append(fields, name), true
+	}
+	return "", nil, false
+}
+
+// Parse the chaincode source files of the package, without the tests
+func parseSourceFiles(t *testing.T) (*token.FileSet, []*ast.File) {
+	fileSet := token.NewFileSet()
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []*ast.File{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fileSet, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return fileSet, files
+}
+
+// Parse the chaincode source for every selector passed to the query layer
+func parseSelectors(t *testing.T) []parsedSelector {
+	fileSet, files := parseSourceFiles(t)
+	constants := parseStringConstants(files)
+
+	selectors := []parsedSelector{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			expr, ok := node.(ast.Expr)
+			if !ok {
+				return true
+			}
+			docTypeName, fields, ok := parseSelectorChain(expr)
+			if !ok {
+				return true
+			}
+			docType, ok := constants[docTypeName]
+			if !ok {
+				t.Errorf("%s: object type %s is not a string constant", fileSet.Position(expr.Pos()), docTypeName)
+				return false
+			}
+			selectors = append(selectors, parsedSelector{fileSet.Position(expr.Pos()).String(), docType, fields})
+			// The inner calls of the chain are part of this selector
+			return false
+		})
+	}
+
+	return selectors
+}
+
+func loadCouchDBIndexes(t *testing.T) map[string]couchDBIndex {
+	paths, err := filepath.Glob(filepath.Join(COUCHDB_INDEX_DIR, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("No index definitions found in %s", COUCHDB_INDEX_DIR)
+	}
+
+	indexes := map[string]couchDBIndex{}
+	for _, path := range paths {
+		var index couchDBIndex
+		indexBytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(indexBytes, &index)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if index.Name == "" || index.Ddoc == "" || index.Type != "json" || len(index.Index.Fields) == 0 {
+			t.Errorf("%s: index needs a name, a design document, type json and fields", path)
+		}
+		indexes[path] = index
+	}
+
+	return indexes
+}
+
+// An index covers a selector when it starts with docType, continues with exactly
+// the selector's equality fields and ends with _id, the sort key of paged queries
+func coversSelector(index couchDBIndex, selector parsedSelector) bool {
+	fields := index.Index.Fields
+	if len(fields) != len(selector.Fields) + 2 || fields[0] != "docType" || fields[len(fields) - 1] != "_id" {
+		return false
+	}
+
+	indexed := append([]string{}, fields[1:len(fields) - 1]...)
+	selected := append([]string{}, selector.Fields...)
+	sort.Strings(indexed)
+	sort.Strings(selected)
+	for i := range indexed {
+		if indexed[i] != selected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEverySelectorHasCoveringIndex(t *testing.T) {
+	selectors := parseSelectors(t)
+	indexes := loadCouchDBIndexes(t)
+	if len(selectors) == 0 {
+		t.Fatal("No selectors found in the chaincode source")
+	}
+
+	used := map[string]bool{}
+	for _, selector := range selectors {
+		covered := false
+		for path, index := range indexes {
+			if coversSelector(index, selector) {
+				covered = true
+				used[path] = true
+			}
+		}
+		if !covered {
+			t.Errorf("%s: no index in %s covers docType %s with fields %v", selector.Position, COUCHDB_INDEX_DIR, selector.DocType, selector.Fields)
+		}
+	}
+
+	for path := range indexes {
+		if !used[path] {
+			t.Errorf("%s: index is not used by any selector", path)
+		}
+	}
+}
+
+func TestIndexNamesAreUnique(t *testing.T) {
+	names := map[string]string{}
+	for path, index := range loadCouchDBIndexes(t) {
+		if other, ok := names[index.Name]; ok {
+			t.Errorf("%s: index name %s already used by %s", path, index.Name, other)
+		}
+		names[index.Name] = path
+	}
+}
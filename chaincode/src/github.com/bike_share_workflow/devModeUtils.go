@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version and access control status reported by getChaincodeInfo
+type ChaincodeInfo struct {
+	Version			string		`json:"version"`
+	ChaincodeId		string		`json:"chaincodeId"`		// Name and version the peer launched
+	DevMode			bool		`json:"devMode"`
+	AccessControl	bool		`json:"accessControl"`
+}
+
+// Read the requested dev mode from the environment; unset means dev mode is off
+func getRequestedDevMode(getenv func(string) string) (bool, error) {
+	value := getenv(DEV_MODE_ENV)
+	if value == "" {
+		return false, nil
+	}
+	devMode, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Malformed %s value %s.", DEV_MODE_ENV, value))
+	}
+	return devMode, nil
+}
+
+// A peer running in net mode launches the chaincode with a -peer.address flag,
+// whereas in dev-mode networking (peer node start --peer-chaincodedev) the
+// chaincode is started by hand with CORE_PEER_ADDRESS set in the environment.
+// Anything else, including a peer address given both ways, counts as net mode.
+func isPeerDevModeNetworking(args []string, getenv func(string) string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(strings.TrimLeft(arg, "-"), "peer.address") {
+			return false
+		}
+	}
+	return getenv("CORE_PEER_ADDRESS") != ""
+}
+
+// Decide whether access control is disabled, given the command line arguments and environment
+// of the chaincode process, refusing dev mode outside dev-mode networking
+func resolveDevMode(args []string, getenv func(string) string) (bool, error) {
+	devMode, err := getRequestedDevMode(getenv)
+	if err != nil {
+		return false, err
+	}
+	if devMode && !isPeerDevModeNetworking(args, getenv) {
+		return false, errors.New(fmt.Sprintf("%s is set but the peer is not running in dev-mode networking. Refusing to disable access control.", DEV_MODE_ENV))
+	}
+	return devMode, nil
+}
+
+func logDevMode(devMode bool) {
+	if devMode {
+		fmt.Println("****************************************************************")
+		fmt.Println("* BikeShareWorkflow running in DEV MODE: access control is OFF *")
+		fmt.Println("****************************************************************")
+	} else {
+		fmt.Println("BikeShareWorkflow running with access control enabled.")
+	}
+}
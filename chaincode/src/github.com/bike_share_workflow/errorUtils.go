@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Error codes returned in the code field of failed responses. Codes are stable,
+// so clients may map them to localized text; messages may change.
+const (
+	// The request itself
+	ERR_UNKNOWN_FUNCTION			= "UNKNOWN_FUNCTION"			// No function with the invoked name
+	ERR_BAD_ARGUMENT				= "BAD_ARGUMENT"				// Wrong argument count, or a missing, malformed or out of range argument
+	ERR_ACCESS_DENIED				= "ACCESS_DENIED"				// Caller not permitted by the ACL, or not the owner of the user or repairer
+	ERR_INVALID_ACL					= "INVALID_ACL"					// ACL refers to undefined roles or locks out its own updates
+
+	// Entities
+	ERR_NOT_FOUND					= "NOT_FOUND"					// No entity with the given ID
+	ERR_ALREADY_EXISTS				= "ALREADY_EXISTS"				// An entity with the given ID exists
+	ERR_USER_MISMATCH				= "USER_MISMATCH"				// The ride belongs to another user
+	ERR_RIDE_MISMATCH				= "RIDE_MISMATCH"				// The user's ongoing ride is another one
+	ERR_REPAIRER_MISMATCH			= "REPAIRER_MISMATCH"			// The repair is assigned to another repairer
+
+	// Refused status transitions
+	ERR_USER_HAS_ONGOING_RIDE		= "USER_HAS_ONGOING_RIDE"
+	ERR_USER_NO_ONGOING_RIDE		= "USER_NO_ONGOING_RIDE"
+	ERR_INSUFFICIENT_BALANCE		= "INSUFFICIENT_BALANCE"
+	ERR_BIKE_NOT_AVAILABLE			= "BIKE_NOT_AVAILABLE"
+	ERR_BIKE_RESERVED				= "BIKE_RESERVED"				// Reserved for another user
+	ERR_BIKE_NOT_RESERVED			= "BIKE_NOT_RESERVED"
+	ERR_USER_HAS_RESERVATION		= "USER_HAS_RESERVATION"		// The user holds a reservation of another bike
+	ERR_BIKE_NOT_IN_USE				= "BIKE_NOT_IN_USE"
+	ERR_BIKE_NOT_READY_TO_REPAIR	= "BIKE_NOT_READY_TO_REPAIR"
+	ERR_BIKE_NOT_REPAIRING			= "BIKE_NOT_REPAIRING"
+	ERR_BIKE_ACTIVE					= "BIKE_ACTIVE"					// The bike is in service and needs no reactivation
+	ERR_BIKE_UNDER_REPAIR			= "BIKE_UNDER_REPAIR"
+	ERR_BIKE_DISCARDED				= "BIKE_DISCARDED"
+	ERR_RIDE_NOT_ONGOING			= "RIDE_NOT_ONGOING"
+	ERR_RIDE_NOT_COMPLETED			= "RIDE_NOT_COMPLETED"
+	ERR_RIDE_NO_OPEN_ISSUE			= "RIDE_NO_OPEN_ISSUE"
+	ERR_ISSUE_NOT_OPEN				= "ISSUE_NOT_OPEN"
+	ERR_REPAIR_ALREADY_PROCESSED	= "REPAIR_ALREADY_PROCESSED"
+	ERR_REPAIR_NOT_ACCEPTED			= "REPAIR_NOT_ACCEPTED"
+	ERR_STATION_RETIRED				= "STATION_RETIRED"
+	ERR_STATION_NOT_EMPTY			= "STATION_NOT_EMPTY"			// Bikes are docked at the station or in the slots removed
+	ERR_ZONE_REMOVED				= "ZONE_REMOVED"
+
+	// Docking
+	ERR_STATION_FULL				= "STATION_FULL"
+	ERR_BIKE_NOT_AT_STATION			= "BIKE_NOT_AT_STATION"			// The bike is docked elsewhere or not at all
+
+	// Times and amounts
+	ERR_DEVICE_TIME_SKEWED			= "DEVICE_TIME_SKEWED"			// Device time too far from the transaction time
+	ERR_END_BEFORE_START			= "END_BEFORE_START"			// Ride would end before it started
+	ERR_CURRENCY_MISMATCH			= "CURRENCY_MISMATCH"
+
+	// Anything else, such as ledger and marshaling failures
+	ERR_INTERNAL					= "INTERNAL_ERROR"
+)
+
+// Error returned as the JSON message of a failed response
+type ChaincodeError struct {
+	Code			string		`json:"code"`
+	Message			string		`json:"message"`
+	EntityType		string		`json:"entityType,omitempty"`
+	EntityId		string		`json:"entityId,omitempty"`		// ID of the offending entity
+	ArgIndex		int			`json:"argIndex"`				// Index of the offending argument, -1 if none
+}
+
+func newError(code string, message string) *ChaincodeError {
+	return &ChaincodeError{code, message, "", "", -1}
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
+
+func (e *ChaincodeError) withEntity(entityType string, id string) *ChaincodeError {
+	e.EntityType = entityType
+	e.EntityId = id
+	return e
+}
+
+func (e *ChaincodeError) withArg(index int) *ChaincodeError {
+	e.ArgIndex = index
+	return e
+}
+
+// Error in the value of a declared argument
+func badArgument(args *Args, name string, message string) *ChaincodeError {
+	return newError(ERR_BAD_ARGUMENT, message).withArg(args.Index(name))
+}
+
+// Failed response carrying the error as JSON; errors without a code are internal
+func errorResponse(err error) pb.Response {
+	chaincodeError, ok := err.(*ChaincodeError)
+	if !ok {
+		chaincodeError = newError(ERR_INTERNAL, err.Error())
+	}
+
+	errorBytes, err := json.Marshal(chaincodeError)
+	if err != nil {
+		return shim.Error(chaincodeError.Message)
+	}
+	return shim.Error(string(errorBytes))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Status change of one entity; statuses are empty for creations and for entities without status
+type EventChange struct {
+	EntityType		string		`json:"entityType"`
+	EntityId		string		`json:"entityId"`
+	OldStatus		string		`json:"oldStatus"`
+	NewStatus		string		`json:"newStatus"`
+}
+
+// Payload of the single chaincode event a transaction may emit, batching every entity it changed
+type Event struct {
+	SchemaVersion	int				`json:"schemaVersion"`
+	Type			string			`json:"type"`
+	Actor			string			`json:"actor"`		// Identity of the caller, as MSP ID and cid.GetID
+	ActingAs		string			`json:"actingAs"`	// User or repairer ID the caller acts as; empty for providers
+	TxId			string			`json:"txId"`
+	Changes			[]EventChange	`json:"changes"`
+}
+
+// New event of the calling identity. Invoke has already read the identity unless in dev mode,
+// where a transaction without a creator, such as one of a mock stub, leaves the actor empty.
+func newEvent(stub shim.ChaincodeStubInterface, eventType string, actingAs string) *Event {
+	actor, err := getTxCreatorID(stub)
+	if err != nil {
+		actor = ""
+	}
+	return &Event{EVENT_SCHEMA_VERSION, eventType, actor, actingAs, stub.GetTxID(), []EventChange{}}
+}
+
+// Record the status change of an entity. An entity changed twice in a transaction, such as a
+// bike whose expired reservation is released before it is taken, keeps one change from its
+// first status to its last.
+func (e *Event) addChange(entityType string, entityId string, oldStatus string, newStatus string) *Event {
+	for i, change := range e.Changes {
+		if change.EntityType == entityType && change.EntityId == entityId {
+			e.Changes[i].NewStatus = newStatus
+			return e
+		}
+	}
+	e.Changes = append(e.Changes, EventChange{entityType, entityId, oldStatus, newStatus})
+	return e
+}
+
+// Set the event on the transaction, named after its type so listeners can filter on it
+func emitEvent(stub shim.ChaincodeStubInterface, event *Event) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(event.Type, eventBytes)
+}
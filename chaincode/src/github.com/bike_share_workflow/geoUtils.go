@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Available bike returned by a nearby search
+type NearbyBike struct {
+	Key				string		`json:"Key"`
+	Value			*Bike		`json:"Value"`
+	DistanceMeters	float64		`json:"distanceMeters"`
+}
+
+func isValidLocation(longitude float64, latitude float64) bool {
+	return longitude >= -180 && longitude <= 180 && latitude >= -90 && latitude <= 90
+}
+
+// Geohash of a location. Bits alternate between longitude and latitude, starting
+// with longitude, each one halving the remaining range.
+func encodeGeohash(longitude float64, latitude float64, precision int) string {
+	lonRange := []float64{-180, 180}
+	latRange := []float64{-90, 90}
+	hash := make([]byte, 0, precision)
+	bits, char, even := 0, 0, true
+	for len(hash) < precision {
+		value, valueRange := latitude, latRange
+		if even {
+			value, valueRange = longitude, lonRange
+		}
+		mid := (valueRange[0] + valueRange[1]) / 2
+		char <<= 1
+		if value >= mid {
+			char |= 1
+			valueRange[0] = mid
+		} else {
+			valueRange[1] = mid
+		}
+		even = !even
+		bits++
+		if bits == 5 {
+			hash = append(hash, geohashAlphabet[char])
+			bits, char = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// Width and height in degrees of the geohash cells of a precision
+func geohashCellSize(precision int) (float64, float64) {
+	lonBits := uint((5 * precision + 1) / 2)
+	latBits := uint(5 * precision / 2)
+	return 360 / float64(uint64(1) << lonBits), 180 / float64(uint64(1) << latBits)
+}
+
+// Record the location of a bike together with its geohash. Locations outside the
+// coordinate ranges keep the bike off the geohash index.
+func setBikeLocation(bike *Bike, location []float32) {
+	bike.Location = location
+	bike.Geohash = ""
+	if len(location) == 2 && isValidLocation(float64(location[0]), float64(location[1])) {
+		bike.Geohash = encodeGeohash(float64(location[0]), float64(location[1]), GEOHASH_PRECISION)
+	}
+}
+
+// Great-circle distance in meters between two locations
+func haversineDistance(longitude1 float64, latitude1 float64, longitude2 float64, latitude2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (latitude2 - latitude1) * toRadians
+	dLon := (longitude2 - longitude1) * toRadians
+	a := math.Sin(dLat / 2) * math.Sin(dLat / 2) + math.Cos(latitude1 * toRadians) * math.Cos(latitude2 * toRadians) * math.Sin(dLon / 2) * math.Sin(dLon / 2)
+	return 2 * EARTH_RADIUS_METERS * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Geohash prefixes of the cells to scan for locations within a radius: the cell of the
+// center and its eight neighbors, at the finest precision whose cells are at least as
+// wide and high as the radius. No prefix at all means the whole index is scanned, which
+// happens for radii too large for the cells at the latitude of the center.
+func getGeohashSearchCells(longitude float64, latitude float64, radius float64) []string {
+	metersPerDegree := EARTH_RADIUS_METERS * math.Pi / 180
+	// Cells are narrowest on the side of the search area nearest to a pole
+	farLatitude := math.Min(90, math.Abs(latitude) + radius / metersPerDegree)
+	precision := 0
+	for p := GEOHASH_PRECISION; p >= 1; p-- {
+		width, height := geohashCellSize(p)
+		if height * metersPerDegree >= radius && width * metersPerDegree * math.Cos(farLatitude * math.Pi / 180) >= radius {
+			precision = p
+			break
+		}
+	}
+	if precision == 0 {
+		return []string{""}
+	}
+
+	width, height := geohashCellSize(precision)
+	centerLon := (math.Floor((longitude + 180) / width) + 0.5) * width - 180
+	centerLat := (math.Floor((latitude + 90) / height) + 0.5) * height - 90
+	cells := []string{}
+	seen := map[string]bool{}
+	for dLat := -1; dLat <= 1; dLat++ {
+		cellLat := centerLat + float64(dLat) * height
+		if cellLat < -90 || cellLat > 90 {
+			continue
+		}
+		for dLon := -1; dLon <= 1; dLon++ {
+			// Longitudes wrap around the antimeridian
+			cellLon := centerLon + float64(dLon) * width
+			if cellLon < -180 {
+				cellLon += 360
+			} else if cellLon >= 180 {
+				cellLon -= 360
+			}
+			cell := encodeGeohash(cellLon, cellLat, precision)
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+	sort.Strings(cells)
+	return cells
+}
+
+// Get the IDs of the bikes indexed under a geohash prefix
+func getBikeIDsInCell(stub shim.ChaincodeStubInterface, cell string) ([]string, error) {
+	attributes := []string{}
+	if cell != "" {
+		attributes = strings.Split(cell, "")
+	}
+	iterator, err := getIndexRange(stub, GEOHASH_INDEX, attributes, "")
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	ids := []string{}
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		keyAttributes := splitIndexKey(kv.Key)
+		ids = append(ids, keyAttributes[len(keyAttributes) - 1])
+	}
+	return ids, nil
+}
+
+// Get the available bikes within a radius of a location through the geohash index,
+// nearest first and by ID at equal distance, up to a limit. Bikes whose reservation
+// ran out by the given time count as available.
+func getBikesNear(stub shim.ChaincodeStubInterface, longitude float64, latitude float64, radius float64, limit int, now time.Time) ([]NearbyBike, error) {
+	nearby := []NearbyBike{}
+	seen := map[string]bool{}
+	for _, cell := range getGeohashSearchCells(longitude, latitude, radius) {
+		ids, err := getBikeIDsInCell(stub, cell)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			bike, err := bikes(stub).MustGet(id)
+			if err != nil {
+				return nil, err
+			}
+			expired, err := reservationExpired(bike, now)
+			if err != nil {
+				return nil, err
+			}
+			if (bike.Status != BIKE_AVAILABLE && !expired) || len(bike.Location) != 2 {
+				continue
+			}
+			distance := haversineDistance(longitude, latitude, float64(bike.Location[0]), float64(bike.Location[1]))
+			if distance > radius {
+				continue
+			}
+			key, err := getBikeKey(stub, bike.Id)
+			if err != nil {
+				return nil, err
+			}
+			nearby = append(nearby, NearbyBike{key, bike, distance})
+		}
+	}
+
+	sort.Slice(nearby, func(i, j int) bool {
+		if nearby[i].DistanceMeters != nearby[j].DistanceMeters {
+			return nearby[i].DistanceMeters < nearby[j].DistanceMeters
+		}
+		return nearby[i].Value.Id < nearby[j].Value.Id
+	})
+	if len(nearby) > limit {
+		nearby = nearby[:limit]
+	}
+	return nearby, nil
+}
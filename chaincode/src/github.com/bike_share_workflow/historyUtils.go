@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// One modification of a key, as recorded in the history database
+type HistoryEntry struct {
+	TxId			string			`json:"txId"`
+	Timestamp		string			`json:"timestamp"`
+	IsDelete		bool			`json:"isDelete"`
+	Value			json.RawMessage	`json:"value"`
+}
+
+// Get a page of the modifications of a key within an optional time range. The
+// history of a key only grows, so the bookmark is the number of modifications
+// already consumed, whether or not they fell in the time range.
+func getHistoryPage(stub shim.ChaincodeStubInterface, key string, pageSize int, bookmark string, from *time.Time, to *time.Time) (*QueryPage, error) {
+	offset := 0
+	if bookmark != "" {
+		var err error
+		offset, err = strconv.Atoi(bookmark)
+		if err != nil || offset < 0 {
+			return nil, newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Malformed bookmark %s.", bookmark))
+		}
+	}
+
+	iterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	entries := []HistoryEntry{}
+	consumed := 0
+	for iterator.HasNext() {
+		if len(entries) == pageSize {
+			return &QueryPage{entries, len(entries), strconv.Itoa(consumed)}, nil
+		}
+
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		consumed++
+		if consumed <= offset {
+			continue
+		}
+
+		timestamp := time.Unix(modification.Timestamp.GetSeconds(), int64(modification.Timestamp.GetNanos())).UTC()
+		if (from != nil && timestamp.Before(*from)) || (to != nil && timestamp.After(*to)) {
+			continue
+		}
+
+		value := json.RawMessage("null")
+		if !modification.IsDelete && json.Valid(modification.Value) {
+			value = json.RawMessage(modification.Value)
+		}
+		entries = append(entries, HistoryEntry{modification.TxId, formatTimestamp(timestamp), modification.IsDelete, value})
+	}
+
+	return &QueryPage{entries, len(entries), ""}, nil
+}
+
+// Get the optional bounds of a time range; omitted bounds leave the range open
+func parseTimeRange(args *Args) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if args.Has("FROM_TIME") {
+		t := args.Time("FROM_TIME")
+		from = &t
+	}
+	if args.Has("TO_TIME") {
+		t := args.Time("TO_TIME")
+		to = &t
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, nil, badArgument(args, "TO_TIME", "End of time range before its start.")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Secondary index over one field of an object type. Index entries are keys of the
+// form {Name}{field value}{entity ID} with a placeholder value.
+type IndexDef struct {
+	Name			string
+	Field			string
+}
+
+// Secondary indexes of each object type, serving the get* queries without rich queries.
+// The docType index lists all records of a type.
+var secondaryIndexes = map[string][]IndexDef{
+	USER: {{"docType~user", "docType"}},
+	REPAIRER: {{"docType~repairer", "docType"}},
+	BIKE: {{"docType~bike", "docType"}, {"status~bike", "status"}, {"station~bike", "stationId"}},
+	RIDE: {{"docType~ride", "docType"}, {"status~ride", "status"}, {"user~ride", "userId"}, {"bike~ride", "bikeId"}},
+	ISSUE: {{"docType~issue", "docType"}, {"status~issue", "status"}, {"user~issue", "userId"}, {"bike~issue", "bikeId"}, {"ride~issue", "rideId"}},
+	REPAIR: {{"docType~repair", "docType"}, {"status~repair", "status"}, {"bike~repair", "bikeId"}, {"repairer~repair", "repairerId"}},
+	BALANCE_ENTRY: {{"docType~balanceEntry", "docType"}, {"user~balanceEntry", "userId"}},
+	TRACK_SEGMENT: {{"docType~trackSegment", "docType"}, {"ride~trackSegment", "rideId"}},
+	STATION: {{"docType~station", "docType"}, {"dockAvailability~station", "dockAvailability"}},
+	ZONE: {{"docType~zone", "docType"}, {"status~zone", "status"}},
+}
+
+// Prefix indexes take one key attribute per character of the field value, so a partial
+// key finds the entities whose value starts with a given prefix. Empty values
+// are left out. Selectors are never served from them.
+var prefixIndexes = map[string][]IndexDef{
+	BIKE: {{GEOHASH_INDEX, "geohash"}},
+}
+
+// Object types with secondary indexes, in the order they are rebuilt
+var indexedObjectTypes = []string{USER, REPAIRER, BIKE, RIDE, ISSUE, REPAIR, BALANCE_ENTRY, TRACK_SEGMENT, STATION, ZONE}
+
+// Object types of the primary keys created in keyUtils.go
+var primaryKeyObjectTypes = map[string]string{
+	USER: "User-",
+	REPAIRER: "Repairer-",
+	BIKE: "Bike-",
+	RIDE: "Ride-",
+	ISSUE: "Issue-",
+	REPAIR: "Repair-",
+	BALANCE_ENTRY: "BalanceEntry-",
+	TRACK_SEGMENT: "TrackSegment-",
+	STATION: "Station-",
+	ZONE: "Zone-",
+}
+
+// PutState writes an empty value as a delete, so index entries hold a placeholder
+var indexEntryValue = []byte{0x00}
+
+// Index entries are laid out like composite keys, each attribute followed by a null
+// character, but are simple keys: Fabric 1.1 refuses composite keys in GetStateByRange,
+// which a page needs to resume after its bookmark
+const indexKeySeparator = "\x00"
+
+func createIndexKey(name string, attributes []string) (string, error) {
+	key := name + indexKeySeparator
+	for _, attribute := range attributes {
+		if !utf8.ValidString(attribute) || strings.ContainsAny(attribute, indexKeySeparator + string(utf8.MaxRune)) {
+			return "", errors.New(fmt.Sprintf("Index key attribute %q must be UTF-8 without U+0000 or U+10FFFF.", attribute))
+		}
+		key += attribute + indexKeySeparator
+	}
+	return key, nil
+}
+
+// Key attributes of an index entry
+func splitIndexKey(key string) []string {
+	parts := strings.Split(key, indexKeySeparator)
+	return parts[1:len(parts) - 1]
+}
+
+// Iterate the entries of an index whose key attributes start with the given ones, in key
+// order, starting after the given index key if any
+func getIndexRange(stub shim.ChaincodeStubInterface, name string, attributes []string, startAfter string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := createIndexKey(name, attributes)
+	if err != nil {
+		return nil, err
+	}
+	start := prefix
+	if startAfter >= prefix {
+		// The first key sorting after startAfter
+		start = startAfter + indexKeySeparator
+	}
+	return stub.GetStateByRange(start, prefix + string(utf8.MaxRune))
+}
+
+// Delete every entry of an index
+func clearIndex(stub shim.ChaincodeStubInterface, name string) error {
+	iterator, err := getIndexRange(stub, name, []string{}, "")
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		err = stub.DelState(kv.Key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getPrimaryKey(stub shim.ChaincodeStubInterface, docType string, id string) (string, error) {
+	objectType, ok := primaryKeyObjectTypes[docType]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Unknown object type %s.", docType))
+	}
+	return stub.CreateCompositeKey(objectType, []string{id})
+}
+
+func findIndex(docType string, field string) (IndexDef, bool) {
+	for _, index := range secondaryIndexes[docType] {
+		if index.Field == field {
+			return index, true
+		}
+	}
+	return IndexDef{}, false
+}
+
+// Secondary and prefix indexes of an object type
+func getIndexes(docType string) []IndexDef {
+	indexes := []IndexDef{}
+	indexes = append(indexes, secondaryIndexes[docType]...)
+	return append(indexes, prefixIndexes[docType]...)
+}
+
+func isPrefixIndex(index IndexDef) bool {
+	for _, docIndexes := range prefixIndexes {
+		for _, prefixIndex := range docIndexes {
+			if prefixIndex.Name == index.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Key attributes of the index entry of an entity, and whether the entity has one
+func getIndexAttributes(index IndexDef, value string, id string) ([]string, bool) {
+	if !isPrefixIndex(index) {
+		return []string{value, id}, true
+	}
+	if value == "" {
+		return nil, false
+	}
+	return append(strings.Split(value, ""), id), true
+}
+
+// Decode the object type, ID and indexed field values of a ledger document
+func getIndexedValues(value []byte) (string, string, map[string]string, error) {
+	var document map[string]interface{}
+
+	if len(value) == 0 {
+		return "", "", nil, nil
+	}
+	err := json.Unmarshal(value, &document)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	docType, _ := document["docType"].(string)
+	id, _ := document["id"].(string)
+	values := map[string]string{}
+	for _, index := range getIndexes(docType) {
+		fieldValue, _ := document[index.Field].(string)
+		values[index.Name] = fieldValue
+	}
+
+	return docType, id, values, nil
+}
+
+// Bring the index entries of a document in line with its new value, given the value currently committed
+func updateIndexes(stub shim.ChaincodeStubInterface, oldValue []byte, newValue []byte) error {
+	_, oldID, oldValues, err := getIndexedValues(oldValue)
+	if err != nil {
+		return err
+	}
+	docType, id, newValues, err := getIndexedValues(newValue)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range getIndexes(docType) {
+		if oldValues != nil && oldID == id && oldValues[index.Name] == newValues[index.Name] {
+			continue
+		}
+		if oldValues != nil {
+			oldAttributes, ok := getIndexAttributes(index, oldValues[index.Name], oldID)
+			if ok {
+				oldIndexKey, err := createIndexKey(index.Name, oldAttributes)
+				if err != nil {
+					return err
+				}
+				err = stub.DelState(oldIndexKey)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		attributes, ok := getIndexAttributes(index, newValues[index.Name], id)
+		if !ok {
+			continue
+		}
+		indexKey, err := createIndexKey(index.Name, attributes)
+		if err != nil {
+			return err
+		}
+		err = stub.PutState(indexKey, indexEntryValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stub of one transaction remembering the values it wrote. A transaction reads the committed
+// state, not its own writes, so an entity written twice would otherwise have its index entries
+// updated twice from the committed value, leaving the entries of the first write behind.
+type transactionStub struct {
+	shim.ChaincodeStubInterface
+	written			map[string][]byte
+}
+
+func newTransactionStub(stub shim.ChaincodeStubInterface) *transactionStub {
+	return &transactionStub{stub, map[string][]byte{}}
+}
+
+func (s *transactionStub) PutState(key string, value []byte) error {
+	err := s.ChaincodeStubInterface.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	s.written[key] = value
+	return nil
+}
+
+func (s *transactionStub) DelState(key string) error {
+	err := s.ChaincodeStubInterface.DelState(key)
+	if err != nil {
+		return err
+	}
+	s.written[key] = nil
+	return nil
+}
+
+// Value of a key as the transaction leaves it: the last value it wrote, or the committed one
+func getWrittenState(stub shim.ChaincodeStubInterface, key string) ([]byte, error) {
+	if txStub, ok := stub.(*transactionStub); ok {
+		if value, ok := txStub.written[key]; ok {
+			return value, nil
+		}
+	}
+	return stub.GetState(key)
+}
+
+// Write an entity document together with its secondary index entries. Invoke runs every
+// handler on a transactionStub, so the entries replaced are those of the last value written.
+func putState(stub shim.ChaincodeStubInterface, key string, value []byte) error {
+	oldValue, err := getWrittenState(stub, key)
+	if err != nil {
+		return err
+	}
+	err = updateIndexes(stub, oldValue, value)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, value)
+}
+
+// Rewrite the index entries of every document of an object type, for records written before the
+// indexes existed or by a version that left entries behind. The indexes are cleared first, so no
+// entry outlives the value it was written for.
+func rebuildIndexes(stub shim.ChaincodeStubInterface, docType string) (int, error) {
+	for _, index := range getIndexes(docType) {
+		err := clearIndex(stub, index.Name)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	iterator, err := stub.GetStateByPartialCompositeKey(primaryKeyObjectTypes[docType], []string{})
+	if err != nil {
+		return 0, err
+	}
+	defer iterator.Close()
+
+	count := 0
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return count, err
+		}
+		err = updateIndexes(stub, nil, kv.Value)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Split a selector built by newSelector into its object type and the one field it filters on, if any
+func getSelectorFilter(selector Selector) (string, string, string, error) {
+	docType, _ := selector["docType"].(string)
+	field, value := "", ""
+	fields := []string{}
+	for name := range selector {
+		if name != "docType" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	if len(fields) > 1 {
+		return "", "", "", errors.New(fmt.Sprintf("Selector on fields %v cannot be served from a single index.", fields))
+	}
+	if len(fields) == 1 {
+		field = fields[0]
+		var ok bool
+		value, ok = selector[field].(string)
+		if !ok {
+			return "", "", "", errors.New(fmt.Sprintf("Selector on field %s cannot be served from an index.", field))
+		}
+	}
+
+	return docType, field, value, nil
+}
+
+// Get a page of the documents matching a selector through secondary index entries. Results
+// are ordered by primary key, like the rich query path, and the next page resumes the index
+// after the entry of the last primary key returned. A page size of 0 means no limit.
+func getIndexQueryPage(stub shim.ChaincodeStubInterface, selector Selector, pageSize int, startAfter string) ([]QueryRecord, string, error) {
+	docType, field, value, err := getSelectorFilter(selector)
+	if err != nil {
+		return nil, "", err
+	}
+	objectType, ok := primaryKeyObjectTypes[docType]
+	if !ok {
+		return nil, "", errors.New(fmt.Sprintf("Unknown object type %s.", docType))
+	}
+
+	records := []QueryRecord{}
+
+	// Queries by ID read the document directly
+	if field == "id" {
+		key, err := getPrimaryKey(stub, docType, value)
+		if err != nil {
+			return nil, "", err
+		}
+		document, err := stub.GetState(key)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(document) != 0 && key > startAfter {
+			records = append(records, QueryRecord{key, json.RawMessage(document)})
+		}
+		return records, "", nil
+	}
+
+	// Queries without a field list the docType index
+	if field == "" {
+		field, value = "docType", docType
+	}
+	index, ok := findIndex(docType, field)
+	if !ok {
+		return nil, "", errors.New(fmt.Sprintf("No index on field %s of %s.", field, docType))
+	}
+
+	// Index entries sort by ID within a value, as primary keys do
+	startAfterEntry := ""
+	if startAfter != "" {
+		keyObjectType, attributes, err := stub.SplitCompositeKey(startAfter)
+		if err != nil || keyObjectType != objectType || len(attributes) != 1 {
+			return nil, "", newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Malformed bookmark %s.", encodeBookmark(startAfter)))
+		}
+		startAfterEntry, err = createIndexKey(index.Name, []string{value, attributes[0]})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	iterator, err := getIndexRange(stub, index.Name, []string{value}, startAfterEntry)
+	if err != nil {
+		return nil, "", err
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if pageSize > 0 && len(records) == pageSize {
+			return records, records[len(records) - 1].Key, nil
+		}
+		attributes := splitIndexKey(kv.Key)
+		key, err := getPrimaryKey(stub, docType, attributes[len(attributes) - 1])
+		if err != nil {
+			return nil, "", err
+		}
+		document, err := stub.GetState(key)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(document) == 0 {
+			continue
+		}
+		records = append(records, QueryRecord{key, json.RawMessage(document)})
+	}
+
+	return records, "", nil
+}
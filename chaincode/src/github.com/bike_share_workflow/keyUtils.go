@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 )
 
@@ -57,3 +58,75 @@ func getRepairKey(stub shim.ChaincodeStubInterface, repairID string) (string, er
 		return repairKey, nil
 	}
 }
+
+func getBalanceEntryKey(stub shim.ChaincodeStubInterface, entryID string) (string, error) {
+	entryKey, err := stub.CreateCompositeKey("BalanceEntry-", []string{entryID})
+	if err != nil {
+		return "", err
+	} else {
+		return entryKey, nil
+	}
+}
+
+func getTrackSegmentKey(stub shim.ChaincodeStubInterface, segmentID string) (string, error) {
+	segmentKey, err := stub.CreateCompositeKey("TrackSegment-", []string{segmentID})
+	if err != nil {
+		return "", err
+	} else {
+		return segmentKey, nil
+	}
+}
+
+func getStationKey(stub shim.ChaincodeStubInterface, stationID string) (string, error) {
+	stationKey, err := stub.CreateCompositeKey("Station-", []string{stationID})
+	if err != nil {
+		return "", err
+	} else {
+		return stationKey, nil
+	}
+}
+
+func getZoneKey(stub shim.ChaincodeStubInterface, zoneID string) (string, error) {
+	zoneKey, err := stub.CreateCompositeKey("Zone-", []string{zoneID})
+	if err != nil {
+		return "", err
+	} else {
+		return zoneKey, nil
+	}
+}
+
+func getTariffKey(stub shim.ChaincodeStubInterface, version int) (string, error) {
+	tariffKey, err := stub.CreateCompositeKey("Tariff-", []string{fmt.Sprintf("%010d", version)})
+	if err != nil {
+		return "", err
+	} else {
+		return tariffKey, nil
+	}
+}
+
+func getCurrentTariffKey(stub shim.ChaincodeStubInterface) (string, error) {
+	tariffKey, err := stub.CreateCompositeKey("CurrentTariff-", []string{})
+	if err != nil {
+		return "", err
+	} else {
+		return tariffKey, nil
+	}
+}
+
+func getConfigKey(stub shim.ChaincodeStubInterface) (string, error) {
+	configKey, err := stub.CreateCompositeKey("Config-", []string{})
+	if err != nil {
+		return "", err
+	} else {
+		return configKey, nil
+	}
+}
+
+func getAccessControlListKey(stub shim.ChaincodeStubInterface) (string, error) {
+	aclKey, err := stub.CreateCompositeKey("ACL-", []string{})
+	if err != nil {
+		return "", err
+	} else {
+		return aclKey, nil
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Amounts are held in minor units (cents) to avoid floating point drift
+type Money struct {
+	Amount			int64		`json:"amount"`
+	Currency		string		`json:"currency"`
+}
+
+// Largest amount accepted from arguments, in major units
+const MAX_MONEY_DIGITS = 12
+
+var moneyPattern = regexp.MustCompile(fmt.Sprintf(`^([0-9]{1,%d})(\.([0-9]{1,2}))?( ([A-Z]{3}))?$`, MAX_MONEY_DIGITS))
+
+func newMoney(amount int64) Money {
+	return Money{amount, DEFAULT_CURRENCY}
+}
+
+// Parse a non-negative amount such as "12.50" or "12.50 USD".
+// Exponents, signs, whitespace and more than two decimal places are rejected.
+func parseMoney(value string) (Money, error) {
+	match := moneyPattern.FindStringSubmatch(value)
+	if match == nil {
+		return Money{}, errors.New(fmt.Sprintf("Malformed amount %q. Expecting up to %d digits with at most 2 decimal places and an optional currency code.", value, MAX_MONEY_DIGITS))
+	}
+
+	major, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return Money{}, err
+	}
+	minorString := match[3]
+	for len(minorString) < 2 {
+		minorString += "0"
+	}
+	minor, err := strconv.ParseInt(minorString, 10, 64)
+	if err != nil {
+		return Money{}, err
+	}
+
+	currency := match[5]
+	if currency == "" {
+		currency = DEFAULT_CURRENCY
+	}
+
+	return Money{major * 100 + minor, currency}, nil
+}
+
+// The ledger keeps every balance, fee and tariff in the default currency, so that the
+// amounts of different entities can always be added
+func checkLedgerCurrency(args *Args, name string, amount Money) error {
+	if amount.Currency != DEFAULT_CURRENCY {
+		return newError(ERR_CURRENCY_MISMATCH, fmt.Sprintf("Currency mismatch: %s and %s.", DEFAULT_CURRENCY, amount.Currency)).withArg(args.Index(name))
+	}
+	return nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount / 100, amount % 100, m.Currency)
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, newError(ERR_CURRENCY_MISMATCH, fmt.Sprintf("Currency mismatch: %s and %s.", m.Currency, other.Currency))
+	}
+	return Money{m.Amount + other.Amount, m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, newError(ERR_CURRENCY_MISMATCH, fmt.Sprintf("Currency mismatch: %s and %s.", m.Currency, other.Currency))
+	}
+	return Money{m.Amount - other.Amount, m.Currency}, nil
+}
+
+func (m Money) Neg() Money {
+	return Money{-m.Amount, m.Currency}
+}
+
+// Accept both the current {amount, currency} object and the legacy
+// float value in major units written by earlier chaincode versions
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "null" {
+		return nil
+	}
+
+	if !strings.HasPrefix(trimmed, "{") {
+		var legacy float64
+		err := json.Unmarshal(data, &legacy)
+		if err != nil {
+			return err
+		}
+		m.Amount = int64(math.Floor(legacy * 100 + 0.5))
+		m.Currency = DEFAULT_CURRENCY
+		return nil
+	}
+
+	type money Money
+	var value money
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	if value.Currency == "" {
+		value.Currency = DEFAULT_CURRENCY
+	}
+	*m = Money(value)
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope returned by paginated queries; an empty bookmark means there are no more records
+type QueryPage struct {
+	Records			interface{}	`json:"records"`
+	FetchedCount	int			`json:"fetchedCount"`
+	Bookmark		string		`json:"bookmark"`
+}
+
+// Ledger record returned by rich queries
+type QueryRecord struct {
+	Key				string			`json:"Key"`
+	Value			json.RawMessage	`json:"Value"`
+}
+
+// Bookmarks of rich queries wrap the last key returned, which may hold
+// the null characters separating composite key attributes
+func encodeBookmark(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+func decodeBookmark(bookmark string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(bookmark)
+	if err != nil {
+		return "", newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Malformed bookmark %s.", bookmark))
+	}
+	return string(key), nil
+}
+
+// Get the optional page size and bookmark arguments; omitted arguments select the defaults
+func parsePagination(args *Args) (int, string, error) {
+	pageSize := DEFAULT_PAGE_SIZE
+	if args.Has("PAGE_SIZE") {
+		size := args.Int("PAGE_SIZE")
+		if size <= 0 || size > MAX_PAGE_SIZE {
+			return 0, "", badArgument(args, "PAGE_SIZE", fmt.Sprintf("Page size must be between 1 and %d. Found %d.", MAX_PAGE_SIZE, size))
+		}
+		pageSize = size
+	}
+
+	return pageSize, args.String("BOOKMARK"), nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const MINUTES_PER_DAY = 24 * 60
+
+// Price breakdown of a ride under a given tariff
+type FareQuote struct {
+	TariffVersion	int			`json:"tariffVersion"`
+	Minutes			float64		`json:"minutes"`
+	BillableMinutes	float64		`json:"billableMinutes"`
+	UnlockFee		Money		`json:"unlockFee"`
+	TimeCharge		Money		`json:"timeCharge"`
+	CapApplied		bool		`json:"capApplied"`
+	DistanceMeters	int64		`json:"distanceMeters"`
+	DistanceCharge	Money		`json:"distanceCharge"`
+	Total			Money		`json:"total"`
+}
+
+// Tariff used before the provider has set one, matching the original 0.1-per-minute fare
+func getDefaultTariff() *Tariff {
+	return &Tariff{TARIFF, 0, newMoney(0), newMoney(10), 0, newMoney(0), ROUNDING_NONE, newMoney(0)}
+}
+
+var roundingRules = []string{ROUNDING_NONE, ROUNDING_UP, ROUNDING_DOWN, ROUNDING_NEAREST}
+
+// Get the tariff currently in force
+func getCurrentTariff(stub shim.ChaincodeStubInterface) (*Tariff, error) {
+	var tariff *Tariff
+
+	tariffKey, err := getCurrentTariffKey(stub)
+	if err != nil {
+		return nil, err
+	}
+	tariffBytes, err := stub.GetState(tariffKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(tariffBytes) == 0 {
+		return getDefaultTariff(), nil
+	}
+
+	err = json.Unmarshal(tariffBytes, &tariff)
+	if err != nil {
+		return nil, err
+	}
+
+	return tariff, nil
+}
+
+// Get the tariff with specified version; version 0 is the default tariff
+func getTariffByVersion(stub shim.ChaincodeStubInterface, version int) (*Tariff, error) {
+	var tariff *Tariff
+
+	if version == 0 {
+		return getDefaultTariff(), nil
+	}
+
+	tariffKey, err := getTariffKey(stub, version)
+	if err != nil {
+		return nil, err
+	}
+	tariffBytes, err := stub.GetState(tariffKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(tariffBytes) == 0 {
+		return nil, newError(ERR_NOT_FOUND, fmt.Sprintf("Tariff version %d not found.", version)).withEntity(TARIFF, strconv.Itoa(version))
+	}
+
+	err = json.Unmarshal(tariffBytes, &tariff)
+	if err != nil {
+		return nil, err
+	}
+
+	return tariff, nil
+}
+
+func roundMinutes(minutes float64, rounding string) float64 {
+	switch rounding {
+	case ROUNDING_UP:
+		return math.Ceil(minutes)
+	case ROUNDING_DOWN:
+		return math.Floor(minutes)
+	case ROUNDING_NEAREST:
+		return math.Floor(minutes + 0.5)
+	}
+	return minutes
+}
+
+// Round a fractional number of minor units half up to a whole one
+func roundMinorUnits(amount float64) int64 {
+	return int64(math.Floor(amount + 0.5))
+}
+
+// Compute the fare of a ride lasting the given number of minutes and covering the given distance.
+// Free minutes are deducted once, and the time charge of every 24-hour
+// period is limited to the daily cap when one is set. The distance charge is not capped.
+func computeFare(tariff *Tariff, minutes float64, meters int64) (*FareQuote, error) {
+	if minutes < 0 {
+		minutes = 0
+	}
+
+	billable := roundMinutes(minutes, tariff.Rounding) - float64(tariff.FreeMinutes)
+	if billable < 0 {
+		billable = 0
+	}
+
+	rate := float64(tariff.PerMinuteRate.Amount)
+	uncapped := roundMinorUnits(billable * rate)
+	timeCharge := uncapped
+	if tariff.DailyCap.Amount > 0 {
+		fullDays := math.Floor(billable / MINUTES_PER_DAY)
+		remainder := billable - fullDays * MINUTES_PER_DAY
+		dayCharge := roundMinorUnits(MINUTES_PER_DAY * rate)
+		if dayCharge > tariff.DailyCap.Amount {
+			dayCharge = tariff.DailyCap.Amount
+		}
+		remainderCharge := roundMinorUnits(remainder * rate)
+		if remainderCharge > tariff.DailyCap.Amount {
+			remainderCharge = tariff.DailyCap.Amount
+		}
+		timeCharge = int64(fullDays) * dayCharge + remainderCharge
+	}
+
+	quote := &FareQuote{
+		TariffVersion: tariff.Version,
+		Minutes: minutes,
+		BillableMinutes: billable,
+		UnlockFee: tariff.UnlockFee,
+		TimeCharge: Money{timeCharge, tariff.PerMinuteRate.Currency},
+		CapApplied: timeCharge < uncapped,
+		DistanceMeters: meters,
+		DistanceCharge: Money{roundMinorUnits(float64(meters) / 1000 * float64(tariff.PerKmRate.Amount)), tariff.PerMinuteRate.Currency},
+	}
+	total, err := quote.UnlockFee.Add(quote.TimeCharge)
+	if err != nil {
+		return nil, err
+	}
+	total, err = total.Add(quote.DistanceCharge)
+	if err != nil {
+		return nil, err
+	}
+	quote.Total = total
+
+	return quote, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var queryLogger = shim.NewLogger("bikeShareWorkflow.query")
+
+// Mango selector. Values are only ever set through the builder methods and
+// serialized with encoding/json, so arguments cannot alter the query structure.
+type Selector map[string]interface{}
+
+// Mango query sent to the state database
+type Query struct {
+	Selector		Selector			`json:"selector"`
+	Sort			[]map[string]string	`json:"sort,omitempty"`
+	Limit			int					`json:"limit,omitempty"`
+}
+
+// Selector matching all documents of an object type
+func newSelector(docType string) Selector {
+	return Selector{"docType": docType}
+}
+
+// Require a field to equal the given value
+func (s Selector) equals(field string, value string) Selector {
+	s[field] = value
+	return s
+}
+
+// Require a field to sort after the given value
+func (s Selector) after(field string, value string) Selector {
+	s[field] = map[string]string{"$gt": value}
+	return s
+}
+
+func (q *Query) String() (string, error) {
+	queryBytes, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	return string(queryBytes), nil
+}
+
+// Get the results of a query as a JSON array of {Key, Value} records
+func getQueryResponse(stub shim.ChaincodeStubInterface, selector Selector) ([]byte, error) {
+	records, _, err := getQueryPage(stub, selector, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(records)
+}
+
+// Get a page of the results of a query with the given selector. Results are
+// ordered by key, and the bookmark resumes the query after the last key returned.
+func getQueryPageResponse(stub shim.ChaincodeStubInterface, selector Selector, pageSize int, bookmark string) ([]byte, error) {
+	startAfter := ""
+	if bookmark != "" {
+		var err error
+		startAfter, err = decodeBookmark(bookmark)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	records, lastKey, err := getQueryPage(stub, selector, pageSize, startAfter)
+	if err != nil {
+		return nil, err
+	}
+	nextBookmark := ""
+	if lastKey != "" {
+		nextBookmark = encodeBookmark(lastKey)
+	}
+
+	return json.Marshal(&QueryPage{records, len(records), nextBookmark})
+}
+
+// Serve a query with a rich query when enabled, and through the key indexes otherwise.
+// Peers on LevelDB refuse rich queries, so networks running them disable RICH_QUERIES;
+// a failed rich query fails the query rather than guessing the cause from its message.
+func getQueryPage(stub shim.ChaincodeStubInterface, selector Selector, pageSize int, startAfter string) ([]QueryRecord, string, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if config.RichQueries {
+		return getRichQueryPage(stub, selector, pageSize, startAfter)
+	}
+
+	return getIndexQueryPage(stub, selector, pageSize, startAfter)
+}
+
+// Get a page of the results of a rich query, returning the last key if another page follows. A page size of 0 means no limit.
+func getRichQueryPage(stub shim.ChaincodeStubInterface, selector Selector, pageSize int, startAfter string) ([]QueryRecord, string, error) {
+	pageSelector := Selector{}
+	for field, value := range selector {
+		pageSelector[field] = value
+	}
+	if startAfter != "" {
+		pageSelector.after("_id", startAfter)
+	}
+
+	// Fetch one record more than the page size to learn whether another page follows
+	query := &Query{Selector: pageSelector}
+	if pageSize > 0 {
+		query.Sort = []map[string]string{{"_id": "asc"}}
+		query.Limit = pageSize + 1
+	}
+	queryString, err := query.String()
+	if err != nil {
+		return nil, "", err
+	}
+	queryLogger.Debugf("Query String: %s", queryString)
+
+	iterator, err := stub.GetQueryResult(queryString)
+	if err != nil {
+		return nil, "", err
+	}
+	defer iterator.Close()
+
+	records := []QueryRecord{}
+	for iterator.HasNext() {
+		queryResponse, err := iterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		if pageSize > 0 && len(records) == pageSize {
+			return records, records[len(records) - 1].Key, nil
+		}
+		records = append(records, QueryRecord{queryResponse.Key, json.RawMessage(queryResponse.Value)})
+	}
+
+	return records, "", nil
+}
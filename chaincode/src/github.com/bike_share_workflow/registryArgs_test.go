@@ -0,0 +1,172 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Argument type read by each Args accessor; empty for accessors reading any type
+var argAccessorTypes = map[string]string{
+	"String":	"",
+	"Has":		"",
+	"Index":	"",
+	"Int":		ARG_INT,
+	"Float":	ARG_FLOAT,
+	"Money":	ARG_MONEY,
+	"Time":		ARG_TIMESTAMP,
+}
+
+var argNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Argument read in the chaincode source, with the type its accessor expects
+type parsedArgRead struct {
+	Position	string
+	Name		string
+	Type		string
+}
+
+// Arguments a function reads through its args parameter, directly and through the
+// functions it passes args to
+type parsedArgUser struct {
+	Reads		[]parsedArgRead
+	Callees		[]string
+}
+
+func isArgsIdent(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "args"
+}
+
+// Name of a called function or method, qualified with the receiver type for methods
+func calleeName(call *ast.CallExpr) string {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		if ident, ok := fun.X.(*ast.Ident); ok && ident.Name == "t" {
+			return "(*BikeShareWorkflowChaincode)." + fun.Sel.Name
+		}
+	}
+	return ""
+}
+
+func funcDeclName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	if star, ok := decl.Recv.List[0].Type.(*ast.StarExpr); ok {
+		if ident, ok := star.X.(*ast.Ident); ok {
+			return "(*" + ident.Name + ")." + decl.Name.Name
+		}
+	}
+	return ""
+}
+
+// Collect the argument reads of every function with an args parameter. A string literal
+// naming an argument counts as read when it is passed to an Args accessor or, with args
+// itself, to another function such as badArgument or checkLedgerCurrency.
+func parseArgUsers(t *testing.T) map[string]*parsedArgUser {
+	fileSet, files := parseSourceFiles(t)
+
+	users := map[string]*parsedArgUser{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl.Body == nil || funcDeclName(funcDecl) == "" || strings.HasPrefix(funcDeclName(funcDecl), "(*Args).") {
+				continue
+			}
+			user := &parsedArgUser{}
+			ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+				call, ok := node.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+
+				argType, accessor := "", false
+				if selector, ok := call.Fun.(*ast.SelectorExpr); ok && isArgsIdent(selector.X) {
+					argType, accessor = argAccessorTypes[selector.Sel.Name]
+				}
+				passesArgs := false
+				for _, arg := range call.Args {
+					passesArgs = passesArgs || isArgsIdent(arg)
+				}
+				if !accessor && !passesArgs {
+					return true
+				}
+				if passesArgs && calleeName(call) != "" {
+					user.Callees = append(user.Callees, calleeName(call))
+				}
+
+				for _, arg := range call.Args {
+					literal, ok := arg.(*ast.BasicLit)
+					if !ok || literal.Kind != token.STRING {
+						continue
+					}
+					name, err := strconv.Unquote(literal.Value)
+					if err != nil || !argNamePattern.MatchString(name) {
+						continue
+					}
+					user.Reads = append(user.Reads, parsedArgRead{fileSet.Position(literal.Pos()).String(), name, argType})
+				}
+				return true
+			})
+			users[funcDeclName(funcDecl)] = user
+		}
+	}
+
+	return users
+}
+
+// Every argument read by reads of the function and of the functions it passes args to
+func collectArgReads(users map[string]*parsedArgUser, name string, visited map[string]bool) []parsedArgRead {
+	user, ok := users[name]
+	if !ok || visited[name] {
+		return nil
+	}
+	visited[name] = true
+
+	reads := append([]parsedArgRead{}, user.Reads...)
+	for _, callee := range user.Callees {
+		reads = append(reads, collectArgReads(users, callee, visited)...)
+	}
+	return reads
+}
+
+// Name of the method a registry handler refers to, such as "(*BikeShareWorkflowChaincode).registerUser"
+func handlerName(handler Handler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	return strings.TrimSuffix(name[strings.Index(name, "(*"):], "-fm")
+}
+
+// Handlers may only read the arguments their function declares, as the type declared,
+// since the Args accessors panic on anything else
+func TestHandlerArguments(t *testing.T) {
+	users := parseArgUsers(t)
+
+	for _, spec := range getFunctionRegistry() {
+		name := handlerName(spec.handler)
+		if _, ok := users[name]; !ok {
+			t.Errorf("Handler %s of %s not found in the source", name, spec.Name)
+			continue
+		}
+
+		declared := map[string]string{}
+		for _, arg := range spec.Args {
+			declared[arg.Name] = arg.Type
+		}
+		for _, read := range collectArgReads(users, name, map[string]bool{}) {
+			argType, ok := declared[read.Name]
+			if !ok {
+				t.Errorf("%s: %s reads undeclared argument %s", read.Position, spec.Name, read.Name)
+			} else if read.Type != "" && read.Type != argType {
+				t.Errorf("%s: %s reads argument %s of type %s as %s", read.Position, spec.Name, read.Name, argType, read.Type)
+			}
+		}
+	}
+}
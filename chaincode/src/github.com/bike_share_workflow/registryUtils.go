@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Argument types of the function registry
+const (
+	ARG_STRING		= "string"
+	ARG_INT			= "int"
+	ARG_FLOAT		= "float"
+	ARG_MONEY		= "money"
+	ARG_TIMESTAMP	= "timestamp"
+	ARG_JSON		= "json"
+)
+
+// Declared argument of a function. Optional arguments may be omitted at the end
+// of the list or left empty; an argument with values must take one of them, and
+// a float argument with a range {Min, Max} must lie within it.
+type ArgSpec struct {
+	Name			string		`json:"name"`
+	Type			string		`json:"type"`
+	Optional		bool		`json:"optional"`
+	Values			[]string	`json:"values,omitempty"`
+	Range			[]float64	`json:"range,omitempty"`
+}
+
+type Handler func(t *BikeShareWorkflowChaincode, stub shim.ChaincodeStubInterface, creatorOrg string, creatorCertIssuer string, args *Args) pb.Response
+
+// Registry entry of an invocable function. The roles make up its rule in the default ACL.
+type FunctionSpec struct {
+	Name			string		`json:"name"`
+	Description		string		`json:"description"`
+	Query			bool		`json:"query"`		// Reads the ledger without changing it
+	Roles			[]string	`json:"roles"`
+	Args			[]ArgSpec	`json:"args"`
+	handler			Handler
+}
+
+// Arguments of an invocation, parsed against the function's schema
+type Args struct {
+	specs			[]ArgSpec
+	raw				map[string]string
+	values			map[string]interface{}
+}
+
+func required(name string, argType string) ArgSpec {
+	return ArgSpec{Name: name, Type: argType}
+}
+
+func optional(name string, argType string) ArgSpec {
+	return ArgSpec{Name: name, Type: argType, Optional: true}
+}
+
+func oneOf(name string, values ...string) ArgSpec {
+	return ArgSpec{Name: name, Type: ARG_STRING, Values: values}
+}
+
+func optionalOneOf(name string, values ...string) ArgSpec {
+	return ArgSpec{Name: name, Type: ARG_STRING, Optional: true, Values: values}
+}
+
+func between(name string, min float64, max float64) ArgSpec {
+	return ArgSpec{Name: name, Type: ARG_FLOAT, Range: []float64{min, max}}
+}
+
+func argList(specs ...ArgSpec) []ArgSpec {
+	return specs
+}
+
+// Optional {Page Size, Bookmark} arguments of list queries
+func pageArgs(specs ...ArgSpec) []ArgSpec {
+	return append(specs, optional("PAGE_SIZE", ARG_INT), optional("BOOKMARK", ARG_STRING))
+}
+
+// Optional {Page Size, Bookmark, From Time, To Time} arguments of history queries
+func historyArgs(specs ...ArgSpec) []ArgSpec {
+	return append(pageArgs(specs...), optional("FROM_TIME", ARG_TIMESTAMP), optional("TO_TIME", ARG_TIMESTAMP))
+}
+
+func findFunction(name string) (*FunctionSpec, bool) {
+	for _, spec := range getFunctionRegistry() {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// Describe the expected arguments, such as "Expecting 1 to 3: {STATUS, [PAGE_SIZE], [BOOKMARK]}"
+func describeArgs(specs []ArgSpec) string {
+	min := 0
+	names := []string{}
+	for _, spec := range specs {
+		if spec.Optional {
+			names = append(names, "[" + spec.Name + "]")
+		} else {
+			min++
+			names = append(names, spec.Name)
+		}
+	}
+
+	max := len(specs)
+	if max == 0 {
+		return "Expecting 0"
+	}
+	count := strconv.Itoa(max)
+	if max == min + 1 {
+		count = fmt.Sprintf("%d or %d", min, max)
+	} else if max > min {
+		count = fmt.Sprintf("%d to %d", min, max)
+	}
+	return fmt.Sprintf("Expecting %s: {%s}", count, strings.Join(names, ", "))
+}
+
+// Check the argument count and parse every argument given according to its type
+func parseArgs(specs []ArgSpec, values []string) (*Args, error) {
+	min := 0
+	for _, spec := range specs {
+		if !spec.Optional {
+			min++
+		}
+	}
+	if len(values) < min || len(values) > len(specs) {
+		return nil, newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Incorrect number of arguments. %s. Found %d.", describeArgs(specs), len(values)))
+	}
+
+	parsed := &Args{specs, map[string]string{}, map[string]interface{}{}}
+	for i, value := range values {
+		spec := specs[i]
+		if value == "" {
+			if spec.Optional {
+				continue
+			}
+			return nil, newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Argument %s must not be empty.", spec.Name)).withArg(i)
+		}
+
+		parsedValue, err := parseArg(spec, value)
+		if err != nil {
+			return nil, newError(ERR_BAD_ARGUMENT, fmt.Sprintf("Argument %s: %s", spec.Name, err.Error())).withArg(i)
+		}
+		parsed.raw[spec.Name] = value
+		parsed.values[spec.Name] = parsedValue
+	}
+
+	return parsed, nil
+}
+
+func parseArg(spec ArgSpec, value string) (interface{}, error) {
+	if len(spec.Values) > 0 {
+		for _, allowed := range spec.Values {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return nil, errors.New(fmt.Sprintf("Unknown value %s. Expecting one of %s.", value, strings.Join(spec.Values, ", ")))
+	}
+
+	switch spec.Type {
+	case ARG_STRING:
+		return value, nil
+	case ARG_INT:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Malformed integer %s.", value))
+		}
+		return parsed, nil
+	case ARG_FLOAT:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Malformed number %s.", value))
+		}
+		if math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return nil, errors.New(fmt.Sprintf("Number %s is not finite.", value))
+		}
+		if len(spec.Range) == 2 && (parsed < spec.Range[0] || parsed > spec.Range[1]) {
+			return nil, errors.New(fmt.Sprintf("Number %s out of range. Expecting %g to %g.", value, spec.Range[0], spec.Range[1]))
+		}
+		return parsed, nil
+	case ARG_MONEY:
+		return parseMoney(value)
+	case ARG_TIMESTAMP:
+		return parseTimestamp(value)
+	case ARG_JSON:
+		if !json.Valid([]byte(value)) {
+			return nil, errors.New("Malformed JSON.")
+		}
+		return value, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown argument type %s.", spec.Type))
+}
+
+// Reading an argument the function does not declare is a programming error, which
+// TestHandlerArguments finds in the source before it can reach a peer
+func (a *Args) value(name string, argType string) interface{} {
+	for _, spec := range a.specs {
+		if spec.Name == name {
+			if argType != "" && spec.Type != argType {
+				panic(fmt.Sprintf("Argument %s is of type %s, not %s.", name, spec.Type, argType))
+			}
+			return a.values[name]
+		}
+	}
+	panic(fmt.Sprintf("Undeclared argument %s.", name))
+}
+
+// Position of a declared argument in the invocation
+func (a *Args) Index(name string) int {
+	for i, spec := range a.specs {
+		if spec.Name == name {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("Undeclared argument %s.", name))
+}
+
+// Whether an optional argument was given
+func (a *Args) Has(name string) bool {
+	return a.value(name, "") != nil
+}
+
+// The argument as given; empty when an optional argument is omitted
+func (a *Args) String(name string) string {
+	a.value(name, "")
+	return a.raw[name]
+}
+
+func (a *Args) Int(name string) int {
+	value, _ := a.value(name, ARG_INT).(int)
+	return value
+}
+
+func (a *Args) Float(name string) float64 {
+	value, _ := a.value(name, ARG_FLOAT).(float64)
+	return value
+}
+
+func (a *Args) Money(name string) Money {
+	value, _ := a.value(name, ARG_MONEY).(Money)
+	return value
+}
+
+func (a *Args) Time(name string) time.Time {
+	value, _ := a.value(name, ARG_TIMESTAMP).(time.Time)
+	return value
+}
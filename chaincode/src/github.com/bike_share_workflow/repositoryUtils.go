@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Entity stored through a repository, which keeps its audit fields
+type Entity interface {
+	audit() *Audit
+}
+
+func (a *Audit) audit() *Audit {
+	return a
+}
+
+// Loads and saves the entities of one object type under their primary keys. Writes go
+// through putState, so the secondary indexes follow every change.
+type Repository struct {
+	stub			shim.ChaincodeStubInterface
+	name			string		// Entity name used in messages
+	objectType		string
+	getKey			func(shim.ChaincodeStubInterface, string) (string, error)
+}
+
+func (r *Repository) notFoundError(id string) error {
+	return newError(ERR_NOT_FOUND, fmt.Sprintf("%s %s not found.", r.name, id)).withEntity(r.objectType, id)
+}
+
+func (r *Repository) alreadyExistsError(id string) error {
+	return newError(ERR_ALREADY_EXISTS, fmt.Sprintf("%s %s already exists.", r.name, id)).withEntity(r.objectType, id)
+}
+
+// Unmarshal the entity with specified ID into value; reports whether it exists
+func (r *Repository) load(id string, value interface{}) (bool, error) {
+	key, err := r.getKey(r.stub, id)
+	if err != nil {
+		return false, err
+	}
+	entityBytes, err := r.stub.GetState(key)
+	if err != nil {
+		return false, err
+	}
+	if len(entityBytes) == 0 {
+		return false, nil
+	}
+
+	err = json.Unmarshal(entityBytes, value)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Repository) mustLoad(id string, value interface{}) error {
+	found, err := r.load(id, value)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return r.notFoundError(id)
+	}
+	return nil
+}
+
+// Fail if an entity with specified ID exists, before other checks depend on it
+func (r *Repository) MustNotExist(id string) error {
+	key, err := r.getKey(r.stub, id)
+	if err != nil {
+		return err
+	}
+	entityBytes, err := r.stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if len(entityBytes) != 0 {
+		return r.alreadyExistsError(id)
+	}
+	return nil
+}
+
+func (r *Repository) create(id string, entity Entity) error {
+	err := r.MustNotExist(id)
+	if err != nil {
+		return err
+	}
+
+	key, err := r.getKey(r.stub, id)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := getTxTime(r.stub)
+	if err != nil {
+		return err
+	}
+	entity.audit().CreatedAt = formatTimestamp(txTime)
+	entity.audit().CreatedTxId = r.stub.GetTxID()
+
+	return r.write(key, entity)
+}
+
+func (r *Repository) update(id string, entity Entity) error {
+	key, err := r.getKey(r.stub, id)
+	if err != nil {
+		return err
+	}
+	entityBytes, err := r.stub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if len(entityBytes) == 0 {
+		return r.notFoundError(id)
+	}
+
+	return r.write(key, entity)
+}
+
+func (r *Repository) write(key string, entity Entity) error {
+	txTime, err := getTxTime(r.stub)
+	if err != nil {
+		return err
+	}
+	entity.audit().UpdatedAt = formatTimestamp(txTime)
+	entity.audit().UpdatedTxId = r.stub.GetTxID()
+
+	entityBytes, err := json.Marshal(entity)
+	if err != nil {
+		return newError(ERR_INTERNAL, fmt.Sprintf("Error marshaling %s structure.", strings.ToLower(r.name)))
+	}
+	return putState(r.stub, key, entityBytes)
+}
+
+type UserRepository struct {
+	*Repository
+}
+
+func users(stub shim.ChaincodeStubInterface) UserRepository {
+	return UserRepository{&Repository{stub, "User", USER, getUserKey}}
+}
+
+// Get the user with specified ID, or nil if there is none
+func (r UserRepository) Get(id string) (*User, error) {
+	var user *User
+	_, err := r.load(id, &user)
+	return user, err
+}
+
+// Get the user with specified ID, failing if there is none
+func (r UserRepository) MustGet(id string) (*User, error) {
+	var user *User
+	err := r.mustLoad(id, &user)
+	return user, err
+}
+
+func (r UserRepository) Create(user *User) error {
+	return r.create(user.Id, user)
+}
+
+func (r UserRepository) Update(user *User) error {
+	return r.update(user.Id, user)
+}
+
+type RepairerRepository struct {
+	*Repository
+}
+
+func repairers(stub shim.ChaincodeStubInterface) RepairerRepository {
+	return RepairerRepository{&Repository{stub, "Repairer", REPAIRER, getRepairerKey}}
+}
+
+func (r RepairerRepository) Get(id string) (*Repairer, error) {
+	var repairer *Repairer
+	_, err := r.load(id, &repairer)
+	return repairer, err
+}
+
+func (r RepairerRepository) MustGet(id string) (*Repairer, error) {
+	var repairer *Repairer
+	err := r.mustLoad(id, &repairer)
+	return repairer, err
+}
+
+func (r RepairerRepository) Create(repairer *Repairer) error {
+	return r.create(repairer.Id, repairer)
+}
+
+func (r RepairerRepository) Update(repairer *Repairer) error {
+	return r.update(repairer.Id, repairer)
+}
+
+type BikeRepository struct {
+	*Repository
+}
+
+func bikes(stub shim.ChaincodeStubInterface) BikeRepository {
+	return BikeRepository{&Repository{stub, "Bike", BIKE, getBikeKey}}
+}
+
+func (r BikeRepository) Get(id string) (*Bike, error) {
+	var bike *Bike
+	_, err := r.load(id, &bike)
+	return bike, err
+}
+
+func (r BikeRepository) MustGet(id string) (*Bike, error) {
+	var bike *Bike
+	err := r.mustLoad(id, &bike)
+	return bike, err
+}
+
+func (r BikeRepository) Create(bike *Bike) error {
+	return r.create(bike.Id, bike)
+}
+
+func (r BikeRepository) Update(bike *Bike) error {
+	return r.update(bike.Id, bike)
+}
+
+type RideRepository struct {
+	*Repository
+}
+
+func rides(stub shim.ChaincodeStubInterface) RideRepository {
+	return RideRepository{&Repository{stub, "Ride", RIDE, getRideKey}}
+}
+
+func (r RideRepository) Get(id string) (*Ride, error) {
+	var ride *Ride
+	_, err := r.load(id, &ride)
+	return ride, err
+}
+
+func (r RideRepository) MustGet(id string) (*Ride, error) {
+	var ride *Ride
+	err := r.mustLoad(id, &ride)
+	return ride, err
+}
+
+func (r RideRepository) Create(ride *Ride) error {
+	return r.create(ride.Id, ride)
+}
+
+func (r RideRepository) Update(ride *Ride) error {
+	return r.update(ride.Id, ride)
+}
+
+type IssueRepository struct {
+	*Repository
+}
+
+func issues(stub shim.ChaincodeStubInterface) IssueRepository {
+	return IssueRepository{&Repository{stub, "Issue", ISSUE, getIssueKey}}
+}
+
+func (r IssueRepository) Get(id string) (*Issue, error) {
+	var issue *Issue
+	_, err := r.load(id, &issue)
+	return issue, err
+}
+
+func (r IssueRepository) MustGet(id string) (*Issue, error) {
+	var issue *Issue
+	err := r.mustLoad(id, &issue)
+	return issue, err
+}
+
+func (r IssueRepository) Create(issue *Issue) error {
+	return r.create(issue.Id, issue)
+}
+
+func (r IssueRepository) Update(issue *Issue) error {
+	return r.update(issue.Id, issue)
+}
+
+type RepairRepository struct {
+	*Repository
+}
+
+func repairs(stub shim.ChaincodeStubInterface) RepairRepository {
+	return RepairRepository{&Repository{stub, "Repair", REPAIR, getRepairKey}}
+}
+
+func (r RepairRepository) Get(id string) (*Repair, error) {
+	var repair *Repair
+	_, err := r.load(id, &repair)
+	return repair, err
+}
+
+func (r RepairRepository) MustGet(id string) (*Repair, error) {
+	var repair *Repair
+	err := r.mustLoad(id, &repair)
+	return repair, err
+}
+
+func (r RepairRepository) Create(repair *Repair) error {
+	return r.create(repair.Id, repair)
+}
+
+func (r RepairRepository) Update(repair *Repair) error {
+	return r.update(repair.Id, repair)
+}
+
+type StationRepository struct {
+	*Repository
+}
+
+func stations(stub shim.ChaincodeStubInterface) StationRepository {
+	return StationRepository{&Repository{stub, "Station", STATION, getStationKey}}
+}
+
+func (r StationRepository) Get(id string) (*Station, error) {
+	var station *Station
+	_, err := r.load(id, &station)
+	return station, err
+}
+
+func (r StationRepository) MustGet(id string) (*Station, error) {
+	var station *Station
+	err := r.mustLoad(id, &station)
+	return station, err
+}
+
+func (r StationRepository) Create(station *Station) error {
+	return r.create(station.Id, station)
+}
+
+func (r StationRepository) Update(station *Station) error {
+	return r.update(station.Id, station)
+}
+
+type ZoneRepository struct {
+	*Repository
+}
+
+func zones(stub shim.ChaincodeStubInterface) ZoneRepository {
+	return ZoneRepository{&Repository{stub, "Zone", ZONE, getZoneKey}}
+}
+
+func (r ZoneRepository) Get(id string) (*Zone, error) {
+	var zone *Zone
+	_, err := r.load(id, &zone)
+	return zone, err
+}
+
+func (r ZoneRepository) MustGet(id string) (*Zone, error) {
+	var zone *Zone
+	err := r.mustLoad(id, &zone)
+	return zone, err
+}
+
+func (r ZoneRepository) Create(zone *Zone) error {
+	return r.create(zone.Id, zone)
+}
+
+func (r ZoneRepository) Update(zone *Zone) error {
+	return r.update(zone.Id, zone)
+}
+
+// Balance entries are immutable, so their repository has no Update
+type BalanceEntryRepository struct {
+	*Repository
+}
+
+func balanceEntries(stub shim.ChaincodeStubInterface) BalanceEntryRepository {
+	return BalanceEntryRepository{&Repository{stub, "Balance entry", BALANCE_ENTRY, getBalanceEntryKey}}
+}
+
+func (r BalanceEntryRepository) Get(id string) (*BalanceEntry, error) {
+	var entry *BalanceEntry
+	_, err := r.load(id, &entry)
+	return entry, err
+}
+
+func (r BalanceEntryRepository) MustGet(id string) (*BalanceEntry, error) {
+	var entry *BalanceEntry
+	err := r.mustLoad(id, &entry)
+	return entry, err
+}
+
+func (r BalanceEntryRepository) Create(entry *BalanceEntry) error {
+	return r.create(entry.Id, entry)
+}
+
+// Track segments are immutable, so their repository has no Update
+type TrackSegmentRepository struct {
+	*Repository
+}
+
+func trackSegments(stub shim.ChaincodeStubInterface) TrackSegmentRepository {
+	return TrackSegmentRepository{&Repository{stub, "Track segment", TRACK_SEGMENT, getTrackSegmentKey}}
+}
+
+func (r TrackSegmentRepository) Get(id string) (*TrackSegment, error) {
+	var segment *TrackSegment
+	_, err := r.load(id, &segment)
+	return segment, err
+}
+
+func (r TrackSegmentRepository) MustGet(id string) (*TrackSegment, error) {
+	var segment *TrackSegment
+	err := r.mustLoad(id, &segment)
+	return segment, err
+}
+
+func (r TrackSegmentRepository) Create(segment *TrackSegment) error {
+	return r.create(segment.Id, segment)
+}
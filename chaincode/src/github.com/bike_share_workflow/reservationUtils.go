@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Verify if the reservation of a bike has run out at the given transaction time
+func reservationExpired(bike *Bike, now time.Time) (bool, error) {
+	if bike.Status != BIKE_RESERVED {
+		return false, nil
+	}
+	reservedUntil, err := parseTimestamp(bike.ReservedUntil)
+	if err != nil {
+		return false, err
+	}
+	return !now.Before(reservedUntil), nil
+}
+
+// Reserve a bike for a user until the end of the configured window. The caller writes both.
+func reserve(stub shim.ChaincodeStubInterface, bike *Bike, user *User, now time.Time, event *Event) error {
+	config, err := getConfig(stub)
+	if err != nil {
+		return err
+	}
+	err = fire(stub, bike, "reserveBike", event)
+	if err != nil {
+		return err
+	}
+
+	bike.ReservedBy = user.Id
+	bike.ReservedUntil = formatTimestamp(now.Add(time.Duration(config.ReservationMinutes) * time.Minute))
+	user.ReservedBikeId = bike.Id
+	return nil
+}
+
+// End the reservation of a bike, whether used, cancelled or expired. The caller writes both.
+func clearReservation(bike *Bike, user *User) {
+	bike.ReservedBy = ""
+	bike.ReservedUntil = ""
+	user.ReservedBikeId = ""
+}
+
+// Reservations are not expired by a timer; the first transaction touching the bike after
+// its reservation ran out releases it and counts a no-show against the holder, who pays the
+// no-show fee once the no-shows in a row exceed the allowance. The holder is the given user
+// if it holds the reservation, which the caller writes, and is written here otherwise. The
+// caller writes the bike. Returns whether the reservation expired.
+func expireReservation(stub shim.ChaincodeStubInterface, bike *Bike, user *User, now time.Time, event *Event) (bool, error) {
+	expired, err := reservationExpired(bike, now)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	holder := user
+	if holder == nil || holder.Id != bike.ReservedBy {
+		holder, err = users(stub).MustGet(bike.ReservedBy)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = fire(stub, bike, "cancelReservation", event)
+	if err != nil {
+		return false, err
+	}
+	clearReservation(bike, holder)
+	holder.NoShowCount++
+
+	config, err := getConfig(stub)
+	if err != nil {
+		return false, err
+	}
+	// A fee the balance cannot take, such as one set in another currency by an earlier
+	// version, is skipped so that it never keeps the bike reserved
+	if config.NoShowFee.Amount > 0 && config.NoShowFee.Currency == holder.Balance.Currency && holder.NoShowCount > config.NoShowAllowance {
+		err = postBalanceEntry(stub, holder, &BalanceEntry{Amount: config.NoShowFee.Neg(), Reason: REASON_NO_SHOW_FEE, BikeId: bike.Id}, event)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if holder != user {
+		err = users(stub).Update(holder)
+		if err != nil {
+			return false, err
+		}
+		event.addChange(USER, holder.Id, holder.Status, holder.Status)
+	}
+	return true, nil
+}
+
+// Bike a user still holds a reservation of, after expiring it if it ran out. A user may
+// hold one reservation. Since a transaction does not read its own writes, the given bike
+// is used if it is the reserved one, which the caller writes; another reserved bike is
+// read, and written here if its reservation expired.
+func getUserReservation(stub shim.ChaincodeStubInterface, user *User, bike *Bike, now time.Time, event *Event) (*Bike, error) {
+	var err error
+
+	if user.ReservedBikeId == "" {
+		return nil, nil
+	}
+
+	reserved := bike
+	if reserved == nil || reserved.Id != user.ReservedBikeId {
+		reserved, err = bikes(stub).MustGet(user.ReservedBikeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	expired, err := expireReservation(stub, reserved, user, now, event)
+	if err != nil {
+		return nil, err
+	}
+	if expired && reserved != bike {
+		err = bikes(stub).Update(reserved)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if expired {
+		return nil, nil
+	}
+	return reserved, nil
+}
+
+// Verify if a bike is not reserved for another user than the given one
+func checkReservedFor(bike *Bike, user *User) error {
+	if bike.Status == BIKE_RESERVED && bike.ReservedBy != user.Id {
+		return newError(ERR_BIKE_RESERVED, fmt.Sprintf("Bike %s reserved by another user.", bike.Id)).withEntity(BIKE, bike.Id)
+	}
+	return nil
+}
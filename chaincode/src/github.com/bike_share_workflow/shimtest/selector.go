@@ -0,0 +1,409 @@
+package shimtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Ledger document seen by a query; the key is the CouchDB _id
+type Document struct {
+	Key			string
+	Fields		map[string]interface{}
+}
+
+// Sort field of a query, ascending unless Descending is set
+type SortField struct {
+	Field		string
+	Descending	bool
+}
+
+// Mango query supported by the evaluator: selector, sort, skip and limit
+type Query struct {
+	Selector	map[string]interface{}
+	Sort		[]SortField
+	Skip		int
+	Limit		int
+}
+
+// Parse a CouchDB query string, refusing parameters the evaluator does not support
+func ParseQuery(query string) (*Query, error) {
+	var raw map[string]json.RawMessage
+
+	decoder := json.NewDecoder(strings.NewReader(query))
+	decoder.UseNumber()
+	err := decoder.Decode(&raw)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed query %s: %s", query, err.Error()))
+	}
+
+	parsed := &Query{}
+	for name, value := range raw {
+		switch name {
+		case "selector":
+			err = decodeNumbers(value, &parsed.Selector)
+			if err == nil && parsed.Selector == nil {
+				err = errors.New("Selector must be an object.")
+			}
+		case "sort":
+			parsed.Sort, err = parseSort(value)
+		case "skip":
+			err = json.Unmarshal(value, &parsed.Skip)
+		case "limit":
+			err = json.Unmarshal(value, &parsed.Limit)
+		case "use_index":
+			// Indexes change performance, not results
+		default:
+			err = errors.New(fmt.Sprintf("Unsupported query parameter %s.", name))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parsed.Selector == nil {
+		return nil, errors.New("Query has no selector.")
+	}
+	if parsed.Skip < 0 || parsed.Limit < 0 {
+		return nil, errors.New("Skip and limit must not be negative.")
+	}
+
+	return parsed, nil
+}
+
+func decodeNumbers(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// Parse a sort given as ["field", {"field": "asc"}, {"field": "desc"}, ...]
+func parseSort(data []byte) ([]SortField, error) {
+	var raw []interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.New("Sort must be an array.")
+	}
+
+	fields := []SortField{}
+	for _, entry := range raw {
+		switch value := entry.(type) {
+		case string:
+			fields = append(fields, SortField{value, false})
+		case map[string]interface{}:
+			if len(value) != 1 {
+				return nil, errors.New(fmt.Sprintf("Sort entry %v must name one field.", value))
+			}
+			for field, direction := range value {
+				if direction != "asc" && direction != "desc" {
+					return nil, errors.New(fmt.Sprintf("Sort direction of %s must be asc or desc.", field))
+				}
+				fields = append(fields, SortField{field, direction == "desc"})
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("Malformed sort entry %v.", entry))
+		}
+	}
+	// CouchDB sorts in one direction only
+	for _, field := range fields {
+		if field.Descending != fields[0].Descending {
+			return nil, errors.New("Sort fields must share one direction.")
+		}
+	}
+
+	return fields, nil
+}
+
+// Select, sort and page the documents, which are given in _id order
+func (q *Query) Execute(documents []Document) ([]Document, error) {
+	matches := []Document{}
+	for _, document := range documents {
+		matched, err := Matches(q.Selector, document)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matches = append(matches, document)
+		}
+	}
+
+	if len(q.Sort) > 0 {
+		// A document lacking a sort field is left out, as CouchDB does with the index it sorts on
+		sortable := []Document{}
+		for _, document := range matches {
+			complete := true
+			for _, field := range q.Sort {
+				if _, ok := fieldValue(document, field.Field); !ok {
+					complete = false
+				}
+			}
+			if complete {
+				sortable = append(sortable, document)
+			}
+		}
+		matches = sortable
+
+		sort.SliceStable(matches, func(i, j int) bool {
+			for _, field := range q.Sort {
+				a, _ := fieldValue(matches[i], field.Field)
+				b, _ := fieldValue(matches[j], field.Field)
+				order := collate(a, b)
+				if field.Descending {
+					order = -order
+				}
+				if order != 0 {
+					return order < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if q.Skip >= len(matches) {
+		return []Document{}, nil
+	}
+	matches = matches[q.Skip:]
+	if q.Limit > 0 && q.Limit < len(matches) {
+		matches = matches[:q.Limit]
+	}
+
+	return matches, nil
+}
+
+// Evaluate a Mango selector against a document. Supported: implicit and $eq
+// equality, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $and, $or, $nor,
+// $not and dotted field paths; any other operator is an error.
+func Matches(selector map[string]interface{}, document Document) (bool, error) {
+	for field, condition := range selector {
+		var matched bool
+		var err error
+
+		switch field {
+		case "$and", "$or", "$nor":
+			matched, err = matchCombination(field, condition, document)
+		case "$not":
+			sub, ok := condition.(map[string]interface{})
+			if !ok {
+				return false, errors.New("$not takes a selector.")
+			}
+			matched, err = Matches(sub, document)
+			matched = !matched
+		default:
+			if strings.HasPrefix(field, "$") {
+				return false, errors.New(fmt.Sprintf("Unsupported operator %s.", field))
+			}
+			value, exists := fieldValue(document, field)
+			matched, err = matchCondition(value, exists, condition)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchCombination(operator string, condition interface{}, document Document) (bool, error) {
+	selectors, ok := condition.([]interface{})
+	if !ok || len(selectors) == 0 {
+		return false, errors.New(fmt.Sprintf("%s takes a non-empty array of selectors.", operator))
+	}
+
+	matchedCount := 0
+	for _, entry := range selectors {
+		sub, ok := entry.(map[string]interface{})
+		if !ok {
+			return false, errors.New(fmt.Sprintf("%s takes a non-empty array of selectors.", operator))
+		}
+		matched, err := Matches(sub, document)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			matchedCount++
+		}
+	}
+
+	switch operator {
+	case "$and":
+		return matchedCount == len(selectors), nil
+	case "$or":
+		return matchedCount > 0, nil
+	}
+	return matchedCount == 0, nil
+}
+
+// Match a field value against a literal, or against an object of operators
+func matchCondition(value interface{}, exists bool, condition interface{}) (bool, error) {
+	operators, ok := condition.(map[string]interface{})
+	if !ok || !hasOperators(operators) {
+		return exists && collate(value, condition) == 0, nil
+	}
+
+	for operator, argument := range operators {
+		var matched bool
+		switch operator {
+		case "$eq":
+			matched = exists && collate(value, argument) == 0
+		case "$ne":
+			matched = exists && collate(value, argument) != 0
+		case "$gt":
+			matched = exists && collate(value, argument) > 0
+		case "$gte":
+			matched = exists && collate(value, argument) >= 0
+		case "$lt":
+			matched = exists && collate(value, argument) < 0
+		case "$lte":
+			matched = exists && collate(value, argument) <= 0
+		case "$in", "$nin":
+			candidates, ok := argument.([]interface{})
+			if !ok {
+				return false, errors.New(fmt.Sprintf("%s takes an array.", operator))
+			}
+			found := false
+			for _, candidate := range candidates {
+				if exists && collate(value, candidate) == 0 {
+					found = true
+				}
+			}
+			matched = exists && found == (operator == "$in")
+		case "$exists":
+			wanted, ok := argument.(bool)
+			if !ok {
+				return false, errors.New("$exists takes a boolean.")
+			}
+			matched = exists == wanted
+		case "$not":
+			sub, err := matchCondition(value, exists, argument)
+			if err != nil {
+				return false, err
+			}
+			matched = !sub
+		default:
+			return false, errors.New(fmt.Sprintf("Unsupported operator %s.", operator))
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func hasOperators(object map[string]interface{}) bool {
+	for name := range object {
+		if strings.HasPrefix(name, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// Look up a dotted field path; _id is the ledger key
+func fieldValue(document Document, path string) (interface{}, bool) {
+	if path == "_id" {
+		return document.Key, true
+	}
+
+	var value interface{} = document.Fields
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Rank of each JSON type in the CouchDB collation order
+func collationRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case json.Number, float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	}
+	return 5
+}
+
+// Compare two JSON values in CouchDB collation order: null, false, true, numbers,
+// strings, arrays, objects. Strings compare by code point rather than with the
+// ICU collation of CouchDB, which is how Fabric keys are ordered.
+func collate(a interface{}, b interface{}) int {
+	rankA, rankB := collationRank(a), collationRank(b)
+	if rankA != rankB {
+		if rankA < rankB {
+			return -1
+		}
+		return 1
+	}
+
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		} else if !x {
+			return -1
+		}
+		return 1
+	case json.Number, float64:
+		fa, fb := toFloat(a), toFloat(b)
+		if fa < fb {
+			return -1
+		} else if fa > fb {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	case []interface{}:
+		y := b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			order := collate(x[i], y[i])
+			if order != 0 {
+				return order
+			}
+		}
+		return compareInts(len(x), len(y))
+	case map[string]interface{}:
+		y := b.(map[string]interface{})
+		xBytes, _ := json.Marshal(x)
+		yBytes, _ := json.Marshal(y)
+		if len(x) != len(y) {
+			return compareInts(len(x), len(y))
+		}
+		return bytes.Compare(xBytes, yBytes)
+	}
+	return 0
+}
+
+func toFloat(value interface{}) float64 {
+	switch number := value.(type) {
+	case json.Number:
+		f, _ := number.Float64()
+		return f
+	case float64:
+		return number
+	}
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
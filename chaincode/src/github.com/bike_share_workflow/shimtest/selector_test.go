@@ -0,0 +1,99 @@
+package shimtest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var testDocuments = []string{
+	`{"docType": "BIKE", "id": "b1", "status": "BIKE_AVAILABLE", "location": [8.54, 47.37], "battery": 80}`,
+	`{"docType": "BIKE", "id": "b2", "status": "BIKE_IN_USE", "location": [8.55, 47.38], "battery": 35}`,
+	`{"docType": "BIKE", "id": "b3", "status": "BIKE_TO_REPAIR", "battery": 5, "dock": {"station": "s1"}}`,
+	`{"docType": "RIDE", "id": "ride1", "userId": "u1", "bikeId": "b1", "cost": {"amount": 120, "currency": "USD"}}`,
+	`{"docType": "RIDE", "id": "ride2", "userId": "u2", "bikeId": "b2", "cost": {"amount": 80, "currency": "USD"}}`,
+}
+
+type selectorTest struct {
+	query		string
+	keys		[]string	// Expected keys in order
+	err			string		// Expected error substring
+}
+
+var selectorTests = []selectorTest{
+	{`{"selector": {"docType": "BIKE"}}`, []string{"b1", "b2", "b3"}, ""},
+	{`{"selector": {"docType": "BIKE", "status": "BIKE_IN_USE"}}`, []string{"b2"}, ""},
+	{`{"selector": {"status": {"$eq": "BIKE_IN_USE"}}}`, []string{"b2"}, ""},
+	{`{"selector": {"docType": "BIKE", "status": {"$ne": "BIKE_IN_USE"}}}`, []string{"b1", "b3"}, ""},
+	{`{"selector": {"battery": {"$gt": 35}}}`, []string{"b1"}, ""},
+	{`{"selector": {"battery": {"$gte": 35}}}`, []string{"b1", "b2"}, ""},
+	{`{"selector": {"battery": {"$lt": 35}}}`, []string{"b3"}, ""},
+	{`{"selector": {"battery": {"$gt": 4, "$lte": 35}}}`, []string{"b2", "b3"}, ""},
+	{`{"selector": {"cost.amount": {"$lt": 100}}}`, []string{"ride2"}, ""},
+	{`{"selector": {"dock": {"station": "s1"}}}`, []string{"b3"}, ""},
+	{`{"selector": {"status": {"$in": ["BIKE_AVAILABLE", "BIKE_TO_REPAIR"]}}}`, []string{"b1", "b3"}, ""},
+	{`{"selector": {"docType": "BIKE", "status": {"$nin": ["BIKE_AVAILABLE", "BIKE_TO_REPAIR"]}}}`, []string{"b2"}, ""},
+	{`{"selector": {"docType": "BIKE", "location": {"$exists": false}}}`, []string{"b3"}, ""},
+	{`{"selector": {"$and": [{"docType": "RIDE"}, {"userId": "u2"}]}}`, []string{"ride2"}, ""},
+	{`{"selector": {"$or": [{"userId": "u1"}, {"status": "BIKE_TO_REPAIR"}]}}`, []string{"b3", "ride1"}, ""},
+	{`{"selector": {"docType": "BIKE", "$nor": [{"id": "b1"}, {"id": "b2"}]}}`, []string{"b3"}, ""},
+	{`{"selector": {"docType": "RIDE", "userId": {"$not": {"$eq": "u1"}}}}`, []string{"ride2"}, ""},
+	{`{"selector": {"_id": {"$gt": "b2"}}}`, []string{"b3", "ride1", "ride2"}, ""},
+	{`{"selector": {"docType": "BIKE"}, "sort": [{"battery": "asc"}]}`, []string{"b3", "b2", "b1"}, ""},
+	{`{"selector": {"docType": "BIKE"}, "sort": [{"battery": "desc"}], "limit": 2}`, []string{"b1", "b2"}, ""},
+	{`{"selector": {"docType": "BIKE"}, "sort": ["_id"], "skip": 1, "limit": 1}`, []string{"b2"}, ""},
+	{`{"selector": {"docType": "BIKE"}, "sort": [{"location": "asc"}]}`, []string{"b1", "b2"}, ""},
+	{`{"selector": {"docType": "BIKE"}, "sort": [{"battery": "asc"}, {"id": "desc"}]}`, nil, "one direction"},
+	{`{"selector": {"battery": {"$regex": "8"}}}`, nil, "Unsupported operator $regex."},
+	{`{"selector": {"$or": {"userId": "u1"}}}`, nil, "$or takes a non-empty array"},
+	{`{"selector": {"status": {"$in": "BIKE_AVAILABLE"}}}`, nil, "$in takes an array."},
+	{`{"selector": {"docType": "BIKE"}, "fields": ["id"]}`, nil, "Unsupported query parameter fields."},
+	{`{"sort": ["_id"]}`, nil, "Query has no selector."},
+	{`{"selector": `, nil, "Malformed query"},
+}
+
+func TestSelectors(t *testing.T) {
+	stub := NewStub("shimtest", nil)
+	stub.MockTransactionStart("setup")
+	for _, document := range testDocuments {
+		var fields map[string]interface{}
+		err := json.Unmarshal([]byte(document), &fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stub.PutState(fields["id"].(string), []byte(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Values that are not JSON objects never match
+	stub.PutState("b0", []byte{0x00})
+	stub.MockTransactionEnd("setup")
+
+	for _, test := range selectorTests {
+		iterator, err := stub.GetQueryResult(test.query)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %v; expected %q", test.query, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+
+		keys := []string{}
+		for iterator.HasNext() {
+			kv, err := iterator.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, kv.Key)
+		}
+		iterator.Close()
+		if strings.Join(keys, ",") != strings.Join(test.keys, ",") {
+			t.Errorf("%s: returned %v; expected %v", test.query, keys, test.keys)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Package shimtest provides a ChaincodeStubInterface for offline chaincode tests.
+// It wraps shim.MockStub with what the mock lacks: rich queries evaluated against
+// the mock state, key history, captured events, chosen transaction times, reads of
+// the committed state and the rollback of failed transactions.
+package shimtest
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+type Stub struct {
+	*shim.MockStub
+	cc			shim.Chaincode
+	args		[][]byte
+	history		map[string][]*queryresult.KeyModification
+
+	// Time of the next transaction; the current time when zero
+	TxTime		time.Time
+
+	// Serialized identity of the transaction creator; none when nil
+	Creator		[]byte
+
+	// Error returned by GetQueryResult instead of evaluating the query, such as
+	// the refusal of a peer on LevelDB; queries are evaluated when nil
+	QueryError	error
+
+	// Events of the committed transactions, in order
+	Events		[]*pb.ChaincodeEvent
+	txEvents	[]*pb.ChaincodeEvent
+
+	// State as of the start of the running transaction
+	committed	map[string][]byte
+}
+
+func NewStub(name string, cc shim.Chaincode) *Stub {
+	return &Stub{
+		MockStub: shim.NewMockStub(name, cc),
+		cc: cc,
+		history: map[string][]*queryresult.KeyModification{},
+	}
+}
+
+// Initialise the chaincode in a transaction of its own
+func (s *Stub) MockInit(txID string, args [][]byte) pb.Response {
+	return s.execute(txID, args, s.cc.Init)
+}
+
+// Invoke the chaincode in a transaction of its own. Like a peer, the stub
+// discards the writes and events of a transaction that returns an error.
+func (s *Stub) MockInvoke(txID string, args [][]byte) pb.Response {
+	return s.execute(txID, args, s.cc.Invoke)
+}
+
+func (s *Stub) execute(txID string, args [][]byte, run func(shim.ChaincodeStubInterface) pb.Response) pb.Response {
+	s.args = args
+	s.txEvents = nil
+
+	state := map[string][]byte{}
+	for key, value := range s.State {
+		state[key] = value
+	}
+	historyLengths := map[string]int{}
+	for key, modifications := range s.history {
+		historyLengths[key] = len(modifications)
+	}
+
+	s.MockTransactionStart(txID)
+	if !s.TxTime.IsZero() {
+		s.TxTimestamp = &timestamp.Timestamp{Seconds: s.TxTime.Unix(), Nanos: int32(s.TxTime.Nanosecond())}
+	}
+	s.committed = state
+	response := run(s)
+	s.committed = nil
+	s.MockTransactionEnd(txID)
+
+	if response.Status != shim.OK {
+		s.restore(state)
+		for key := range s.history {
+			s.history[key] = s.history[key][:historyLengths[key]]
+		}
+		return response
+	}
+	// Fabric keeps the last event set by a transaction
+	if len(s.txEvents) > 0 {
+		s.Events = append(s.Events, s.txEvents[len(s.txEvents) - 1])
+	}
+
+	return response
+}
+
+func (s *Stub) restore(state map[string][]byte) {
+	keys := []string{}
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	s.State = state
+	s.Keys = list.New()
+	for _, key := range keys {
+		s.Keys.PushBack(key)
+	}
+}
+
+// Number of events set by the last transaction; Fabric keeps only the last one
+func (s *Stub) TxEventCount() int {
+	return len(s.txEvents)
+}
+
+// Like a peer, a transaction reads the committed state and not its own writes
+func (s *Stub) GetState(key string) ([]byte, error) {
+	if s.committed != nil {
+		return s.committed[key], nil
+	}
+	return s.MockStub.GetState(key)
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.Creator, nil
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := []string{}
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	slice := []byte{}
+	for _, arg := range s.args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	err := s.MockStub.PutState(key, value)
+	if err != nil {
+		return err
+	}
+	s.record(key, &queryresult.KeyModification{TxId: s.TxID, Value: value, Timestamp: s.TxTimestamp})
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	if s.TxID == "" {
+		return errors.New("Cannot DelState outside a transaction.")
+	}
+	err := s.MockStub.DelState(key)
+	if err != nil {
+		return err
+	}
+	s.record(key, &queryresult.KeyModification{TxId: s.TxID, Timestamp: s.TxTimestamp, IsDelete: true})
+	return nil
+}
+
+// The history database keeps the last write of a key in each transaction
+func (s *Stub) record(key string, modification *queryresult.KeyModification) {
+	modifications := s.history[key]
+	if len(modifications) > 0 && modifications[len(modifications) - 1].TxId == modification.TxId {
+		modifications[len(modifications) - 1] = modification
+		return
+	}
+	s.history[key] = append(modifications, modification)
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("Event name must not be empty.")
+	}
+	s.txEvents = append(s.txEvents, &pb.ChaincodeEvent{TxId: s.TxID, EventName: name, Payload: payload})
+	return nil
+}
+
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{append([]*queryresult.KeyModification{}, s.history[key]...)}, nil
+}
+
+// Evaluate a CouchDB query against the JSON documents of the mock state
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	if s.QueryError != nil {
+		return nil, s.QueryError
+	}
+	parsed, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := []Document{}
+	for element := s.Keys.Front(); element != nil; element = element.Next() {
+		key := element.Value.(string)
+		var fields map[string]interface{}
+		// Values that are not JSON objects are stored as attachments and never match
+		if json.Unmarshal(s.State[key], &fields) != nil || fields == nil {
+			continue
+		}
+		documents = append(documents, Document{key, fields})
+	}
+
+	matches, err := parsed.Execute(documents)
+	if err != nil {
+		return nil, err
+	}
+	kvs := []*queryresult.KV{}
+	for _, document := range matches {
+		kvs = append(kvs, &queryresult.KV{Key: document.Key, Value: s.State[document.Key]})
+	}
+
+	return &stateIterator{kvs}, nil
+}
+
+type stateIterator struct {
+	kvs			[]*queryresult.KV
+}
+
+func (i *stateIterator) HasNext() bool {
+	return len(i.kvs) > 0
+}
+
+func (i *stateIterator) Next() (*queryresult.KV, error) {
+	if len(i.kvs) == 0 {
+		return nil, errors.New("No more results.")
+	}
+	kv := i.kvs[0]
+	i.kvs = i.kvs[1:]
+	return kv, nil
+}
+
+func (i *stateIterator) Close() error {
+	return nil
+}
+
+type historyIterator struct {
+	modifications	[]*queryresult.KeyModification
+}
+
+func (i *historyIterator) HasNext() bool {
+	return len(i.modifications) > 0
+}
+
+func (i *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(i.modifications) == 0 {
+		return nil, errors.New("No more modifications.")
+	}
+	modification := i.modifications[0]
+	i.modifications = i.modifications[1:]
+	return modification, nil
+}
+
+func (i *historyIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package shimtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Minimal chaincode writing its arguments as key/value pairs, failing on an odd count
+type pairsChaincode struct{}
+
+func (c *pairsChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (c *pairsChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	args := stub.GetStringArgs()
+	for i := 0; i + 1 < len(args); i += 2 {
+		err := stub.PutState(args[i], []byte(args[i + 1]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	stub.SetEvent("first", nil)
+	stub.SetEvent("PAIRS_WRITTEN", []byte(strings.Join(args, ",")))
+	if len(args) % 2 != 0 {
+		return shim.Error("Odd number of arguments.")
+	}
+	return shim.Success(nil)
+}
+
+func TestTransactions(t *testing.T) {
+	stub := NewStub("shimtest", &pairsChaincode{})
+
+	response := stub.MockInvoke("tx1", [][]byte{[]byte("a"), []byte("1"), []byte("a"), []byte("2")})
+	if response.Status != shim.OK {
+		t.Fatal(response.Message)
+	}
+	response = stub.MockInvoke("tx2", [][]byte{[]byte("a"), []byte("3"), []byte("b")})
+	if response.Status == shim.OK {
+		t.Fatal("Odd number of arguments accepted")
+	}
+
+	// The failed transaction left no trace
+	if string(stub.State["a"]) != "2" || stub.State["b"] != nil || stub.Keys.Len() != 1 {
+		t.Errorf("State %v after rollback", stub.State)
+	}
+	if len(stub.Events) != 1 || stub.Events[0].EventName != "PAIRS_WRITTEN" || stub.Events[0].TxId != "tx1" {
+		t.Errorf("Events %v; expected the last event of tx1", stub.Events)
+	}
+
+	// History keeps the last write of each transaction
+	iterator, err := stub.GetHistoryForKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []string{}
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, modification.TxId + "=" + string(modification.Value))
+	}
+	if strings.Join(values, ",") != "tx1=2" {
+		t.Errorf("History %v; expected [tx1=2]", values)
+	}
+}
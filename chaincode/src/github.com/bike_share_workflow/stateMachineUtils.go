@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Entity whose status follows the state machine of its object type
+type StatefulEntity interface {
+	Entity
+	objectType() string
+	entityId() string
+	status() *string
+}
+
+func (u *User) objectType() string { return USER }
+func (u *User) entityId() string { return u.Id }
+func (u *User) status() *string { return &u.Status }
+
+func (b *Bike) objectType() string { return BIKE }
+func (b *Bike) entityId() string { return b.Id }
+func (b *Bike) status() *string { return &b.Status }
+
+func (r *Ride) objectType() string { return RIDE }
+func (r *Ride) entityId() string { return r.Id }
+func (r *Ride) status() *string { return &r.Status }
+
+func (i *Issue) objectType() string { return ISSUE }
+func (i *Issue) entityId() string { return i.Id }
+func (i *Issue) status() *string { return &i.Status }
+
+func (s *Station) objectType() string { return STATION }
+func (s *Station) entityId() string { return s.Id }
+func (s *Station) status() *string { return &s.Status }
+
+func (z *Zone) objectType() string { return ZONE }
+func (z *Zone) entityId() string { return z.Id }
+func (z *Zone) status() *string { return &z.Status }
+
+func (r *Repair) objectType() string { return REPAIR }
+func (r *Repair) entityId() string { return r.Id }
+func (r *Repair) status() *string { return &r.Status }
+
+// Condition a transition checks before it changes the status
+type Guard struct {
+	Description		string		`json:"description"`
+	check			func(shim.ChaincodeStubInterface, StatefulEntity) error
+}
+
+// Change a transition makes to other entities once the status changed; changes are added to the event
+type Effect struct {
+	Description		string		`json:"description"`
+	apply			func(shim.ChaincodeStubInterface, StatefulEntity, *Event) error
+}
+
+// Transition of an entity between statuses, named after the function making it
+type Transition struct {
+	Name			string		`json:"name"`
+	From			[]string	`json:"from"`
+	To				string		`json:"to"`
+	Guards			[]Guard		`json:"guards"`
+	Effects			[]Effect	`json:"effects"`
+	refused			refusal
+	refusedFrom		map[string]refusal	// Refusals from particular statuses
+}
+
+// Error code and message format of a refused transition; the format takes the entity ID
+type refusal struct {
+	code			string
+	message			string
+}
+
+type StateMachine struct {
+	ObjectType		string			`json:"objectType"`
+	Initial			string			`json:"initial"`		// Status of new entities
+	States			[]string		`json:"states"`
+	Transitions		[]*Transition	`json:"transitions"`
+}
+
+func transition(name string, from []string, to string, code string, refused string) *Transition {
+	return &Transition{name, from, to, []Guard{}, []Effect{}, refusal{code, refused}, map[string]refusal{}}
+}
+
+func (t *Transition) guard(description string, check func(shim.ChaincodeStubInterface, StatefulEntity) error) *Transition {
+	t.Guards = append(t.Guards, Guard{description, check})
+	return t
+}
+
+func (t *Transition) effect(description string, apply func(shim.ChaincodeStubInterface, StatefulEntity, *Event) error) *Transition {
+	t.Effects = append(t.Effects, Effect{description, apply})
+	return t
+}
+
+func (t *Transition) refuseFrom(status string, code string, refused string) *Transition {
+	t.refusedFrom[status] = refusal{code, refused}
+	return t
+}
+
+// State machines of the object types with a status
+func getStateMachines() map[string]*StateMachine {
+	return map[string]*StateMachine{
+		USER: {USER, USER_FREE, []string{USER_FREE, USER_IN_RIDE}, []*Transition{
+			transition("startRide", []string{USER_FREE}, USER_IN_RIDE, ERR_USER_HAS_ONGOING_RIDE, "User %s has another ongoing ride.").
+				guard("The user has a positive available balance", hasPositiveBalance),
+			transition("endRide", []string{USER_IN_RIDE}, USER_FREE, ERR_USER_NO_ONGOING_RIDE, "User %s doesn't have an ongoing ride."),
+			transition("voidRide", []string{USER_IN_RIDE}, USER_FREE, ERR_USER_NO_ONGOING_RIDE, "User %s doesn't have an ongoing ride."),
+			transition("reserveBike", []string{USER_FREE}, USER_FREE, ERR_USER_HAS_ONGOING_RIDE, "User %s has an ongoing ride.").
+				guard("The user has a positive available balance", hasPositiveBalance),
+		}},
+		BIKE: {BIKE, BIKE_AVAILABLE, []string{BIKE_AVAILABLE, BIKE_RESERVED, BIKE_IN_USE, BIKE_TO_REPAIR, BIKE_REPAIRING, BIKE_REPAIRED, BIKE_DISCARDED}, []*Transition{
+			transition("reserveBike", []string{BIKE_AVAILABLE}, BIKE_RESERVED, ERR_BIKE_NOT_AVAILABLE, "Bike %s not available."),
+			// Also fired by the first transaction touching the bike after its reservation ran out
+			transition("cancelReservation", []string{BIKE_RESERVED}, BIKE_AVAILABLE, ERR_BIKE_NOT_RESERVED, "Bike %s not reserved."),
+			transition("startRide", []string{BIKE_AVAILABLE, BIKE_RESERVED}, BIKE_IN_USE, ERR_BIKE_NOT_AVAILABLE, "Bike %s not available."),
+			transition("endRide", []string{BIKE_IN_USE}, BIKE_AVAILABLE, ERR_BIKE_NOT_IN_USE, "Bike %s not in use."),
+			transition("voidRide", []string{BIKE_IN_USE}, BIKE_AVAILABLE, ERR_BIKE_NOT_IN_USE, "Bike %s not in use."),
+			transition("requestRepair", []string{BIKE_AVAILABLE}, BIKE_TO_REPAIR, ERR_BIKE_NOT_AVAILABLE, "Bike %s not available."),
+			transition("acceptRepair", []string{BIKE_TO_REPAIR}, BIKE_REPAIRING, ERR_BIKE_NOT_READY_TO_REPAIR, "Bike %s not ready to repair."),
+			transition("completeRepair", []string{BIKE_REPAIRING}, BIKE_REPAIRED, ERR_BIKE_NOT_REPAIRING, "Bike %s not repairing."),
+			transition("reactivateBike", []string{BIKE_TO_REPAIR, BIKE_REPAIRED}, BIKE_AVAILABLE, ERR_BIKE_ACTIVE, "Bike %s active.").
+				refuseFrom(BIKE_DISCARDED, ERR_BIKE_DISCARDED, "Bike %s discarded.").
+				refuseFrom(BIKE_REPAIRING, ERR_BIKE_UNDER_REPAIR, "Bike %s repairing.").
+				effect("Cancel the requested repairs of the bike", cancelRequestedRepairs),
+			transition("discardBike", []string{BIKE_AVAILABLE}, BIKE_DISCARDED, ERR_BIKE_NOT_AVAILABLE, "Bike %s not available."),
+		}},
+		RIDE: {RIDE, RIDE_ONGOING, []string{RIDE_ONGOING, RIDE_COMPLETED, RIDE_ISSUE_OPEN, RIDE_ISSUE_CLOSED, RIDE_VOIDED}, []*Transition{
+			transition("endRide", []string{RIDE_ONGOING}, RIDE_COMPLETED, ERR_RIDE_NOT_ONGOING, "Ride %s not ongoing."),
+			transition("voidRide", []string{RIDE_ONGOING}, RIDE_VOIDED, ERR_RIDE_NOT_ONGOING, "Ride %s not ongoing."),
+			transition("reportIssue", []string{RIDE_COMPLETED}, RIDE_ISSUE_OPEN, ERR_RIDE_NOT_COMPLETED, "Ride %s not completed."),
+			transition("acceptIssue", []string{RIDE_ISSUE_OPEN}, RIDE_ISSUE_CLOSED, ERR_RIDE_NO_OPEN_ISSUE, "Ride %s not associated with an issue."),
+			transition("rejectIssue", []string{RIDE_ISSUE_OPEN}, RIDE_ISSUE_CLOSED, ERR_RIDE_NO_OPEN_ISSUE, "Ride %s not associated with an issue."),
+		}},
+		ISSUE: {ISSUE, ISSUE_OPEN, []string{ISSUE_OPEN, ISSUE_CLOSED}, []*Transition{
+			transition("acceptIssue", []string{ISSUE_OPEN}, ISSUE_CLOSED, ERR_ISSUE_NOT_OPEN, "Issue %s not open."),
+			transition("rejectIssue", []string{ISSUE_OPEN}, ISSUE_CLOSED, ERR_ISSUE_NOT_OPEN, "Issue %s not open."),
+		}},
+		REPAIR: {REPAIR, REPAIR_REQUESTED, []string{REPAIR_REQUESTED, REPAIR_ACCEPTED, REPAIR_REJECTED, REPAIR_COMPLETED, REPAIR_CANCELLED}, []*Transition{
+			transition("acceptRepair", []string{REPAIR_REQUESTED}, REPAIR_ACCEPTED, ERR_REPAIR_ALREADY_PROCESSED, "Repair %s already processed."),
+			transition("rejectRepair", []string{REPAIR_REQUESTED}, REPAIR_REJECTED, ERR_REPAIR_ALREADY_PROCESSED, "Repair %s already processed.").
+				guard("The bike is ready to repair", bikeReadyToRepair),
+			transition("completeRepair", []string{REPAIR_ACCEPTED}, REPAIR_COMPLETED, ERR_REPAIR_NOT_ACCEPTED, "Repair %s not accepted."),
+			transition("reactivateBike", []string{REPAIR_REQUESTED}, REPAIR_CANCELLED, ERR_REPAIR_ALREADY_PROCESSED, "Repair %s already processed."),
+		}},
+		STATION: {STATION, STATION_ACTIVE, []string{STATION_ACTIVE, STATION_RETIRED}, []*Transition{
+			transition("retireStation", []string{STATION_ACTIVE}, STATION_RETIRED, ERR_STATION_RETIRED, "Station %s retired.").
+				guard("No bike is docked at the station", stationEmpty).
+				effect("Close the docks of the station", closeDocks),
+		}},
+		ZONE: {ZONE, ZONE_ACTIVE, []string{ZONE_ACTIVE, ZONE_REMOVED}, []*Transition{
+			transition("removeZone", []string{ZONE_ACTIVE}, ZONE_REMOVED, ERR_ZONE_REMOVED, "Zone %s removed."),
+		}},
+	}
+}
+
+func getStateMachine(objectType string) (*StateMachine, error) {
+	machine, ok := getStateMachines()[objectType]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("No state machine for %s.", objectType))
+	}
+	return machine, nil
+}
+
+// Statuses of an object type, for the status arguments of the registry
+func getStates(objectType string) []string {
+	return getStateMachines()[objectType].States
+}
+
+func (m *StateMachine) findTransition(name string) (*Transition, bool) {
+	for _, transition := range m.Transitions {
+		if transition.Name == name {
+			return transition, true
+		}
+	}
+	return nil, false
+}
+
+// Move an entity along the named transition of its state machine: refuse it from a status the
+// table doesn't list, check the guards, change the status and apply the side effects. The status
+// change is added to the event; the caller writes the entity.
+func fire(stub shim.ChaincodeStubInterface, entity StatefulEntity, name string, event *Event) error {
+	machine, err := getStateMachine(entity.objectType())
+	if err != nil {
+		return err
+	}
+	transition, ok := machine.findTransition(name)
+	if !ok {
+		return errors.New(fmt.Sprintf("No transition %s for %s.", name, machine.ObjectType))
+	}
+
+	// Verify if the transition is allowed from the current status
+	from := *entity.status()
+	allowed := false
+	for _, status := range transition.From {
+		if status == from {
+			allowed = true
+		}
+	}
+	if !allowed {
+		refused, ok := transition.refusedFrom[from]
+		if !ok {
+			refused = transition.refused
+		}
+		return newError(refused.code, fmt.Sprintf(refused.message, entity.entityId())).withEntity(machine.ObjectType, entity.entityId())
+	}
+
+	for _, guard := range transition.Guards {
+		err = guard.check(stub, entity)
+		if err != nil {
+			return err
+		}
+	}
+
+	*entity.status() = transition.To
+	event.addChange(machine.ObjectType, entity.entityId(), from, transition.To)
+
+	for _, effect := range transition.Effects {
+		err = effect.apply(stub, entity, event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasPositiveBalance(stub shim.ChaincodeStubInterface, entity StatefulEntity) error {
+	user := entity.(*User)
+	if user.availableBalance().Amount <= 0 {
+		return newError(ERR_INSUFFICIENT_BALANCE, fmt.Sprintf("User %s has negative balance.", user.Id)).withEntity(USER, user.Id)
+	}
+	return nil
+}
+
+func bikeReadyToRepair(stub shim.ChaincodeStubInterface, entity StatefulEntity) error {
+	bike, err := bikes(stub).MustGet(entity.(*Repair).BikeId)
+	if err != nil {
+		return err
+	}
+	if bike.Status != BIKE_TO_REPAIR {
+		return newError(ERR_BIKE_NOT_READY_TO_REPAIR, fmt.Sprintf("Bike %s not ready to repair.", bike.Id)).withEntity(BIKE, bike.Id)
+	}
+	return nil
+}
+
+func stationEmpty(stub shim.ChaincodeStubInterface, entity StatefulEntity) error {
+	station := entity.(*Station)
+	if station.DockedCount > 0 {
+		return newError(ERR_STATION_NOT_EMPTY, fmt.Sprintf("Station %s has bikes docked.", station.Id)).withEntity(STATION, station.Id)
+	}
+	return nil
+}
+
+func closeDocks(stub shim.ChaincodeStubInterface, entity StatefulEntity, event *Event) error {
+	refreshDockAvailability(entity.(*Station))
+	return nil
+}
+
+// A bike put back into service no longer needs the repairs requested for it. The repairs are
+// found through the key index, whose range reads are checked again at validation.
+func cancelRequestedRepairs(stub shim.ChaincodeStubInterface, entity StatefulEntity, event *Event) error {
+	records, _, err := getIndexQueryPage(stub, newSelector(REPAIR).equals("bikeId", entity.entityId()), 0, "")
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		var repair *Repair
+		err = json.Unmarshal(record.Value, &repair)
+		if err != nil {
+			return err
+		}
+		if repair.Status != REPAIR_REQUESTED {
+			continue
+		}
+
+		err = fire(stub, repair, "reactivateBike", event)
+		if err != nil {
+			return err
+		}
+		err = repairs(stub).Update(repair)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
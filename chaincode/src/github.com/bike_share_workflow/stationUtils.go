@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Dock slots of a new station, all free
+func newDocks(capacity int) []string {
+	return make([]string, capacity)
+}
+
+// Keep the docked count and availability of a station in step with its dock slots
+func refreshDockAvailability(station *Station) {
+	station.DockedCount = 0
+	for _, bikeID := range station.Docks {
+		if bikeID != "" {
+			station.DockedCount++
+		}
+	}
+
+	if station.Status == STATION_RETIRED {
+		station.DockAvailability = DOCKS_CLOSED
+	} else if station.DockedCount < station.Capacity {
+		station.DockAvailability = DOCKS_FREE
+	} else {
+		station.DockAvailability = DOCKS_FULL
+	}
+}
+
+// Verify if a station is in service
+func checkStationActive(station *Station) error {
+	if station.Status != STATION_ACTIVE {
+		return newError(ERR_STATION_RETIRED, fmt.Sprintf("Station %s retired.", station.Id)).withEntity(STATION, station.Id)
+	}
+	return nil
+}
+
+// Dock a bike in the first free slot of a station. The caller writes both.
+func dockBike(station *Station, bike *Bike) error {
+	err := checkStationActive(station)
+	if err != nil {
+		return err
+	}
+
+	for i, bikeID := range station.Docks {
+		if bikeID == "" {
+			station.Docks[i] = bike.Id
+			bike.StationId = station.Id
+			setBikeLocation(bike, station.Location)
+			refreshDockAvailability(station)
+			return nil
+		}
+	}
+	return newError(ERR_STATION_FULL, fmt.Sprintf("Station %s has no free dock.", station.Id)).withEntity(STATION, station.Id)
+}
+
+// Take a bike out of the slot it is docked in. The caller writes both.
+func undockBike(station *Station, bike *Bike) error {
+	for i, bikeID := range station.Docks {
+		if bikeID == bike.Id {
+			station.Docks[i] = ""
+			bike.StationId = ""
+			refreshDockAvailability(station)
+			return nil
+		}
+	}
+	return newError(ERR_BIKE_NOT_AT_STATION, fmt.Sprintf("Bike %s not docked at station %s.", bike.Id, station.Id)).withEntity(BIKE, bike.Id)
+}
+
+// Change the number of dock slots of a station. Slots are removed from the end and must be free.
+func resizeDocks(station *Station, capacity int) error {
+	for i := capacity; i < len(station.Docks); i++ {
+		if station.Docks[i] != "" {
+			return newError(ERR_STATION_NOT_EMPTY, fmt.Sprintf("Station %s has bike %s docked in slot %d.", station.Id, station.Docks[i], i + 1)).withEntity(STATION, station.Id)
+		}
+	}
+
+	if capacity < len(station.Docks) {
+		station.Docks = station.Docks[:capacity]
+	} else {
+		station.Docks = append(station.Docks, newDocks(capacity - len(station.Docks))...)
+	}
+	station.Capacity = capacity
+	refreshDockAvailability(station)
+	return nil
+}
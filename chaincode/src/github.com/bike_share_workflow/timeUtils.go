@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// Get the transaction timestamp set by the client and endorsed by the peers
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC(), nil
+}
+
+// Parse a timestamp given either as RFC3339 or, for records written by
+// earlier chaincode versions, as Unix seconds
+func parseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t.UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Malformed timestamp %s. Expecting RFC3339 or Unix seconds.", value))
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Verify that a client-reported device time is within the allowed skew of the transaction time
+func checkDeviceTime(txTime time.Time, deviceTime time.Time, maxSkewSeconds int) error {
+	skew := deviceTime.Sub(txTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > time.Duration(maxSkewSeconds) * time.Second {
+		return newError(ERR_DEVICE_TIME_SKEWED, fmt.Sprintf("Device time %s differs from transaction time %s by more than %d seconds.", formatTimestamp(deviceTime), formatTimestamp(txTime), maxSkewSeconds))
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// GPS sample of a ride track, as given to appendRideTrack and returned by getRideTrack
+type TrackSample struct {
+	Longitude		float64		`json:"longitude"`
+	Latitude		float64		`json:"latitude"`
+	Time			string		`json:"time"`
+}
+
+// Sample as stored: coordinates in millionths of a degree and Unix seconds, so that
+// every peer encodes, hashes and measures the same values
+type trackPoint struct {
+	longitude		int64
+	latitude		int64
+	time			int64
+}
+
+// Track of a ride with the Merkle root recorded on the ride and the one recomputed from the stored samples
+type RideTrack struct {
+	RideId			string			`json:"rideId"`
+	Samples			[]TrackSample	`json:"samples"`
+	TrackRoot		string			`json:"trackRoot"`
+	Verified		bool			`json:"verified"`
+	DistanceMeters	int64			`json:"distanceMeters"`	// Of a completed ride
+}
+
+// Track segment IDs are the ride ID and a zero-padded sequence number, so a
+// ride's segments sort in the order they were appended
+func getTrackSegmentID(rideID string, sequence int) string {
+	return fmt.Sprintf("%s-%06d", rideID, sequence)
+}
+
+func toTrackCoordinate(degrees float64) int64 {
+	return int64(math.Floor(degrees * TRACK_COORDINATE_SCALE + 0.5))
+}
+
+func fromTrackCoordinate(value int64) float64 {
+	return float64(value) / TRACK_COORDINATE_SCALE
+}
+
+func (p trackPoint) sample() TrackSample {
+	return TrackSample{fromTrackCoordinate(p.longitude), fromTrackCoordinate(p.latitude), formatTimestamp(time.Unix(p.time, 0))}
+}
+
+// Decode the samples given to appendRideTrack and verify that they follow the track so far: in
+// the coordinate ranges, in time order, not before the ride started or the last sample, and not
+// after the transaction time allowing for the clock skew
+func parseTrackSamples(value string, ride *Ride, txTime time.Time, maxSkewSeconds int) ([]trackPoint, error) {
+	var samples []TrackSample
+	err := json.Unmarshal([]byte(value), &samples)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed samples: %s", err.Error()))
+	}
+	if len(samples) < 1 || len(samples) > MAX_TRACK_APPEND_SAMPLES {
+		return nil, errors.New(fmt.Sprintf("Between 1 and %d samples may be appended at a time.", MAX_TRACK_APPEND_SAMPLES))
+	}
+	if ride.TrackSampleCount + len(samples) > MAX_TRACK_SAMPLES {
+		return nil, errors.New(fmt.Sprintf("A track has at most %d samples.", MAX_TRACK_SAMPLES))
+	}
+
+	previous, err := parseTimestamp(ride.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	if ride.TrackEndTime != "" {
+		previous, err = parseTimestamp(ride.TrackEndTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	latest := txTime.Add(time.Duration(maxSkewSeconds) * time.Second)
+
+	points := []trackPoint{}
+	for i, sample := range samples {
+		if !isValidLocation(sample.Longitude, sample.Latitude) {
+			return nil, errors.New(fmt.Sprintf("Sample %d must have a longitude between -180 and 180 and a latitude between -90 and 90.", i + 1))
+		}
+		sampleTime, err := parseTimestamp(sample.Time)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Sample %d: %s", i + 1, err.Error()))
+		}
+		if sampleTime.Before(previous) {
+			return nil, errors.New(fmt.Sprintf("Sample %d at %s before the ride start or the previous sample at %s.", i + 1, formatTimestamp(sampleTime), formatTimestamp(previous)))
+		}
+		if sampleTime.After(latest) {
+			return nil, errors.New(fmt.Sprintf("Sample %d at %s after the transaction time.", i + 1, formatTimestamp(sampleTime)))
+		}
+		previous = sampleTime
+		points = append(points, trackPoint{toTrackCoordinate(sample.Longitude), toTrackCoordinate(sample.Latitude), sampleTime.Unix()})
+	}
+	return points, nil
+}
+
+// Encode samples as a polyline: for each sample the latitude, longitude and time, each as the
+// difference to the previous sample, zigzag encoded and written in 5-bit groups as printable
+// characters. Slow-moving tracks take a few characters per sample.
+func encodeTrack(points []trackPoint) string {
+	encoded := []byte{}
+	var previous trackPoint
+	for _, point := range points {
+		for _, delta := range []int64{point.latitude - previous.latitude, point.longitude - previous.longitude, point.time - previous.time} {
+			value := uint64(delta << 1)
+			if delta < 0 {
+				value = ^value
+			}
+			for value >= 0x20 {
+				encoded = append(encoded, byte((0x20 | (value & 0x1f)) + 63))
+				value >>= 5
+			}
+			encoded = append(encoded, byte(value + 63))
+		}
+		previous = point
+	}
+	return string(encoded)
+}
+
+func decodeTrack(encoded string) ([]trackPoint, error) {
+	points := []trackPoint{}
+	var previous trackPoint
+	values := []int64{}
+	var value uint64
+	var shift uint
+	for i := 0; i < len(encoded); i++ {
+		chunk := uint64(encoded[i]) - 63
+		if encoded[i] < 63 || chunk > 0x3f || shift > 63 {
+			return nil, errors.New(fmt.Sprintf("Malformed track at position %d.", i))
+		}
+		value |= (chunk & 0x1f) << shift
+		shift += 5
+		if chunk >= 0x20 {
+			continue
+		}
+
+		delta := int64(value >> 1)
+		if value & 1 != 0 {
+			delta = ^delta
+		}
+		values = append(values, delta)
+		value, shift = 0, 0
+		if len(values) == 3 {
+			point := trackPoint{previous.longitude + values[1], previous.latitude + values[0], previous.time + values[2]}
+			points = append(points, point)
+			previous = point
+			values = values[:0]
+		}
+	}
+	if len(values) != 0 || shift != 0 {
+		return nil, errors.New("Truncated track.")
+	}
+	return points, nil
+}
+
+// Merkle tree hashes as in RFC 6962, with distinct prefixes for leaves and nodes
+func hashTrackLeaf(point trackPoint) []byte {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("\x00%d,%d,%d", point.longitude, point.latitude, point.time)))
+	return hash[:]
+}
+
+func hashTrackNode(left []byte, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{0x01}, left...), right...))
+	return hash[:]
+}
+
+// Append samples to a Merkle tree given by its frontier, the roots of its complete subtrees
+// from the largest to the smallest, one per bit set in the number of leaves. Returns the new
+// frontier and the root of the whole tree.
+func appendTrackLeaves(frontier []string, count int, points []trackPoint) ([]string, string, error) {
+	hashes := [][]byte{}
+	for _, hexHash := range frontier {
+		hash, err := hex.DecodeString(hexHash)
+		if err != nil {
+			return nil, "", err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	for _, point := range points {
+		hash := hashTrackLeaf(point)
+		// Merge with the subtrees of the same size, one for each trailing bit set in the count
+		for n := count; n & 1 == 1; n >>= 1 {
+			hash = hashTrackNode(hashes[len(hashes) - 1], hash)
+			hashes = hashes[:len(hashes) - 1]
+		}
+		hashes = append(hashes, hash)
+		count++
+	}
+
+	newFrontier := []string{}
+	for _, hash := range hashes {
+		newFrontier = append(newFrontier, hex.EncodeToString(hash))
+	}
+	if len(hashes) == 0 {
+		return newFrontier, "", nil
+	}
+	root := hashes[len(hashes) - 1]
+	for i := len(hashes) - 2; i >= 0; i-- {
+		root = hashTrackNode(hashes[i], root)
+	}
+	return newFrontier, hex.EncodeToString(root), nil
+}
+
+// Write samples as the next segment of the track of a ride and advance the ride's Merkle root.
+// The caller writes the ride.
+func appendTrackSegment(stub shim.ChaincodeStubInterface, ride *Ride, points []trackPoint) (*TrackSegment, error) {
+	frontier, root, err := appendTrackLeaves(ride.TrackFrontier, ride.TrackSampleCount, points)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &TrackSegment{TRACK_SEGMENT, getTrackSegmentID(ride.Id, ride.TrackSegmentCount + 1), ride.Id, ride.TrackSampleCount, len(points), encodeTrack(points), root, Audit{}}
+	err = trackSegments(stub).Create(segment)
+	if err != nil {
+		return nil, err
+	}
+
+	ride.TrackSegmentCount++
+	ride.TrackSampleCount += len(points)
+	ride.TrackEndTime = formatTimestamp(time.Unix(points[len(points) - 1].time, 0))
+	ride.TrackFrontier = frontier
+	ride.TrackRoot = root
+	return segment, nil
+}
+
+// Get the samples of a ride's track, in order, through the key index
+func getTrackPoints(stub shim.ChaincodeStubInterface, rideID string) ([]trackPoint, error) {
+	records, _, err := getIndexQueryPage(stub, newSelector(TRACK_SEGMENT).equals("rideId", rideID), 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	points := []trackPoint{}
+	for _, record := range records {
+		var segment *TrackSegment
+		err = json.Unmarshal(record.Value, &segment)
+		if err != nil {
+			return nil, err
+		}
+		segmentPoints, err := decodeTrack(segment.Samples)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, segmentPoints...)
+	}
+	return points, nil
+}
+
+// Length of the path from the start location through the samples to the end location, rounded to whole meters
+func getTrackDistance(start []float32, points []trackPoint, end []float32) int64 {
+	path := [][]float64{}
+	if len(start) == 2 {
+		path = append(path, []float64{float64(start[0]), float64(start[1])})
+	}
+	for _, point := range points {
+		path = append(path, []float64{fromTrackCoordinate(point.longitude), fromTrackCoordinate(point.latitude)})
+	}
+	if len(end) == 2 {
+		path = append(path, []float64{float64(end[0]), float64(end[1])})
+	}
+
+	distance := 0.0
+	for i := 1; i < len(path); i++ {
+		distance += haversineDistance(path[i - 1][0], path[i - 1][1], path[i][0], path[i][1])
+	}
+	return int64(math.Floor(distance + 0.5))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+var zoneTypes = []string{ZONE_SERVICE_AREA, ZONE_NO_PARKING, ZONE_PREFERRED_PARKING}
+
+// Zones containing a location and the fee a ride ending there pays
+type LocationCheck struct {
+	Location			[]float64	`json:"location"`
+	InServiceArea		bool		`json:"inServiceArea"`		// Also true when no service area is defined
+	Zones				[]*Zone		`json:"zones"`				// Active zones containing the location, by ID
+	ZoneId				string		`json:"zoneId"`				// Zone deciding the fee, if any
+	Fee					Money		`json:"fee"`				// Surcharge, or negative discount
+}
+
+// Decode a polygon given as a JSON array of [longitude, latitude] pairs
+func parsePolygon(value string) ([][]float64, error) {
+	var polygon [][]float64
+	err := json.Unmarshal([]byte(value), &polygon)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Malformed polygon: %s", err.Error()))
+	}
+	if len(polygon) < 3 || len(polygon) > MAX_ZONE_VERTICES {
+		return nil, errors.New(fmt.Sprintf("Polygon must have between 3 and %d vertices.", MAX_ZONE_VERTICES))
+	}
+	for i, vertex := range polygon {
+		if len(vertex) != 2 || vertex[0] < -180 || vertex[0] > 180 || vertex[1] < -90 || vertex[1] > 90 {
+			return nil, errors.New(fmt.Sprintf("Vertex %d must be a [longitude, latitude] pair.", i + 1))
+		}
+	}
+	return polygon, nil
+}
+
+// Even-odd ray casting. Only comparisons and float64 arithmetic on the stored
+// vertices are involved, so every endorsing peer reaches the same answer.
+func polygonContains(polygon [][]float64, longitude float64, latitude float64) bool {
+	inside := false
+	j := len(polygon) - 1
+	for i := 0; i < len(polygon); i++ {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > latitude) != (yj > latitude) && longitude < (xj - xi) * (latitude - yi) / (yj - yi) + xi {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
+
+// Get the active zones, ordered by ID, through the key index
+func getActiveZones(stub shim.ChaincodeStubInterface) ([]*Zone, error) {
+	records, _, err := getIndexQueryPage(stub, newSelector(ZONE).equals("status", ZONE_ACTIVE), 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	activeZones := []*Zone{}
+	for _, record := range records {
+		var zone *Zone
+		err = json.Unmarshal(record.Value, &zone)
+		if err != nil {
+			return nil, err
+		}
+		activeZones = append(activeZones, zone)
+	}
+	return activeZones, nil
+}
+
+// Find the zones containing a location and the fee of a ride ending there. Ending outside every
+// service area costs the largest service area surcharge. Otherwise the first no-parking zone by ID
+// decides the fee, then the first preferred parking zone.
+func checkLocation(stub shim.ChaincodeStubInterface, longitude float64, latitude float64) (*LocationCheck, error) {
+	activeZones, err := getActiveZones(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &LocationCheck{[]float64{longitude, latitude}, true, []*Zone{}, "", newMoney(0)}
+	var serviceAreaFee *Money
+	var noParking, preferredParking *Zone
+	hasServiceArea := false
+	for _, zone := range activeZones {
+		inside := polygonContains(zone.Polygon, longitude, latitude)
+		if inside {
+			check.Zones = append(check.Zones, zone)
+		}
+
+		if zone.Type == ZONE_SERVICE_AREA {
+			if !hasServiceArea {
+				hasServiceArea = true
+				check.InServiceArea = false
+			}
+			if inside {
+				check.InServiceArea = true
+			}
+			if serviceAreaFee == nil || zone.Fee.Amount > serviceAreaFee.Amount {
+				fee := zone.Fee
+				serviceAreaFee = &fee
+			}
+		} else if inside && zone.Type == ZONE_NO_PARKING && noParking == nil {
+			noParking = zone
+		} else if inside && zone.Type == ZONE_PREFERRED_PARKING && preferredParking == nil {
+			preferredParking = zone
+		}
+	}
+
+	if !check.InServiceArea {
+		check.Fee = *serviceAreaFee
+	} else if noParking != nil {
+		check.ZoneId = noParking.Id
+		check.Fee = noParking.Fee
+	} else if preferredParking != nil {
+		check.ZoneId = preferredParking.Id
+		check.Fee = preferredParking.Fee.Neg()
+	}
+	return check, nil
+}
+
+// Add a zone fee to a fare; a discount never takes the fare below zero
+func applyZoneFee(fare Money, fee Money) (Money, error) {
+	if fee.Amount == 0 {
+		return fare, nil
+	}
+	cost, err := fare.Add(fee)
+	if err != nil {
+		return Money{}, err
+	}
+	if cost.Amount < 0 {
+		cost.Amount = 0
+	}
+	return cost, nil
+}